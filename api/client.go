@@ -0,0 +1,302 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"perun.network/go-perun/channel"
+	"perun.network/perun-cardano-demo/cardanowallet"
+	"perun.network/perun-cardano-demo/client"
+)
+
+// Client is a client for the HTTP API of a daemon.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithHTTPClient makes the client use the given HTTP client instead of
+// http.DefaultClient.
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// NewClient returns a client for the API served at baseURL, e.g.
+// "http://127.0.0.1:8080".
+func NewClient(baseURL string, opts ...ClientOption) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing API URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("parsing API URL: unsupported scheme %q", u.Scheme)
+	}
+	c := &Client{
+		baseURL:    strings.TrimSuffix(strings.TrimSuffix(u.String(), "/"), "/v1") + "/v1",
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Error is an error response of the API.
+type Error struct {
+	StatusCode int    // StatusCode is the HTTP status code.
+	Message    string // Message is the human-readable description.
+	// Reason is the machine-readable reason if the peer rejected the
+	// operation.
+	Reason string
+}
+
+func (e *Error) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("%s (%s)", e.Message, e.Reason)
+	}
+	return e.Message
+}
+
+// Clients returns the clients hosted by the daemon.
+func (c *Client) Clients(ctx context.Context) ([]ClientInfo, error) {
+	var infos []ClientInfo
+	return infos, c.do(ctx, http.MethodGet, "/clients", nil, nil, &infos)
+}
+
+// Balance returns the on-chain balance of the named client.
+func (c *Client) Balance(ctx context.Context, name string) (BalanceInfo, error) {
+	var info BalanceInfo
+	return info, c.do(ctx, http.MethodGet, clientPath(name, "balance"), nil, nil, &info)
+}
+
+// Transactions returns the wallet transactions of the named client that
+// match q.
+func (c *Client) Transactions(ctx context.Context, name string, q cardanowallet.TransactionQuery) ([]cardanowallet.Transaction, error) {
+	var txs []cardanowallet.Transaction
+	return txs, c.do(ctx, http.MethodGet, clientPath(name, "wallet/transactions"), transactionValues(q), nil, &txs)
+}
+
+// Channels returns the open channels of the named client.
+func (c *Client) Channels(ctx context.Context, name string) ([]ChannelInfo, error) {
+	var infos []ChannelInfo
+	return infos, c.do(ctx, http.MethodGet, clientPath(name, "channels"), nil, nil, &infos)
+}
+
+// Channel returns the channel of the named client with the given
+// hex-encoded ID.
+func (c *Client) Channel(ctx context.Context, name, id string) (ChannelInfo, error) {
+	var info ChannelInfo
+	return info, c.do(ctx, http.MethodGet, channelPath(name, id, ""), nil, nil, &info)
+}
+
+// OpenChannel opens a channel with the named client.
+func (c *Client) OpenChannel(ctx context.Context, name string, req OpenChannelRequest) (ChannelInfo, error) {
+	var info ChannelInfo
+	return info, c.do(ctx, http.MethodPost, clientPath(name, "channels"), nil, req, &info)
+}
+
+// SendPayment sends a payment in the channel with the given ID.
+func (c *Client) SendPayment(ctx context.Context, name, id string, req PaymentRequest) (ChannelInfo, error) {
+	var info ChannelInfo
+	return info, c.do(ctx, http.MethodPost, channelPath(name, id, "payments"), nil, req, &info)
+}
+
+// SendBatch sends several transfers in one update of the channel with the
+// given ID. A conditional batch fails with status 409 if the channel is not
+// in the expected state.
+func (c *Client) SendBatch(ctx context.Context, name, id string, req BatchRequest) (ChannelInfo, error) {
+	var info ChannelInfo
+	return info, c.do(ctx, http.MethodPost, channelPath(name, id, "batch"), nil, req, &info)
+}
+
+// Settle settles the channel with the given ID.
+func (c *Client) Settle(ctx context.Context, name, id string) (ChannelInfo, error) {
+	var info ChannelInfo
+	return info, c.do(ctx, http.MethodPost, channelPath(name, id, "settle"), nil, nil, &info)
+}
+
+// ForceClose closes the channel with the given ID on-chain. It returns once
+// the channel is closed, which takes at least its challenge duration.
+func (c *Client) ForceClose(ctx context.Context, name, id string) (ChannelInfo, error) {
+	var info ChannelInfo
+	return info, c.do(ctx, http.MethodPost, channelPath(name, id, "force-close"), nil, nil, &info)
+}
+
+// Payments returns the recorded payments of the named client that pass f.
+func (c *Client) Payments(ctx context.Context, name string, f client.PaymentFilter) ([]client.Payment, error) {
+	var payments []client.Payment
+	return payments, c.do(ctx, http.MethodGet, clientPath(name, "payments"), paymentValues(f), nil, &payments)
+}
+
+// CreateInvoice creates an invoice of the named client.
+func (c *Client) CreateInvoice(ctx context.Context, name string, req CreateInvoiceRequest) (InvoiceInfo, error) {
+	var info InvoiceInfo
+	return info, c.do(ctx, http.MethodPost, clientPath(name, "invoices"), nil, req, &info)
+}
+
+// Invoices returns the invoices of the named client.
+func (c *Client) Invoices(ctx context.Context, name string) ([]InvoiceInfo, error) {
+	var infos []InvoiceInfo
+	return infos, c.do(ctx, http.MethodGet, clientPath(name, "invoices"), nil, nil, &infos)
+}
+
+// Invoice returns the invoice of the named client with the given ID.
+func (c *Client) Invoice(ctx context.Context, name, id string) (InvoiceInfo, error) {
+	var info InvoiceInfo
+	return info, c.do(ctx, http.MethodGet, clientPath(name, "invoices/"+url.PathEscape(id)), nil, nil, &info)
+}
+
+// RequestPayment requests a payment from the peer of the channel with the
+// given ID. It returns the paid invoice once the peer paid it.
+func (c *Client) RequestPayment(ctx context.Context, name, id string, req RequestPaymentRequest) (InvoiceInfo, error) {
+	var info InvoiceInfo
+	return info, c.do(ctx, http.MethodPost, channelPath(name, id, "requests"), nil, req, &info)
+}
+
+// PendingRequests returns the payment requests of peers awaiting a decision
+// of the named client.
+func (c *Client) PendingRequests(ctx context.Context, name string) ([]PendingRequestInfo, error) {
+	var infos []PendingRequestInfo
+	return infos, c.do(ctx, http.MethodGet, clientPath(name, "requests"), nil, nil, &infos)
+}
+
+// DecideRequest pays or declines the pending payment request with the given
+// ID.
+func (c *Client) DecideRequest(ctx context.Context, name, id string, req DecisionRequest) error {
+	return c.do(ctx, http.MethodPost, clientPath(name, "requests/"+url.PathEscape(id)), nil, req, nil)
+}
+
+// StartStream starts a payment stream in the channel with the given ID.
+func (c *Client) StartStream(ctx context.Context, name, id string, req StartStreamRequest) (StreamInfo, error) {
+	var info StreamInfo
+	return info, c.do(ctx, http.MethodPost, channelPath(name, id, "stream"), nil, req, &info)
+}
+
+// Stream returns the status of the current or last payment stream in the
+// channel with the given ID.
+func (c *Client) Stream(ctx context.Context, name, id string) (StreamInfo, error) {
+	var info StreamInfo
+	return info, c.do(ctx, http.MethodGet, channelPath(name, id, "stream"), nil, nil, &info)
+}
+
+// StopStream stops the payment stream in the channel with the given ID and
+// returns its final status.
+func (c *Client) StopStream(ctx context.Context, name, id string) (StreamInfo, error) {
+	var info StreamInfo
+	return info, c.do(ctx, http.MethodPost, channelPath(name, id, "stream/stop"), nil, nil, &info)
+}
+
+func clientPath(name, sub string) string {
+	return "/clients/" + url.PathEscape(name) + "/" + sub
+}
+
+func channelPath(name, id, sub string) string {
+	return clientPath(name, "channels/"+url.PathEscape(id)+"/"+sub)
+}
+
+func transactionValues(q cardanowallet.TransactionQuery) url.Values {
+	v := url.Values{}
+	if !q.Start.IsZero() {
+		v.Set("start", q.Start.UTC().Format(time.RFC3339))
+	}
+	if !q.End.IsZero() {
+		v.Set("end", q.End.UTC().Format(time.RFC3339))
+	}
+	if q.Order != "" {
+		v.Set("order", q.Order)
+	}
+	return v
+}
+
+func paymentValues(f client.PaymentFilter) url.Values {
+	v := url.Values{}
+	if f.ChannelID != (channel.ID{}) {
+		v.Set("channel", hex.EncodeToString(f.ChannelID[:]))
+	}
+	if f.Direction != "" {
+		v.Set("direction", string(f.Direction))
+	}
+	if !f.Start.IsZero() {
+		v.Set("start", f.Start.UTC().Format(time.RFC3339Nano))
+	}
+	if !f.End.IsZero() {
+		v.Set("end", f.End.UTC().Format(time.RFC3339Nano))
+	}
+	return v
+}
+
+// do issues a request to the given API path with req as JSON body, if not
+// nil, and decodes the JSON response into v. Error responses are returned as
+// *Error.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, req, v interface{}) error {
+	u := c.baseURL + strings.TrimSuffix(path, "/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var body io.Reader
+	if req != nil {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	hreq, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	hreq.Header.Set("Accept", "application/json")
+	if req != nil {
+		hreq.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient.Do(hreq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading API response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var er ErrorResponse
+		if err := json.Unmarshal(data, &er); err != nil || er.Error == "" {
+			er = ErrorResponse{Error: fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))}
+		}
+		return &Error{StatusCode: resp.StatusCode, Message: er.Error, Reason: er.Reason}
+	}
+	if v == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decoding API response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/wire"
+	"perun.network/perun-cardano-demo/api"
+	"perun.network/perun-cardano-demo/cardanowallet"
+	"perun.network/perun-cardano-demo/client"
+	"perun.network/perun-cardano-demo/client/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestClient(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	alice := s.NewClient(t, test.Alice, bus, client.WithRequestPolicy(client.AskUserRequests(0)))
+	// Bob accepts unequal deposits of up to 10 Ada.
+	bob := s.NewClient(t, test.Bob, bus, client.WithProposalPolicy(client.FundingLimits{MaxOwnDeposit: (10 * client.Ada).Lovelace()}))
+	srv := httptest.NewServer(api.NewServer([]*client.PaymentClient{alice, bob}, nil))
+	defer srv.Close()
+
+	c, err := api.NewClient(srv.URL)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clients, err := c.Clients(ctx)
+	require.NoError(t, err)
+	require.Len(t, clients, 2)
+	require.Equal(t, test.Alice.Name, clients[0].Name)
+	require.Equal(t, test.Bob.Name, clients[1].Name)
+
+	// Open a channel with asymmetric deposits and pay in it.
+	peerDeposit := 5 * client.Ada
+	ch, err := c.OpenChannel(ctx, test.Alice.Name, api.OpenChannelRequest{
+		Peer:              test.Bob.Name,
+		Amount:            10 * client.Ada,
+		PeerAmount:        &peerDeposit,
+		ChallengeDuration: 60,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"10000000", "5000000"}, ch.Balances)
+
+	ch, err = c.SendPayment(ctx, test.Alice.Name, ch.ID, api.PaymentRequest{Amount: 2 * client.Ada, Memo: "rent"})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, ch.Version)
+	require.Equal(t, []string{"8000000", "7000000"}, ch.Balances)
+
+	payments, err := c.Payments(ctx, test.Alice.Name, client.PaymentFilter{Direction: client.PaymentSent})
+	require.NoError(t, err)
+	require.Len(t, payments, 1)
+	require.Equal(t, 2*client.Ada, payments[0].Amount)
+	require.Equal(t, "rent", payments[0].Memo)
+	payments, err = c.Payments(ctx, test.Alice.Name, client.PaymentFilter{Direction: client.PaymentReceived})
+	require.NoError(t, err)
+	require.Empty(t, payments)
+
+	// Bob invoices Alice, who pays the invoice.
+	inv, err := c.CreateInvoice(ctx, test.Bob.Name, api.CreateInvoiceRequest{Amount: client.Ada, Description: "order 42", Expiry: 3600})
+	require.NoError(t, err)
+	require.Equal(t, "open", inv.Status)
+	require.NotNil(t, inv.Expires)
+	ch, err = c.SendPayment(ctx, test.Alice.Name, ch.ID, api.PaymentRequest{Amount: client.Ada, Invoice: inv.ID})
+	require.NoError(t, err)
+	require.Equal(t, []string{"7000000", "8000000"}, ch.Balances)
+	require.Eventually(t, func() bool {
+		inv, err := c.Invoice(ctx, test.Bob.Name, inv.ID)
+		return err == nil && inv.Status == "paid"
+	}, 5*time.Second, 10*time.Millisecond)
+	invs, err := c.Invoices(ctx, test.Bob.Name)
+	require.NoError(t, err)
+	require.Len(t, invs, 1)
+	require.Equal(t, ch.ID, invs[0].ChannelID)
+	require.EqualValues(t, 2, invs[0].Version)
+	require.Equal(t, clients[0].Address, invs[0].Payer)
+
+	// Bob requests a payment, which Alice approves.
+	paid := make(chan error, 1)
+	go func() {
+		inv, err := c.RequestPayment(ctx, test.Bob.Name, ch.ID, api.RequestPaymentRequest{Amount: client.Ada, Description: "minute 1"})
+		if err == nil && inv.Status != "paid" {
+			err = fmt.Errorf("invoice %s", inv.Status)
+		}
+		paid <- err
+	}()
+	var reqs []api.PendingRequestInfo
+	require.Eventually(t, func() bool {
+		reqs, err = c.PendingRequests(ctx, test.Alice.Name)
+		return err == nil && len(reqs) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, ch.ID, reqs[0].ChannelID)
+	require.Equal(t, clients[1].Address, reqs[0].Peer)
+	require.EqualValues(t, 1_000_000, reqs[0].Lovelace)
+	require.Equal(t, "minute 1", reqs[0].Description)
+	require.NoError(t, c.DecideRequest(ctx, test.Alice.Name, reqs[0].ID, api.DecisionRequest{Accept: true}))
+	require.NoError(t, <-paid)
+	ch, err = c.Channel(ctx, test.Alice.Name, ch.ID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"6000000", "9000000"}, ch.Balances)
+
+	// Alice streams two payments to Bob.
+	stream, err := c.StartStream(ctx, test.Alice.Name, ch.ID, api.StartStreamRequest{Rate: client.Ada / 10, IntervalMS: 200, Cap: client.Ada / 5})
+	require.NoError(t, err)
+	require.Equal(t, "running", stream.State)
+	_, err = c.StartStream(ctx, test.Alice.Name, ch.ID, api.StartStreamRequest{Rate: client.Ada, IntervalMS: 200})
+	var apiErr *api.Error
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusConflict, apiErr.StatusCode)
+	require.Eventually(t, func() bool {
+		stream, err = c.Stream(ctx, test.Alice.Name, ch.ID)
+		return err == nil && stream.State != "running"
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "cap_reached", stream.State)
+	require.EqualValues(t, 200_000, stream.Lovelace)
+	stream, err = c.StopStream(ctx, test.Alice.Name, ch.ID)
+	require.NoError(t, err)
+	require.Equal(t, "cap_reached", stream.State)
+	ch, err = c.Channel(ctx, test.Alice.Name, ch.ID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"5800000", "9200000"}, ch.Balances)
+
+	// Alice sends a conditional batch, which fails for a stale version.
+	batch := api.BatchRequest{
+		Transfers: []api.TransferRequest{{Amount: client.Ada / 2, Memo: "tea"}, {Amount: client.Ada / 2}},
+		Expect:    &api.ExpectationRequest{Version: ch.Version - 1, OwnBalance: 5_800_000, PeerBalance: 9_200_000},
+	}
+	_, err = c.SendBatch(ctx, test.Alice.Name, ch.ID, batch)
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusConflict, apiErr.StatusCode)
+	batch.Expect.Version = ch.Version
+	ch, err = c.SendBatch(ctx, test.Alice.Name, ch.ID, batch)
+	require.NoError(t, err)
+	require.Equal(t, batch.Expect.Version+1, ch.Version)
+	require.Equal(t, []string{"4800000", "10200000"}, ch.Balances)
+
+	chs, err := c.Channels(ctx, test.Alice.Name)
+	require.NoError(t, err)
+	require.Equal(t, []api.ChannelInfo{ch}, chs)
+
+	bal, err := c.Balance(ctx, test.Alice.Name)
+	require.NoError(t, err)
+	require.EqualValues(t, test.DefaultBalance-10_000_000, bal.Lovelace)
+
+	txs, err := c.Transactions(ctx, test.Alice.Name, cardanowallet.TransactionQuery{Order: cardanowallet.OrderDescending})
+	require.NoError(t, err)
+	require.NotEmpty(t, txs)
+
+	// Errors carry the status code of the response.
+	_, err = c.SendPayment(ctx, test.Alice.Name, ch.ID, api.PaymentRequest{Amount: 100 * client.Ada})
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+	_, err = c.Balance(ctx, "Carol")
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	_, err = c.Invoice(ctx, test.Bob.Name, "unknown")
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	err = c.DecideRequest(ctx, test.Alice.Name, "unknown", api.DecisionRequest{})
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	_, err = c.StopStream(ctx, test.Bob.Name, ch.ID)
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+
+	ch, err = c.Settle(ctx, test.Alice.Name, ch.ID)
+	require.NoError(t, err)
+	require.True(t, ch.IsFinal)
+	chs, err = c.Channels(ctx, test.Alice.Name)
+	require.NoError(t, err)
+	require.Empty(t, chs)
+}
+
+func TestNewClient(t *testing.T) {
+	for _, u := range []string{"127.0.0.1:8080", "ftp://localhost", "http://%zz"} {
+		_, err := api.NewClient(u)
+		require.Error(t, err, u)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"perun.network/go-perun/channel"
+	"perun.network/perun-cardano-demo/client"
+)
+
+// eventBuffer is the number of events buffered per subscriber. Events are
+// dropped for subscribers that do not keep up.
+const eventBuffer = 64
+
+// event is a server-sent event.
+type event struct {
+	Type string      // Type is "state", "balance", "error", "proposal", "rejection", "channel_event", "force_close", "invoice", "payment_request" or "stream".
+	Data interface{} // Data is a ChannelInfo, BalanceInfo, ErrorResponse, ProposalInfo, RejectionInfo, ChannelEventInfo, ForceCloseInfo, InvoiceInfo, PendingRequestInfo or StreamInfo.
+}
+
+// eventObserver forwards client notifications to a server-sent event stream.
+type eventObserver struct {
+	id     uuid.UUID
+	events chan event
+	log    logrus.FieldLogger
+}
+
+var (
+	_ client.DataObserver         = (*eventObserver)(nil)
+	_ client.ProposalObserver     = (*eventObserver)(nil)
+	_ client.RejectionObserver    = (*eventObserver)(nil)
+	_ client.ChannelEventObserver = (*eventObserver)(nil)
+	_ client.ForceCloseObserver   = (*eventObserver)(nil)
+	_ client.InvoiceObserver      = (*eventObserver)(nil)
+	_ client.RequestObserver      = (*eventObserver)(nil)
+	_ client.StreamObserver       = (*eventObserver)(nil)
+)
+
+func newEventObserver(log logrus.FieldLogger) *eventObserver {
+	id := uuid.New()
+	return &eventObserver{
+		id:     id,
+		events: make(chan event, eventBuffer),
+		log:    log.WithField("subscriber", id.String()),
+	}
+}
+
+func (o *eventObserver) GetID() uuid.UUID {
+	return o.id
+}
+
+// UpdateState ignores the text representation, see UpdateChannel.
+func (o *eventObserver) UpdateState(string) {}
+
+// UpdateBalance ignores the text representation, see UpdateLovelaceBalance.
+func (o *eventObserver) UpdateBalance(string) {}
+
+func (o *eventObserver) UpdateChannel(ch *client.PaymentChannel, state *channel.State) {
+	o.push(event{Type: "state", Data: makeChannelInfo(ch, state)})
+}
+
+func (o *eventObserver) UpdateLovelaceBalance(bal int64) {
+	o.push(event{Type: "balance", Data: makeBalanceInfo(bal)})
+}
+
+func (o *eventObserver) UpdateError(err error) {
+	o.push(event{Type: "error", Data: makeErrorResponse(err)})
+}
+
+func (o *eventObserver) ProposalPending(p *client.PendingProposal) {
+	o.push(event{Type: "proposal", Data: makeProposalInfo(p)})
+}
+
+func (o *eventObserver) UpdateRejection(r *client.Rejection) {
+	o.push(event{Type: "rejection", Data: makeRejectionInfo(r)})
+}
+
+func (o *eventObserver) UpdateChannelEvent(e client.ChannelEvent) {
+	o.push(event{Type: "channel_event", Data: makeChannelEventInfo(e)})
+}
+
+func (o *eventObserver) UpdateForceClose(p client.ForceCloseProgress) {
+	o.push(event{Type: "force_close", Data: makeForceCloseInfo(p)})
+}
+
+func (o *eventObserver) UpdateInvoice(inv client.Invoice) {
+	o.push(event{Type: "invoice", Data: makeInvoiceInfo(inv)})
+}
+
+func (o *eventObserver) PaymentRequestPending(r *client.PendingRequest) {
+	o.push(event{Type: "payment_request", Data: makePendingRequestInfo(r)})
+}
+
+func (o *eventObserver) UpdateStream(s client.StreamStatus) {
+	o.push(event{Type: "stream", Data: makeStreamInfo(s)})
+}
+
+// push enqueues e without blocking the notifying client.
+func (o *eventObserver) push(e event) {
+	select {
+	case o.events <- e:
+	default:
+		o.log.Warnf("Dropping %s event for slow subscriber", e.Type)
+	}
+}
+
+// serveEvents streams the notifications of c as server-sent events until the
+// request is canceled.
+func serveEvents(w http.ResponseWriter, r *http.Request, c *client.PaymentClient) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	o := newEventObserver(c.Log())
+	c.Register(o)
+	defer c.Deregister(o)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-o.events:
+			data, err := json.Marshal(e.Data)
+			if err != nil {
+				o.log.WithError(err).Errorf("Encoding %s event failed", e.Type)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
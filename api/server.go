@@ -0,0 +1,682 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package api implements a headless HTTP JSON API for payment clients.
+//
+// All routes are relative to /v1:
+//
+//	GET  /clients                         list hosted clients
+//	GET  /clients/{name}                  client info
+//	GET  /clients/{name}/balance          on-chain balance (token: native token balance)
+//	GET  /clients/{name}/wallet                     wallet balances, native assets and sync state
+//	GET  /clients/{name}/wallet/utxos               UTxO statistics of the wallet
+//	GET  /clients/{name}/wallet/transactions        transaction history (start, end, order)
+//	GET  /clients/{name}/network                    sync progress and tips of the wallet's node
+//	GET  /clients/{name}/channels                   list open channels
+//	POST /clients/{name}/channels                   open a channel (OpenChannelRequest)
+//	GET  /clients/{name}/channels/{id}              state of a channel
+//	GET  /clients/{name}/channels/{id}/payments     recorded payments of a channel, also after it is closed
+//	POST /clients/{name}/channels/{id}/payments     send a payment (PaymentRequest)
+//	POST /clients/{name}/channels/{id}/batch        send several transfers, and optionally finalize, in one update (BatchRequest)
+//	POST /clients/{name}/channels/{id}/requests     request a payment from the peer and wait for it (RequestPaymentRequest)
+//	GET  /clients/{name}/channels/{id}/stream       status of the current or last payment stream
+//	POST /clients/{name}/channels/{id}/stream       start a payment stream (StartStreamRequest)
+//	POST /clients/{name}/channels/{id}/stream/stop  stop the payment stream
+//	POST /clients/{name}/channels/{id}/settle       settle a channel
+//	POST /clients/{name}/channels/{id}/force-close  close a channel on-chain without the peer
+//	GET  /clients/{name}/channels/{id}/events       on-chain events of a channel, also after it is closed
+//	GET  /clients/{name}/payments                   recorded payments (channel, direction, start, end, format)
+//	GET  /clients/{name}/invoices                   list invoices
+//	POST /clients/{name}/invoices                   create an invoice (CreateInvoiceRequest)
+//	GET  /clients/{name}/invoices/{id}              an invoice and whether it is paid
+//	GET  /clients/{name}/proposals                  proposals awaiting a decision
+//	POST /clients/{name}/proposals/{id}             accept or reject a proposal (DecisionRequest)
+//	GET  /clients/{name}/requests                   payment requests of peers awaiting a decision
+//	POST /clients/{name}/requests/{id}              pay or decline a payment request (DecisionRequest)
+//	GET  /clients/{name}/events                     server-sent state, balance, error, proposal, rejection, channel, force-close, invoice, payment request and stream events
+//
+// Channel IDs are hex-encoded. Payments are encoded as client.Payment, or as
+// CSV if the format parameter is "csv".
+//
+// Failed operations are answered with an ErrorResponse and a status code that
+// reflects the kind of the error.
+//
+// The API is not authenticated: anyone who can reach it can open channels and
+// send payments on behalf of the hosted clients. It must therefore only be
+// served on a loopback address, which ListenAndServe enforces.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wire"
+	"perun.network/perun-cardano-demo/cardanowallet"
+	"perun.network/perun-cardano-demo/client"
+	"perun.network/perun-cardano-demo/config"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// Server serves the HTTP API for a set of payment clients.
+type Server struct {
+	clients map[string]*client.PaymentClient
+	order   []string
+	// peers resolves peer names to off-chain addresses.
+	peers map[string]wire.Address
+}
+
+// NewServer creates a server for the given clients. Channels can be opened
+// with any of the clients and with the given named peers.
+func NewServer(clients []*client.PaymentClient, peers map[string]wire.Address) *Server {
+	s := &Server{
+		clients: make(map[string]*client.PaymentClient),
+		peers:   make(map[string]wire.Address),
+	}
+	for _, c := range clients {
+		s.clients[c.Name] = c
+		s.order = append(s.order, c.Name)
+		s.peers[c.Name] = c.WireAddress()
+	}
+	for name, addr := range peers {
+		s.peers[name] = addr
+	}
+	return s
+}
+
+// ListenAndServe serves the API on addr until ctx is done. The host of addr
+// must be a loopback address.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	if err := config.CheckLoopback(addr); err != nil {
+		return fmt.Errorf("refusing to serve the API on %s: %w", addr, err)
+	}
+	srv := &http.Server{Addr: addr, Handler: s}
+	errs := make(chan error, 1)
+	go func() { errs <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1"), "/")
+	parts := strings.Split(path, "/")
+	if parts[0] != "clients" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if len(parts) == 1 {
+		s.route(w, r, http.MethodGet, s.listClients)
+		return
+	}
+
+	c, ok := s.clients[parts[1]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown client: "+parts[1])
+		return
+	}
+	if len(parts) > 3 && parts[2] == "channels" {
+		s.routeChannel(w, r, c, parts[3], strings.Join(parts[4:], "/"))
+		return
+	}
+	if len(parts) == 4 && parts[2] == "proposals" {
+		s.route(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			s.decideProposal(w, r, c, parts[3])
+		})
+		return
+	}
+	if len(parts) == 4 && parts[2] == "requests" {
+		s.route(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			s.decideRequest(w, r, c, parts[3])
+		})
+		return
+	}
+	if len(parts) == 4 && parts[2] == "invoices" {
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			s.getInvoice(w, c, parts[3])
+		})
+		return
+	}
+	switch strings.Join(parts[2:], "/") {
+	case "":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, makeClientInfo(c))
+		})
+	case "balance":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			if token := r.URL.Query().Get("token"); token != "" {
+				s.tokenBalance(w, r, c, token)
+				return
+			}
+			writeJSON(w, http.StatusOK, makeBalanceInfo(c.GetBalance()))
+		})
+	case "wallet":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			writeWalletResult(w)(c.WalletInfo(r.Context()))
+		})
+	case "wallet/utxos":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			writeWalletResult(w)(c.UTxOStatistics(r.Context()))
+		})
+	case "wallet/transactions":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			s.listTransactions(w, r, c)
+		})
+	case "network":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			writeWalletResult(w)(c.NetworkInformation(r.Context()))
+		})
+	case "channels":
+		if r.Method == http.MethodPost {
+			s.openChannel(w, r, c)
+			return
+		}
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			s.listChannels(w, c)
+		})
+	case "payments":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			s.listPayments(w, r, c, nil)
+		})
+	case "invoices":
+		if r.Method == http.MethodPost {
+			s.createInvoice(w, r, c)
+			return
+		}
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			s.listInvoices(w, c)
+		})
+	case "proposals":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			s.listProposals(w, c)
+		})
+	case "requests":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			s.listRequests(w, c)
+		})
+	case "events":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			serveEvents(w, r, c)
+		})
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// routeChannel routes requests below /clients/{name}/channels/{id}.
+func (s *Server) routeChannel(w http.ResponseWriter, r *http.Request, c *client.PaymentClient, rawID, sub string) {
+	id, err := client.ParseChannelID(rawID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if sub == "events" {
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			listChannelEvents(w, c, id)
+		})
+		return
+	}
+	if sub == "payments" && r.Method == http.MethodGet {
+		s.listPayments(w, r, c, &id)
+		return
+	}
+	ch, err := c.Channel(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	switch sub {
+	case "":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, makeChannelInfo(ch, ch.State()))
+		})
+	case "payments":
+		s.route(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			s.sendPayment(w, r, c, ch)
+		})
+	case "batch":
+		s.route(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			s.sendBatch(w, r, c, ch)
+		})
+	case "requests":
+		s.route(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			s.requestPayment(w, r, c, ch)
+		})
+	case "stream":
+		if r.Method == http.MethodPost {
+			s.startStream(w, r, c, ch)
+			return
+		}
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			st, ok := ch.Stream()
+			if !ok {
+				writeOpError(w, &client.OpError{Op: "get stream", Kind: client.ErrNoStream, Err: client.ErrNoStream})
+				return
+			}
+			writeJSON(w, http.StatusOK, makeStreamInfo(st))
+		})
+	case "stream/stop":
+		s.route(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			st, err := ch.StopStream()
+			if err != nil {
+				writeOpError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, makeStreamInfo(st))
+		})
+	case "settle":
+		s.route(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			s.settle(w, r, c, ch)
+		})
+	case "force-close":
+		s.route(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			s.forceClose(w, r, c, ch)
+		})
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request, method string, h http.HandlerFunc) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	h(w, r)
+}
+
+func (s *Server) listClients(w http.ResponseWriter, _ *http.Request) {
+	infos := make([]ClientInfo, len(s.order))
+	for i, name := range s.order {
+		infos[i] = makeClientInfo(s.clients[name])
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (s *Server) listChannels(w http.ResponseWriter, c *client.PaymentClient) {
+	chs := c.Channels()
+	infos := make([]ChannelInfo, len(chs))
+	for i, ch := range chs {
+		infos[i] = makeChannelInfo(ch, ch.State())
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (s *Server) openChannel(w http.ResponseWriter, r *http.Request, c *client.PaymentClient) {
+	var req OpenChannelRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	peer, err := s.resolvePeer(req.Peer)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var opts []client.OpenOption
+	if req.PeerAmount != nil {
+		opts = append(opts, client.WithPeerDeposit(*req.PeerAmount))
+	}
+	if req.ChallengeDuration != 0 {
+		opts = append(opts, client.WithChallengeDuration(req.ChallengeDuration))
+	}
+	ch, err := c.OpenChannel(r.Context(), peer, req.Amount, opts...)
+	if err != nil {
+		writeOpError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, makeChannelInfo(ch, ch.State()))
+}
+
+func (s *Server) sendPayment(w http.ResponseWriter, r *http.Request, c *client.PaymentClient, ch *client.PaymentChannel) {
+	var req PaymentRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	opts := []client.PaymentOption{client.WithMemo(req.Memo)}
+	if req.Invoice != "" {
+		opts = append(opts, client.WithInvoice(req.Invoice))
+	}
+	if err := c.SendPayment(r.Context(), ch.ID(), req.Amount, opts...); err != nil {
+		writeOpError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, makeChannelInfo(ch, ch.State()))
+}
+
+func (s *Server) sendBatch(w http.ResponseWriter, r *http.Request, c *client.PaymentClient, ch *client.PaymentChannel) {
+	var req BatchRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := c.SendBatch(r.Context(), ch.ID(), makeBatch(req)); err != nil {
+		writeOpError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, makeChannelInfo(ch, ch.State()))
+}
+
+// requestPayment replies once the peer paid the request, with the paid
+// invoice.
+func (s *Server) requestPayment(w http.ResponseWriter, r *http.Request, c *client.PaymentClient, ch *client.PaymentChannel) {
+	var req RequestPaymentRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	inv, err := c.RequestPayment(r.Context(), ch.ID(), req.Amount, req.Description)
+	if err != nil {
+		writeOpError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, makeInvoiceInfo(inv))
+}
+
+func (s *Server) startStream(w http.ResponseWriter, r *http.Request, c *client.PaymentClient, ch *client.PaymentChannel) {
+	var req StartStreamRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := c.StartStream(ch.ID(), req.Rate, time.Duration(req.IntervalMS)*time.Millisecond, req.Cap); err != nil {
+		writeOpError(w, err)
+		return
+	}
+	st, _ := ch.Stream()
+	writeJSON(w, http.StatusCreated, makeStreamInfo(st))
+}
+
+func (s *Server) settle(w http.ResponseWriter, r *http.Request, c *client.PaymentClient, ch *client.PaymentChannel) {
+	if err := c.SettleChannel(r.Context(), ch.ID()); err != nil {
+		writeOpError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, makeChannelInfo(ch, ch.State()))
+}
+
+// forceClose replies once the channel is closed, which takes at least its
+// challenge duration.
+func (s *Server) forceClose(w http.ResponseWriter, r *http.Request, c *client.PaymentClient, ch *client.PaymentChannel) {
+	if err := c.ForceClose(r.Context(), ch.ID()); err != nil {
+		writeOpError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, makeChannelInfo(ch, ch.State()))
+}
+
+func (s *Server) createInvoice(w http.ResponseWriter, r *http.Request, c *client.PaymentClient) {
+	var req CreateInvoiceRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	inv, err := c.CreateInvoice(req.Amount, req.Description, time.Duration(req.Expiry)*time.Second)
+	if err != nil {
+		writeOpError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, makeInvoiceInfo(inv))
+}
+
+func (s *Server) listInvoices(w http.ResponseWriter, c *client.PaymentClient) {
+	invs := c.Invoices()
+	infos := make([]InvoiceInfo, len(invs))
+	for i, inv := range invs {
+		infos[i] = makeInvoiceInfo(inv)
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (s *Server) getInvoice(w http.ResponseWriter, c *client.PaymentClient, id string) {
+	inv, err := c.Invoice(id)
+	if err != nil {
+		writeOpError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, makeInvoiceInfo(inv))
+}
+
+func (s *Server) listProposals(w http.ResponseWriter, c *client.PaymentClient) {
+	pps := c.PendingProposals()
+	infos := make([]ProposalInfo, len(pps))
+	for i, pp := range pps {
+		infos[i] = makeProposalInfo(pp)
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (s *Server) listRequests(w http.ResponseWriter, c *client.PaymentClient) {
+	prs := c.PendingRequests()
+	infos := make([]PendingRequestInfo, len(prs))
+	for i, pr := range prs {
+		infos[i] = makePendingRequestInfo(pr)
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (s *Server) tokenBalance(w http.ResponseWriter, r *http.Request, c *client.PaymentClient, rawToken string) {
+	token, err := client.ParseToken(rawToken)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	bal, err := c.TokenBalance(r.Context(), token)
+	if err != nil {
+		writeOpError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, TokenBalanceInfo{Token: token.String(), Name: token.Name(), Quantity: bal})
+}
+
+func (s *Server) listTransactions(w http.ResponseWriter, r *http.Request, c *client.PaymentClient) {
+	var q cardanowallet.TransactionQuery
+	params := r.URL.Query()
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"start", &q.Start}, {"end", &q.End}} {
+		if v := params.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid "+p.name+": "+err.Error())
+				return
+			}
+			*p.dst = t
+		}
+	}
+	switch q.Order = params.Get("order"); q.Order {
+	case "", cardanowallet.OrderAscending, cardanowallet.OrderDescending:
+	default:
+		writeError(w, http.StatusBadRequest, "invalid order: "+q.Order)
+		return
+	}
+	writeWalletResult(w)(c.Transactions(r.Context(), q))
+}
+
+// listPayments writes the recorded payments of c that match the query
+// parameters. If id is not nil, only the payments of that channel are
+// listed.
+func (s *Server) listPayments(w http.ResponseWriter, r *http.Request, c *client.PaymentClient, id *channel.ID) {
+	var f client.PaymentFilter
+	params := r.URL.Query()
+	if id != nil {
+		f.ChannelID = *id
+	} else if v := params.Get("channel"); v != "" {
+		chID, err := client.ParseChannelID(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid channel: "+err.Error())
+			return
+		}
+		f.ChannelID = chID
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"start", &f.Start}, {"end", &f.End}} {
+		if v := params.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid "+p.name+": "+err.Error())
+				return
+			}
+			*p.dst = t
+		}
+	}
+	switch f.Direction = client.PaymentDirection(params.Get("direction")); f.Direction {
+	case "", client.PaymentSent, client.PaymentReceived:
+	default:
+		writeError(w, http.StatusBadRequest, "invalid direction: "+string(f.Direction))
+		return
+	}
+
+	payments := c.Payments(f)
+	switch format := params.Get("format"); format {
+	case "", "json":
+		if payments == nil {
+			payments = []client.Payment{}
+		}
+		writeJSON(w, http.StatusOK, payments)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.WriteHeader(http.StatusOK)
+		if err := client.WritePaymentsCSV(w, payments); err != nil {
+			logrus.WithError(err).Warn("Writing response failed")
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "invalid format: "+format)
+	}
+}
+
+// writeWalletResult returns a function that writes the result of a wallet
+// query, which is passed through as reported by cardano-wallet.
+func writeWalletResult(w http.ResponseWriter) func(interface{}, error) {
+	return func(v interface{}, err error) {
+		if err != nil {
+			writeOpError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	}
+}
+
+func (s *Server) decideProposal(w http.ResponseWriter, r *http.Request, c *client.PaymentClient, id string) {
+	var req DecisionRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := c.DecideProposal(id, req.Accept, req.Reason); err != nil {
+		writeOpError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) decideRequest(w http.ResponseWriter, r *http.Request, c *client.PaymentClient, id string) {
+	var req DecisionRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := c.DecideRequest(id, req.Accept, req.Reason); err != nil {
+		writeOpError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listChannelEvents writes the recorded on-chain events of the channel with
+// the given ID.
+func listChannelEvents(w http.ResponseWriter, c *client.PaymentClient, id channel.ID) {
+	events := c.ChannelEvents(id)
+	infos := make([]ChannelEventInfo, len(events))
+	for i, e := range events {
+		infos[i] = makeChannelEventInfo(e)
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// resolvePeer resolves a peer name or hex-encoded public key to a wire
+// address.
+func (s *Server) resolvePeer(peer string) (wire.Address, error) {
+	if addr, ok := s.peers[peer]; ok {
+		return addr, nil
+	}
+	addr, err := client.WireAddressFromPubKey(peer)
+	if err != nil {
+		return nil, fmt.Errorf("unknown peer %q", peer)
+	}
+	return addr, nil
+}
+
+// writeOpError writes err with a status code that reflects its kind.
+func writeOpError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, client.ErrUnknownProposal), errors.Is(err, client.ErrUnknownInvoice), errors.Is(err, client.ErrUnknownRequest),
+		errors.Is(err, client.ErrNoStream):
+		status = http.StatusNotFound
+	case errors.Is(err, client.ErrInvalidAmount), errors.Is(err, client.ErrInvalidParams):
+		status = http.StatusBadRequest
+	case errors.Is(err, client.ErrNoChannel), errors.Is(err, client.ErrPeerRejected), errors.Is(err, client.ErrSettling),
+		errors.Is(err, client.ErrStreamRunning), errors.Is(err, client.ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, client.ErrInsufficientBalance):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, client.ErrPABUnavailable), errors.Is(err, client.ErrShuttingDown):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, client.ErrWalletUnavailable):
+		status = http.StatusBadGateway
+	case cardanowallet.IsCode(err, cardanowallet.CodeNoSuchWallet):
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, makeErrorResponse(err))
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.WithError(err).Warn("Writing response failed")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, ErrorResponse{Error: msg})
+}
@@ -0,0 +1,179 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/wire"
+	"perun.network/perun-cardano-demo/api"
+	"perun.network/perun-cardano-demo/client"
+	"perun.network/perun-cardano-demo/client/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestServer(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	alice := s.NewClient(t, test.Alice, bus)
+	bob := s.NewClient(t, test.Bob, bus)
+	srv := httptest.NewServer(api.NewServer([]*client.PaymentClient{alice, bob}, nil))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	do := func(method, path string, body interface{}, v interface{}) int {
+		var buf bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+		req, err := http.NewRequestWithContext(ctx, method, srv.URL+path, &buf)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		if v != nil {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+
+	var clients []api.ClientInfo
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/v1/clients", nil, &clients))
+	require.Len(t, clients, 2)
+	require.Equal(t, test.Alice.Name, clients[0].Name)
+
+	var info api.ClientInfo
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/v1/clients/Bob", nil, &info))
+	require.Equal(t, test.Bob.Name, info.Name)
+	require.False(t, info.HasOpenChannel)
+
+	// Subscribe to Bob's events before Alice opens a channel and pays.
+	events := subscribe(ctx, t, srv.URL+"/v1/clients/Bob/events")
+
+	var ch api.ChannelInfo
+	require.Equal(t, http.StatusCreated, do(http.MethodPost, "/v1/clients/Alice/channels",
+		api.OpenChannelRequest{Peer: test.Bob.Name, Amount: 10 * client.Ada}, &ch))
+	require.Equal(t, []string{"10000000", "10000000"}, ch.Balances)
+
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/v1/clients/Alice/channels/"+ch.ID+"/payments",
+		api.PaymentRequest{Amount: client.Ada}, &ch))
+	require.EqualValues(t, 1, ch.Version)
+
+	// Bob is notified about the payment.
+	var update api.ChannelInfo
+	for update.Version != 1 {
+		select {
+		case e := <-events:
+			if e.typ == "state" {
+				require.NoError(t, json.Unmarshal([]byte(e.data), &update))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no state event")
+		}
+	}
+	require.Equal(t, ch.ID, update.ID)
+	require.Equal(t, []string{"9000000", "11000000"}, update.Balances)
+
+	var channels []api.ChannelInfo
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/v1/clients/Bob/channels", nil, &channels))
+	require.Len(t, channels, 1)
+	require.Equal(t, ch.ID, channels[0].ID)
+
+	// Failed requests are answered with an ErrorResponse.
+	var errResp api.ErrorResponse
+	require.Equal(t, http.StatusUnprocessableEntity, do(http.MethodPost, "/v1/clients/Alice/channels/"+ch.ID+"/payments",
+		api.PaymentRequest{Amount: 100 * client.Ada}, &errResp))
+	require.NotEmpty(t, errResp.Error)
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, "/v1/nothing", http.StatusNotFound},
+		{http.MethodGet, "/v1/clients/Mallory", http.StatusNotFound},
+		{http.MethodGet, "/v1/clients/Alice/channels/" + strings.Repeat("00", 32), http.StatusNotFound},
+		{http.MethodGet, "/v1/clients/Alice/channels/nohex", http.StatusBadRequest},
+		{http.MethodPost, "/v1/clients", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/v1/clients/Alice/channels/" + ch.ID, http.StatusMethodNotAllowed},
+	} {
+		errResp = api.ErrorResponse{}
+		require.Equal(t, tc.status, do(tc.method, tc.path, nil, &errResp), tc.path)
+		require.NotEmpty(t, errResp.Error, tc.path)
+	}
+
+	var settled api.ChannelInfo
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/v1/clients/Alice/channels/"+ch.ID+"/settle", nil, &settled))
+	require.True(t, settled.IsFinal)
+}
+
+func TestListenAndServeLoopback(t *testing.T) {
+	srv := api.NewServer(nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.Error(t, srv.ListenAndServe(ctx, "0.0.0.0:0"))
+	require.Error(t, srv.ListenAndServe(ctx, "example.com:0"))
+
+	errs := make(chan error, 1)
+	go func() { errs <- srv.ListenAndServe(ctx, "127.0.0.1:0") }()
+	cancel()
+	require.NoError(t, <-errs)
+}
+
+// sse is a server-sent event.
+type sse struct {
+	typ, data string
+}
+
+// subscribe subscribes to the server-sent events at url until ctx is done.
+func subscribe(ctx context.Context, t *testing.T, url string) <-chan sse {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan sse, 64)
+	go func() {
+		defer resp.Body.Close()
+		var e sse
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				e.typ = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				e.data = strings.TrimPrefix(line, "data: ")
+			case line == "":
+				events <- e
+				e = sse{}
+			}
+		}
+	}()
+	return events
+}
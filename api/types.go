@@ -0,0 +1,418 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/hex"
+	"time"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wallet"
+	"perun.network/perun-cardano-backend/wallet/address"
+	"perun.network/perun-cardano-demo/client"
+)
+
+// ClientInfo describes a payment client hosted by the daemon.
+type ClientInfo struct {
+	Name           string `json:"name"`
+	Address        string `json:"address"`    // Address is the hex-encoded payment identifier.
+	PublicKey      string `json:"public_key"` // PublicKey identifies the client as channel peer.
+	HasOpenChannel bool   `json:"has_open_channel"`
+	OpenChannels   int    `json:"open_channels"`
+}
+
+// BalanceInfo is the on-chain balance of a client.
+type BalanceInfo struct {
+	Lovelace int64  `json:"lovelace"`
+	Ada      string `json:"ada"`
+}
+
+// TokenBalanceInfo is the on-chain balance of a native token.
+type TokenBalanceInfo struct {
+	Token    string `json:"token"` // Token is "<policy ID>.<asset name>" in hex.
+	Name     string `json:"name"`
+	Quantity uint64 `json:"quantity"`
+}
+
+// ChannelInfo is the state of a payment channel.
+type ChannelInfo struct {
+	ID       string   `json:"id"`
+	Idx      int      `json:"idx"`      // Idx is the index of the client in the channel.
+	Parties  []string `json:"parties"`  // Parties are the hex-encoded payment identifiers.
+	Balances []string `json:"balances"` // Balances are in Lovelace.
+	Version  uint64   `json:"version"`
+	IsFinal  bool     `json:"is_final"`
+	Phase    string   `json:"phase"` // Phase is "open", "disputed" or "concluded".
+}
+
+// OpenChannelRequest is the body of an open channel request.
+type OpenChannelRequest struct {
+	// Peer is the name of a known party or the hex-encoded public key of the
+	// peer.
+	Peer string `json:"peer"`
+	// Amount is our deposit. It is a decimal number in Ada or a string
+	// accepted by client.ParseAmount, e.g. "5 ADA".
+	Amount client.Amount `json:"amount"`
+	// PeerAmount is the deposit of the peer in the same format. If omitted,
+	// the peer deposits Amount as well. Peers only accept a different deposit
+	// if their proposal policy allows unequal funding.
+	PeerAmount *client.Amount `json:"peer_amount,omitempty"`
+	// ChallengeDuration is the challenge duration in seconds. If zero, the
+	// client default applies.
+	ChallengeDuration uint64 `json:"challenge_duration,omitempty"`
+}
+
+// PaymentRequest is the body of a payment request.
+type PaymentRequest struct {
+	// Amount is the amount to send. It is a decimal number in Ada or a string
+	// accepted by client.ParseAmount, e.g. "1000 lovelace".
+	Amount client.Amount `json:"amount"`
+	// Memo is recorded with the payment in the ledgers of the client and the
+	// peer.
+	Memo string `json:"memo,omitempty"`
+	// Invoice is the ID of the invoice of the peer paid by the payment.
+	Invoice string `json:"invoice,omitempty"`
+}
+
+// BatchRequest is the body of a request sending several transfers, and
+// optionally the finalization, in one channel update.
+type BatchRequest struct {
+	Transfers []TransferRequest `json:"transfers"`
+	// Finalize finalizes the channel in the same update.
+	Finalize bool `json:"finalize,omitempty"`
+	// Expect makes the batch conditional. It is only sent if the channel is
+	// still in the expected state, and fails with status 409 otherwise.
+	Expect *ExpectationRequest `json:"expect,omitempty"`
+}
+
+// TransferRequest is a transfer within a BatchRequest.
+type TransferRequest struct {
+	// Amount is the amount to send, see PaymentRequest.
+	Amount client.Amount `json:"amount"`
+	Memo   string        `json:"memo,omitempty"`
+}
+
+// ExpectationRequest is the expected channel state of a conditional batch.
+type ExpectationRequest struct {
+	Version     uint64        `json:"version"`
+	OwnBalance  client.Amount `json:"own_balance"`
+	PeerBalance client.Amount `json:"peer_balance"`
+}
+
+// CreateInvoiceRequest is the body of a request creating an invoice.
+type CreateInvoiceRequest struct {
+	// Amount is the amount to be paid, see PaymentRequest.
+	Amount      client.Amount `json:"amount"`
+	Description string        `json:"description,omitempty"`
+	// Expiry is the number of seconds after which the invoice expires. The
+	// invoice does not expire if it is zero.
+	Expiry uint64 `json:"expiry,omitempty"`
+}
+
+// RequestPaymentRequest is the body of a request asking the channel peer for
+// a payment.
+type RequestPaymentRequest struct {
+	// Amount is the requested amount, see PaymentRequest.
+	Amount client.Amount `json:"amount"`
+	// Description is recorded as the memo of the payment.
+	Description string `json:"description,omitempty"`
+}
+
+// InvoiceInfo is an invoice created by the client.
+type InvoiceInfo struct {
+	ID          string        `json:"id"`
+	Amount      client.Amount `json:"amount"` // Amount is in Ada.
+	Lovelace    int64         `json:"lovelace"`
+	Description string        `json:"description,omitempty"`
+	Status      string        `json:"status"` // Status is "open", "paid" or "expired".
+	Created     time.Time     `json:"created"`
+	Expires     *time.Time    `json:"expires,omitempty"`
+	// The following fields are set once the invoice is paid.
+	ChannelID string     `json:"channel_id,omitempty"`
+	Version   uint64     `json:"version,omitempty"`
+	Paid      *time.Time `json:"paid,omitempty"`
+	Payer     string     `json:"payer,omitempty"` // Payer is the hex-encoded payment identifier of the payer.
+}
+
+// ProposalInfo is a channel proposal awaiting a decision.
+type ProposalInfo struct {
+	ID                string    `json:"id"`
+	Peer              string    `json:"peer"`         // Peer is the hex-encoded payment identifier of the proposer.
+	PeerDeposit       string    `json:"peer_deposit"` // PeerDeposit is in Lovelace.
+	OwnDeposit        string    `json:"own_deposit"`  // OwnDeposit is in Lovelace.
+	ChallengeDuration uint64    `json:"challenge_duration"`
+	Received          time.Time `json:"received"`
+}
+
+// PendingRequestInfo is a payment request of a peer awaiting a decision.
+type PendingRequestInfo struct {
+	ID          string        `json:"id"` // ID is the ID of the peer's invoice.
+	ChannelID   string        `json:"channel_id"`
+	Peer        string        `json:"peer"`   // Peer is the hex-encoded payment identifier of the payee.
+	Amount      client.Amount `json:"amount"` // Amount is in Ada.
+	Lovelace    int64         `json:"lovelace"`
+	Description string        `json:"description,omitempty"`
+	Received    time.Time     `json:"received"`
+}
+
+// RejectionInfo describes a proposal or update rejected by the client.
+type RejectionInfo struct {
+	Item      string `json:"item"`                 // Item is "channel proposal", "channel update" or "payment request".
+	ChannelID string `json:"channel_id,omitempty"` // ChannelID is omitted for proposals.
+	Reason    string `json:"reason"`
+	Message   string `json:"message"`
+}
+
+// ChannelEventInfo describes an on-chain event of a channel.
+type ChannelEventInfo struct {
+	ChannelID string     `json:"channel_id"`
+	Kind      string     `json:"kind"` // Kind is "registered", "progressed" or "concluded".
+	Version   uint64     `json:"version"`
+	Latest    uint64     `json:"latest"` // Latest is our off-chain version when the event was handled.
+	Stale     bool       `json:"stale"`  // Stale is set if an outdated state was registered.
+	Timeout   *time.Time `json:"timeout,omitempty"`
+	Time      time.Time  `json:"time"`
+	Message   string     `json:"message"`
+}
+
+// ForceCloseInfo describes the progress of force-closing a channel.
+type ForceCloseInfo struct {
+	ChannelID string     `json:"channel_id"`
+	Stage     string     `json:"stage"` // Stage is "registering", "waiting", "withdrawing", "done" or "failed".
+	Timeout   *time.Time `json:"timeout,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Time      time.Time  `json:"time"`
+	Message   string     `json:"message"`
+}
+
+// StartStreamRequest is the body of a request starting a payment stream.
+type StartStreamRequest struct {
+	// Rate is the amount paid per interval, see PaymentRequest.
+	Rate client.Amount `json:"rate"`
+	// IntervalMS is the interval between two payments in milliseconds.
+	IntervalMS uint64 `json:"interval_ms"`
+	// Cap is the total amount of the stream. The stream is not limited if
+	// it is omitted.
+	Cap client.Amount `json:"cap,omitempty"`
+}
+
+// StreamInfo describes the progress of a payment stream.
+type StreamInfo struct {
+	ChannelID  string        `json:"channel_id"`
+	Rate       client.Amount `json:"rate"` // Rate is in Ada per interval.
+	IntervalMS uint64        `json:"interval_ms"`
+	Cap        client.Amount `json:"cap,omitempty"`
+	State      string        `json:"state"` // State is "running", "stopped", "cap_reached", "rejected" or "failed".
+	Paid       client.Amount `json:"paid"`
+	Lovelace   int64         `json:"lovelace"` // Lovelace is the paid amount in Lovelace.
+	Payments   int           `json:"payments"`
+	Throughput client.Amount `json:"throughput"` // Throughput is the average amount paid per second in Ada.
+	Started    time.Time     `json:"started"`
+	Time       time.Time     `json:"time"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// DecisionRequest is the body of a request deciding on a pending proposal.
+type DecisionRequest struct {
+	Accept bool `json:"accept"`
+	// Reason is sent to the peer if the proposal or request is rejected.
+	Reason string `json:"reason,omitempty"`
+}
+
+// ErrorResponse is returned with every non-2xx status code.
+type ErrorResponse struct {
+	Error string `json:"error"`
+	// Reason is the machine-readable reason if the peer rejected the
+	// operation.
+	Reason string `json:"reason,omitempty"`
+}
+
+func makeClientInfo(c *client.PaymentClient) ClientInfo {
+	return ClientInfo{
+		Name:           c.Name,
+		Address:        c.DisplayAddress(),
+		PublicKey:      c.Account.Address().String(),
+		HasOpenChannel: c.HasOpenChannel(),
+		OpenChannels:   len(c.Channels()),
+	}
+}
+
+func makeErrorResponse(err error) ErrorResponse {
+	resp := ErrorResponse{Error: err.Error()}
+	if rej, ok := client.PeerRejection(err); ok {
+		resp.Reason = string(rej.Reason)
+	}
+	return resp
+}
+
+func makeProposalInfo(p *client.PendingProposal) ProposalInfo {
+	return ProposalInfo{
+		ID:                p.ID,
+		Peer:              partyAddress(p.Msg.Participant),
+		PeerDeposit:       p.PeerDeposit.String(),
+		OwnDeposit:        p.OwnDeposit.String(),
+		ChallengeDuration: p.ChallengeDuration,
+		Received:          p.Received,
+	}
+}
+
+func makePendingRequestInfo(r *client.PendingRequest) PendingRequestInfo {
+	id := r.Channel.ID()
+	return PendingRequestInfo{
+		ID:          r.ID,
+		ChannelID:   hex.EncodeToString(id[:]),
+		Peer:        partyAddress(r.Channel.Params().Parts[1-r.Channel.Idx()]),
+		Amount:      r.Amount,
+		Lovelace:    r.Amount.Lovelace(),
+		Description: r.Description,
+		Received:    r.Received,
+	}
+}
+
+func makeRejectionInfo(r *client.Rejection) RejectionInfo {
+	info := RejectionInfo{
+		Item:    string(r.Item),
+		Reason:  string(r.Reason),
+		Message: r.Msg,
+	}
+	if r.ChannelID != (channel.ID{}) {
+		info.ChannelID = hex.EncodeToString(r.ChannelID[:])
+	}
+	return info
+}
+
+func makeChannelEventInfo(e client.ChannelEvent) ChannelEventInfo {
+	info := ChannelEventInfo{
+		ChannelID: hex.EncodeToString(e.ChannelID[:]),
+		Kind:      string(e.Kind),
+		Version:   e.Version,
+		Latest:    e.Latest,
+		Stale:     e.Stale(),
+		Time:      e.Time,
+		Message:   e.String(),
+	}
+	if !e.Timeout.IsZero() {
+		info.Timeout = &e.Timeout
+	}
+	return info
+}
+
+func makeForceCloseInfo(p client.ForceCloseProgress) ForceCloseInfo {
+	info := ForceCloseInfo{
+		ChannelID: hex.EncodeToString(p.ChannelID[:]),
+		Stage:     string(p.Stage),
+		Time:      p.Time,
+		Message:   p.String(),
+	}
+	if !p.Timeout.IsZero() {
+		info.Timeout = &p.Timeout
+	}
+	if p.Err != nil {
+		info.Error = p.Err.Error()
+	}
+	return info
+}
+
+func makeInvoiceInfo(inv client.Invoice) InvoiceInfo {
+	info := InvoiceInfo{
+		ID:          inv.ID,
+		Amount:      inv.Amount,
+		Lovelace:    inv.Amount.Lovelace(),
+		Description: inv.Description,
+		Status:      string(inv.Status),
+		Created:     inv.Created,
+	}
+	if !inv.Expires.IsZero() {
+		info.Expires = &inv.Expires
+	}
+	if inv.Status == client.InvoicePaid {
+		info.ChannelID = hex.EncodeToString(inv.ChannelID[:])
+		info.Version = inv.Version
+		info.Paid = &inv.Paid
+		info.Payer = inv.Payer
+	}
+	return info
+}
+
+func makeBatch(req BatchRequest) client.Batch {
+	b := client.Batch{Finalize: req.Finalize}
+	for _, t := range req.Transfers {
+		b.Transfers = append(b.Transfers, client.Transfer{Amount: t.Amount, Memo: t.Memo})
+	}
+	if e := req.Expect; e != nil {
+		b.Expect = &client.Expectation{Version: e.Version, OwnBalance: e.OwnBalance, PeerBalance: e.PeerBalance}
+	}
+	return b
+}
+
+func makeStreamInfo(st client.StreamStatus) StreamInfo {
+	info := StreamInfo{
+		ChannelID:  hex.EncodeToString(st.ChannelID[:]),
+		Rate:       st.Rate,
+		IntervalMS: uint64(st.Interval / time.Millisecond),
+		Cap:        st.Cap,
+		State:      string(st.State),
+		Paid:       st.Paid,
+		Lovelace:   st.Paid.Lovelace(),
+		Payments:   st.Payments,
+		Throughput: st.Throughput(),
+		Started:    st.Started,
+		Time:       st.Time,
+	}
+	if st.Err != nil {
+		info.Error = st.Err.Error()
+	}
+	return info
+}
+
+func makeBalanceInfo(bal int64) BalanceInfo {
+	return BalanceInfo{
+		Lovelace: bal,
+		Ada:      client.FormatBalance(client.Amount(bal)),
+	}
+}
+
+func makeChannelInfo(ch *client.PaymentChannel, state *channel.State) ChannelInfo {
+	id := ch.ID()
+	info := ChannelInfo{
+		ID:      hex.EncodeToString(id[:]),
+		Idx:     int(ch.Idx()),
+		Parties: partyAddresses(ch.Params()),
+		Version: state.Version,
+		IsFinal: state.IsFinal,
+		Phase:   ch.Phase().String(),
+	}
+	for i := range info.Parties {
+		bal := state.Allocation.Balance(channel.Index(i), ch.Currency())
+		info.Balances = append(info.Balances, bal.String())
+	}
+	return info
+}
+
+func partyAddresses(params *channel.Params) []string {
+	parties := make([]string, len(params.Parts))
+	for i, p := range params.Parts {
+		parties[i] = partyAddress(p)
+	}
+	return parties
+}
+
+// partyAddress returns the hex-encoded payment identifier of a party.
+func partyAddress(p wallet.Address) string {
+	if addr, ok := p.(*address.Address); ok {
+		return hex.EncodeToString(addr.GetPubKeyHashSlice())
+	}
+	return p.String()
+}
@@ -0,0 +1,166 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cardanowallet is a client for the read-only parts of the
+// cardano-wallet v2 HTTP API: wallet balances and assets, UTxO statistics,
+// transaction history, sync progress and network information.
+package cardanowallet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client queries a cardano-wallet server.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient makes the client use the given HTTP client instead of
+// http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// New returns a client for the cardano-wallet API at baseURL, e.g.
+// "http://localhost:8090/v2".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing cardano-wallet URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("parsing cardano-wallet URL: unsupported scheme %q", u.Scheme)
+	}
+	c := &Client{
+		baseURL:    strings.TrimSuffix(u.String(), "/"),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// URL returns the base URL of the API.
+func (c *Client) URL() string {
+	return c.baseURL
+}
+
+// Wallet returns the wallet with the given ID.
+func (c *Client) Wallet(ctx context.Context, id string) (*Wallet, error) {
+	var w Wallet
+	if err := c.get(ctx, "/wallets/"+url.PathEscape(id), nil, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// UTxOStatistics returns the UTxO distribution of the given wallet.
+func (c *Client) UTxOStatistics(ctx context.Context, id string) (*UTxOStatistics, error) {
+	var s UTxOStatistics
+	if err := c.get(ctx, "/wallets/"+url.PathEscape(id)+"/statistics/utxos", nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Transactions returns the transactions of the given wallet that match q.
+func (c *Client) Transactions(ctx context.Context, id string, q TransactionQuery) ([]Transaction, error) {
+	txs := []Transaction{}
+	if err := c.get(ctx, "/wallets/"+url.PathEscape(id)+"/transactions", q.values(), &txs); err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+// NetworkInformation returns the sync progress and tips of the node the
+// wallet server is connected to.
+func (c *Client) NetworkInformation(ctx context.Context) (*NetworkInformation, error) {
+	var n NetworkInformation
+	if err := c.get(ctx, "/network/information", nil, &n); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// TransactionQuery filters the transaction history. Zero values are not
+// sent to the server.
+type TransactionQuery struct {
+	Start time.Time // Start is the earliest time of a transaction.
+	End   time.Time // End is the latest time of a transaction.
+	Order string    // Order is OrderAscending or OrderDescending.
+}
+
+// Orders of the transaction history.
+const (
+	OrderAscending  = "ascending"
+	OrderDescending = "descending"
+)
+
+func (q TransactionQuery) values() url.Values {
+	v := url.Values{}
+	if !q.Start.IsZero() {
+		v.Set("start", q.Start.UTC().Format(time.RFC3339))
+	}
+	if !q.End.IsZero() {
+		v.Set("end", q.End.UTC().Format(time.RFC3339))
+	}
+	if q.Order != "" {
+		v.Set("order", q.Order)
+	}
+	return v
+}
+
+// get issues a GET request to the given API path and decodes the JSON
+// response into v. Error responses are returned as *Error.
+func (c *Client) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading cardano-wallet response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return decodeError(resp, body)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("decoding cardano-wallet response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cardanowallet_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/perun-cardano-demo/cardanowallet"
+)
+
+const walletID = "c35896086738b89c00f3ff41f2beced7449fc6e6"
+
+// Responses as served by cardano-wallet, shortened to the decoded fields.
+var responses = map[string]string{
+	"/v2/wallets/" + walletID: `{
+		"id": "c35896086738b89c00f3ff41f2beced7449fc6e6",
+		"name": "Alice",
+		"address_pool_gap": 20,
+		"balance": {
+			"available": {"quantity": 420133769, "unit": "lovelace"},
+			"reward": {"quantity": 1000, "unit": "lovelace"},
+			"total": {"quantity": 421133769, "unit": "lovelace"}
+		},
+		"assets": {
+			"available": [{"policy_id": "65ab82542b0ca20391caaf66a4d4d7897d281f9c136cd3513136945b", "asset_name": "746f6b656e", "quantity": 7}],
+			"total": [{"policy_id": "65ab82542b0ca20391caaf66a4d4d7897d281f9c136cd3513136945b", "asset_name": "746f6b656e", "quantity": 9}]
+		},
+		"state": {"status": "syncing", "progress": {"quantity": 42.5, "unit": "percent"}},
+		"tip": {
+			"absolute_slot_number": 8086,
+			"slot_number": 1337,
+			"epoch_number": 14,
+			"time": "2022-05-27T14:34:12Z",
+			"height": {"quantity": 1337, "unit": "block"}
+		}
+	}`,
+	"/v2/wallets/" + walletID + "/statistics/utxos": `{
+		"total": {"quantity": 420133769, "unit": "lovelace"},
+		"scale": "log10",
+		"distribution": {"10000000": 1, "100000000": 2, "1000000000": 1}
+	}`,
+	"/v2/wallets/" + walletID + "/transactions": `[{
+		"id": "1423856bc91c49e928f6f30f4e8d665d53eb4ab6028bd0ac971809d514c92db1",
+		"amount": {"quantity": 10000000, "unit": "lovelace"},
+		"fee": {"quantity": 170000, "unit": "lovelace"},
+		"inserted_at": {"time": "2022-05-27T14:34:12Z", "block": {"slot_number": 1337, "epoch_number": 14, "height": {"quantity": 1337, "unit": "block"}}},
+		"depth": {"quantity": 10, "unit": "block"},
+		"direction": "outgoing",
+		"status": "in_ledger",
+		"metadata": null
+	}]`,
+	"/v2/network/information": `{
+		"sync_progress": {"status": "ready"},
+		"node_tip": {"absolute_slot_number": 8086, "slot_number": 1337, "epoch_number": 14, "time": "2022-05-27T14:34:12Z", "height": {"quantity": 1337, "unit": "block"}},
+		"node_era": "babbage",
+		"network_info": {"protocol_magic": 42, "network_id": "testnet"},
+		"wallet_mode": "node"
+	}`,
+}
+
+// newServer serves the responses above. Unknown wallets are answered with a
+// JSON error and the wallet "broken" with a plain-text error. The query of
+// the last request is stored in query.
+func newServer(t *testing.T, query *string) *cardanowallet.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*query = r.URL.RawQuery
+		body, ok := responses[r.URL.Path]
+		switch {
+		case ok:
+			_, _ = w.Write([]byte(body))
+		case r.URL.Path == "/v2/wallets/broken":
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte("upstream unavailable\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code": "no_such_wallet", "message": "I couldn't find a wallet with the given id."}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	c, err := cardanowallet.New(srv.URL + "/v2/")
+	require.NoError(t, err)
+	return c
+}
+
+func TestClient(t *testing.T) {
+	var query string
+	c := newServer(t, &query)
+	ctx := context.Background()
+
+	w, err := c.Wallet(ctx, walletID)
+	require.NoError(t, err)
+	require.Equal(t, "Alice", w.Name)
+	require.EqualValues(t, 420133769, w.Balance.Available.Quantity)
+	require.EqualValues(t, 1000, w.Balance.Reward.Quantity)
+	require.EqualValues(t, 421133769, w.Balance.Total.Quantity)
+	require.Equal(t, cardanowallet.UnitLovelace, w.Balance.Total.Unit)
+	require.Len(t, w.Assets.Available, 1)
+	require.Equal(t, "746f6b656e", w.Assets.Available[0].AssetName)
+	require.EqualValues(t, 9, w.Assets.Total[0].Quantity)
+	require.False(t, w.State.Ready())
+	require.Equal(t, 42.5, w.State.Percent())
+	require.EqualValues(t, 1337, w.Tip.Height.Quantity)
+
+	s, err := c.UTxOStatistics(ctx, walletID)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, s.Count())
+
+	start := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	txs, err := c.Transactions(ctx, walletID, cardanowallet.TransactionQuery{Start: start, Order: cardanowallet.OrderDescending})
+	require.NoError(t, err)
+	require.Equal(t, "order=descending&start=2022-05-01T00%3A00%3A00Z", query)
+	require.Len(t, txs, 1)
+	require.Equal(t, cardanowallet.DirectionOutgoing, txs[0].Direction)
+	require.Equal(t, cardanowallet.TxInLedger, txs[0].Status)
+	require.EqualValues(t, 170000, txs[0].Fee.Quantity)
+	require.Equal(t, time.Date(2022, 5, 27, 14, 34, 12, 0, time.UTC), txs[0].Time())
+
+	n, err := c.NetworkInformation(ctx)
+	require.NoError(t, err)
+	require.True(t, n.SyncProgress.Ready())
+	require.Equal(t, 100.0, n.SyncProgress.Percent())
+	require.Equal(t, "testnet", n.NetworkInfo.NetworkID)
+	require.Equal(t, "babbage", n.NodeEra)
+}
+
+func TestClientErrors(t *testing.T) {
+	var query string
+	c := newServer(t, &query)
+	ctx := context.Background()
+
+	_, err := c.Wallet(ctx, "unknown")
+	require.True(t, cardanowallet.IsCode(err, cardanowallet.CodeNoSuchWallet))
+	werr, ok := err.(*cardanowallet.Error)
+	require.True(t, ok)
+	require.Equal(t, http.StatusNotFound, werr.StatusCode)
+	require.Contains(t, werr.Message, "couldn't find a wallet")
+
+	// Non-JSON error bodies become the message.
+	_, err = c.Wallet(ctx, "broken")
+	werr, ok = err.(*cardanowallet.Error)
+	require.True(t, ok)
+	require.Equal(t, http.StatusBadGateway, werr.StatusCode)
+	require.Empty(t, werr.Code)
+	require.Equal(t, "upstream unavailable", werr.Message)
+
+	_, err = cardanowallet.New("localhost:8090")
+	require.Error(t, err)
+}
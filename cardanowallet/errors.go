@@ -0,0 +1,60 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cardanowallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error codes of the cardano-wallet API that callers commonly handle.
+const (
+	CodeNoSuchWallet = "no_such_wallet"
+	CodeNotFound     = "not_found"
+)
+
+// Error is an error response of the wallet server.
+type Error struct {
+	StatusCode int    `json:"-"`       // StatusCode is the HTTP status code.
+	Code       string `json:"code"`    // Code identifies the error, e.g. CodeNoSuchWallet.
+	Message    string `json:"message"` // Message is the human-readable description.
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("cardano-wallet: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+	}
+	return fmt.Sprintf("cardano-wallet: %s: %s", e.Code, e.Message)
+}
+
+// IsCode reports whether err is a wallet server error with the given code.
+func IsCode(err error, code string) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == code
+}
+
+// decodeError decodes the JSON error body of a failed request. Bodies that
+// are not JSON become the message of the error.
+func decodeError(resp *http.Response, body []byte) error {
+	e := &Error{StatusCode: resp.StatusCode}
+	if err := json.Unmarshal(body, e); err != nil || e.Code == "" {
+		e.Code = ""
+		e.Message = strings.TrimSpace(string(body))
+	}
+	return e
+}
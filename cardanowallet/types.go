@@ -0,0 +1,190 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cardanowallet
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Units of quantities.
+const (
+	UnitLovelace = "lovelace"
+	UnitPercent  = "percent"
+	UnitBlock    = "block"
+)
+
+// Quantity is an integral amount with a unit, usually Lovelace.
+type Quantity struct {
+	Quantity int64  `json:"quantity"`
+	Unit     string `json:"unit"`
+}
+
+// Percentage is a percentage, e.g. the sync progress.
+type Percentage struct {
+	Quantity float64 `json:"quantity"`
+	Unit     string  `json:"unit"`
+}
+
+// Balance is the Ada balance of a wallet.
+type Balance struct {
+	// Available is the balance that can be spent.
+	Available Quantity `json:"available"`
+	// Reward is the balance of the reward account.
+	Reward Quantity `json:"reward"`
+	// Total is the available balance plus rewards and change that is not
+	// spendable yet.
+	Total Quantity `json:"total"`
+}
+
+// Asset is an amount of a native token.
+type Asset struct {
+	PolicyID  string `json:"policy_id"`  // PolicyID is the hex-encoded minting policy hash.
+	AssetName string `json:"asset_name"` // AssetName is the hex-encoded asset name.
+	Quantity  uint64 `json:"quantity"`
+}
+
+// Assets are the native tokens of a wallet.
+type Assets struct {
+	Available []Asset `json:"available"`
+	Total     []Asset `json:"total"`
+}
+
+// Sync statuses of wallets and the network.
+const (
+	SyncReady         = "ready"
+	SyncSyncing       = "syncing"
+	SyncNotResponding = "not_responding"
+)
+
+// SyncProgress is the sync state of a wallet or the node.
+type SyncProgress struct {
+	Status string `json:"status"`
+	// Progress is only set while syncing.
+	Progress *Percentage `json:"progress,omitempty"`
+}
+
+// Ready reports whether syncing is complete.
+func (s SyncProgress) Ready() bool {
+	return s.Status == SyncReady
+}
+
+// Percent returns the sync progress in percent.
+func (s SyncProgress) Percent() float64 {
+	switch {
+	case s.Ready():
+		return 100
+	case s.Progress != nil:
+		return s.Progress.Quantity
+	default:
+		return 0
+	}
+}
+
+// Block is a reference to a block.
+type Block struct {
+	AbsoluteSlotNumber uint64    `json:"absolute_slot_number"`
+	SlotNumber         uint64    `json:"slot_number"`
+	EpochNumber        uint64    `json:"epoch_number"`
+	Time               time.Time `json:"time"`
+	Height             Quantity  `json:"height"`
+}
+
+// Wallet is a wallet of the server.
+type Wallet struct {
+	ID      string       `json:"id"`
+	Name    string       `json:"name"`
+	Balance Balance      `json:"balance"`
+	Assets  Assets       `json:"assets"`
+	State   SyncProgress `json:"state"`
+	Tip     Block        `json:"tip"`
+}
+
+// UTxOStatistics is the distribution of the UTxOs of a wallet. The
+// distribution maps the upper bound of each bucket in Lovelace to the number
+// of UTxOs in it.
+type UTxOStatistics struct {
+	Total        Quantity          `json:"total"`
+	Scale        string            `json:"scale"`
+	Distribution map[string]uint64 `json:"distribution"`
+}
+
+// Count returns the total number of UTxOs.
+func (s UTxOStatistics) Count() uint64 {
+	var n uint64
+	for _, c := range s.Distribution {
+		n += c
+	}
+	return n
+}
+
+// Directions and statuses of transactions.
+const (
+	DirectionIncoming = "incoming"
+	DirectionOutgoing = "outgoing"
+
+	TxPending   = "pending"
+	TxSubmitted = "submitted"
+	TxInLedger  = "in_ledger"
+	TxExpired   = "expired"
+)
+
+// TimeReference is a point in time on the chain.
+type TimeReference struct {
+	Time  time.Time `json:"time"`
+	Block Block     `json:"block"`
+}
+
+// Transaction is a transaction in the history of a wallet.
+type Transaction struct {
+	ID        string   `json:"id"`
+	Amount    Quantity `json:"amount"`
+	Fee       Quantity `json:"fee"`
+	Direction string   `json:"direction"`
+	Status    string   `json:"status"`
+	// InsertedAt is set once the transaction is in the ledger.
+	InsertedAt *TimeReference `json:"inserted_at,omitempty"`
+	// PendingSince is set while the transaction is pending.
+	PendingSince *TimeReference `json:"pending_since,omitempty"`
+	// Depth is the number of blocks on top of the transaction.
+	Depth    *Quantity       `json:"depth,omitempty"`
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+}
+
+// Time returns when the transaction was inserted into the ledger or, if it
+// is pending, when it was submitted.
+func (t Transaction) Time() time.Time {
+	switch {
+	case t.InsertedAt != nil:
+		return t.InsertedAt.Time
+	case t.PendingSince != nil:
+		return t.PendingSince.Time
+	default:
+		return time.Time{}
+	}
+}
+
+// NetworkInformation describes the node the wallet server is connected to.
+type NetworkInformation struct {
+	SyncProgress SyncProgress `json:"sync_progress"`
+	NodeTip      Block        `json:"node_tip"`
+	NetworkTip   *Block       `json:"network_tip,omitempty"`
+	NodeEra      string       `json:"node_era"`
+	NetworkInfo  struct {
+		ProtocolMagic int64  `json:"protocol_magic"`
+		NetworkID     string `json:"network_id"` // NetworkID is "mainnet" or "testnet".
+	} `json:"network_info"`
+	WalletMode string `json:"wallet_mode"`
+}
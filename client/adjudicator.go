@@ -0,0 +1,311 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"perun.network/go-perun/channel"
+	channel2 "perun.network/perun-cardano-backend/channel"
+	"perun.network/perun-cardano-backend/channel/types"
+	"perun.network/perun-cardano-backend/wire"
+)
+
+// Endpoints of the Perun contract that the backend does not call yet.
+const (
+	disputeEndpointFormat    = channel2.InstanceEndpoint + "/%s/endpoint/dispute"
+	forceCloseEndpointFormat = channel2.InstanceEndpoint + "/%s/endpoint/forceClose"
+)
+
+// forceCloseMargin is waited in addition to the challenge period before a
+// channel is force-closed, so that the validity interval of the transaction
+// lies after the timeout.
+const forceCloseMargin = time.Second
+
+// adjudicator wraps the Cardano adjudicator. It makes its event subscriptions
+// non-blocking and implements disputes, which the backend does not support
+// yet: Register disputes a state using the "dispute" endpoint of the Perun
+// contract and Withdraw closes a disputed channel using its "forceClose"
+// endpoint once the challenge period is over.
+//
+// The adjudicator learns about disputes from the events of its
+// subscriptions. The go-perun watcher subscribes to the events of every
+// channel the client watches.
+type adjudicator struct {
+	channel.Adjudicator
+	pab      *channel2.PAB
+	walletID string
+
+	instanceMutex sync.Mutex
+	instance      string // instance is our Perun contract instance, activated on first use.
+	tokenMutex    sync.Mutex
+
+	mutex    sync.Mutex
+	disputes map[channel.ID]dispute
+	changed  chan struct{} // changed is closed and replaced whenever disputes changes.
+}
+
+// dispute is the on-chain dispute of a channel.
+type dispute struct {
+	version   uint64
+	timeout   time.Time // timeout is the end of the challenge period.
+	concluded bool
+}
+
+func newAdjudicator(pab *channel2.PAB, walletID string) *adjudicator {
+	return &adjudicator{
+		Adjudicator: channel2.NewAdjudicator(pab),
+		pab:         pab,
+		walletID:    walletID,
+		disputes:    make(map[channel.ID]dispute),
+		changed:     make(chan struct{}),
+	}
+}
+
+// Register disputes the given state on-chain. Nothing happens if a state of
+// at least the same version is disputed already.
+func (a *adjudicator) Register(ctx context.Context, req channel.AdjudicatorReq, states []channel.SignedState) error {
+	if len(states) > 0 {
+		return errors.New("registering sub-channels is not supported")
+	}
+	id := req.Params.ID()
+	if d, ok := a.dispute(id); ok && (d.concluded || d.version >= req.Tx.Version) {
+		return nil
+	}
+	token, err := a.channelToken(ctx, id)
+	if err != nil {
+		return err
+	}
+	params, err := types.MakeChannelParameters(*req.Params.Clone())
+	if err != nil {
+		return err
+	}
+	state, err := types.ConvertChannelState(*req.Tx.State.Clone())
+	if err != nil {
+		return err
+	}
+	return a.callEndpoint(disputeEndpointFormat, wire.DisputeParams{
+		ChannelID:      wire.ChannelID(id),
+		ChannelToken:   wire.MakeAssetClass(token),
+		SignedState:    wire.MakeStateSignatures(state, req.Tx.Sigs),
+		SigningPubKeys: wire.MakeChannelParameters(params).SigningPubKeys,
+	})
+}
+
+// Withdraw pays out the channel. Final states are closed directly. Otherwise,
+// Withdraw waits until the challenge period of the dispute is over and
+// force-closes the channel. Nothing happens if the channel was concluded in
+// the meantime, as concluding a channel pays out all parties.
+func (a *adjudicator) Withdraw(ctx context.Context, req channel.AdjudicatorReq, stateMap channel.StateMap) error {
+	id := req.Params.ID()
+	token, err := a.channelToken(ctx, id)
+	if err != nil {
+		return err
+	}
+	if req.Tx.State.IsFinal {
+		return a.Adjudicator.Withdraw(ctx, req, stateMap)
+	}
+	concluded, err := a.awaitTimeout(ctx, id)
+	if err != nil || concluded {
+		return err
+	}
+	return a.callEndpoint(forceCloseEndpointFormat, wire.ForceCloseParams{
+		ChannelToken: wire.MakeAssetClass(token),
+		ChannelID:    wire.ChannelID(id),
+	})
+}
+
+// Progress is not supported as the client only opens payment channels.
+func (a *adjudicator) Progress(context.Context, channel.ProgressReq) error {
+	return errors.New("progressing channels is not supported")
+}
+
+// Subscribe returns a non-blocking subscription to the adjudicator events of
+// the given channel. The adjudicator records the disputes it reports.
+func (a *adjudicator) Subscribe(ctx context.Context, id channel.ID) (channel.AdjudicatorSubscription, error) {
+	sub, err := a.Adjudicator.Subscribe(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return newEventSub(&disputeSub{AdjudicatorSubscription: sub, adj: a}), nil
+}
+
+// disputeSub records the disputes reported by a subscription.
+type disputeSub struct {
+	channel.AdjudicatorSubscription
+	adj *adjudicator
+}
+
+func (s *disputeSub) Next() channel.AdjudicatorEvent {
+	e := s.AdjudicatorSubscription.Next()
+	if e != nil {
+		s.adj.record(e)
+	}
+	return e
+}
+
+func (a *adjudicator) record(e channel.AdjudicatorEvent) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	d, ok := a.disputes[e.ID()]
+	switch e.(type) {
+	case *channel.RegisteredEvent, *channel.ProgressedEvent:
+		if d.concluded || (ok && e.Version() < d.version) {
+			return
+		}
+		d.version, d.timeout = e.Version(), timeoutTime(e.Timeout())
+	case *channel.ConcludedEvent:
+		d.concluded = true
+	default:
+		return
+	}
+	a.disputes[e.ID()] = d
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+func (a *adjudicator) dispute(id channel.ID) (dispute, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	d, ok := a.disputes[id]
+	return d, ok
+}
+
+// awaitDispute waits until the channel is disputed or concluded on-chain.
+func (a *adjudicator) awaitDispute(ctx context.Context, id channel.ID) (dispute, error) {
+	for {
+		a.mutex.Lock()
+		d, ok := a.disputes[id]
+		changed := a.changed
+		a.mutex.Unlock()
+		if ok {
+			return d, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return dispute{}, ctx.Err()
+		}
+	}
+}
+
+// awaitTimeout waits until the challenge period of the channel's dispute is
+// over. Refutations extend the wait. It returns early if the channel is
+// concluded.
+func (a *adjudicator) awaitTimeout(ctx context.Context, id channel.ID) (concluded bool, err error) {
+	for {
+		a.mutex.Lock()
+		d, ok := a.disputes[id]
+		changed := a.changed
+		a.mutex.Unlock()
+		if d.concluded {
+			return true, nil
+		}
+		// Without a known dispute, wait for the watcher to report it.
+		wait := time.Duration(math.MaxInt64)
+		if ok {
+			if wait = time.Until(d.timeout.Add(forceCloseMargin)); wait <= 0 {
+				return false, nil
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-changed:
+		case <-ctx.Done():
+			timer.Stop()
+			return false, ctx.Err()
+		}
+		timer.Stop()
+	}
+}
+
+// channelToken returns the token of the channel. The PAB keeps the tokens of
+// the channels opened since the client started only, so tokens of restored
+// channels are read from their on-chain history.
+func (a *adjudicator) channelToken(ctx context.Context, id channel.ID) (types.ChannelToken, error) {
+	a.tokenMutex.Lock()
+	defer a.tokenMutex.Unlock()
+	if token, err := a.pab.GetChannelToken(id); err == nil {
+		return token, nil
+	}
+
+	sub, err := a.pab.NewInternalSubscription(id)
+	if err != nil {
+		return types.ChannelToken{}, fmt.Errorf("subscribing to channel history: %w", err)
+	}
+	events := newEventSub(sub)
+	done := make(chan struct{})
+	defer close(done)
+	defer events.Close()
+	go func() {
+		select {
+		case <-ctx.Done():
+			events.Close()
+		case <-done:
+		}
+	}()
+
+	var token types.ChannelToken
+	switch e := events.Next().(type) {
+	case types.Created:
+		token = e.NewDatum.ChannelToken
+	case types.Deposited:
+		token = e.NewDatum.ChannelToken
+	case types.Disputed:
+		token = e.NewDatum.ChannelToken
+	case types.Concluded:
+		token = e.OldDatum.ChannelToken
+	case nil:
+		if ctx.Err() != nil {
+			return token, ctx.Err()
+		}
+		return token, fmt.Errorf("reading channel history: %v", events.Err())
+	default:
+		return token, fmt.Errorf("unexpected channel event %T", e)
+	}
+	return token, a.pab.SetChannelToken(id, token)
+}
+
+// callEndpoint calls the given endpoint of our Perun contract instance.
+func (a *adjudicator) callEndpoint(format string, body interface{}) error {
+	instance, err := a.contractInstance()
+	if err != nil {
+		return err
+	}
+	return a.pab.CallEndpoint(fmt.Sprintf(format, instance), body, nil)
+}
+
+// contractInstance returns our Perun contract instance, activating it on
+// first use.
+func (a *adjudicator) contractInstance() (string, error) {
+	a.instanceMutex.Lock()
+	defer a.instanceMutex.Unlock()
+	if a.instance != "" {
+		return a.instance, nil
+	}
+	var response wire.ContractInstanceID
+	err := a.pab.CallEndpoint(channel2.ActivateEndpoint, wire.MakePerunActivationBody(a.walletID), &response)
+	if err != nil {
+		return "", fmt.Errorf("activating contract: %w", err)
+	}
+	a.instance = response.Decode()
+	return a.instance, nil
+}
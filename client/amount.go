@@ -0,0 +1,288 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"perun.network/go-perun/channel"
+)
+
+// Amount is an exact amount of Ada, stored as an integer number of Lovelace.
+// Amounts are never converted to or from binary floating point, so decimal
+// amounts like 0.1 Ada are represented exactly.
+//
+// Like time.Duration, amounts are built from the unit constants, e.g.
+// 5*Ada + 250*Lovelace.
+type Amount int64
+
+const (
+	// Lovelace is the smallest unit of Ada.
+	Lovelace Amount = 1
+	// Ada is one Ada, 10^6 Lovelace.
+	Ada Amount = 1_000_000
+
+	// AdaDecimals is the number of decimal places of an Ada amount.
+	AdaDecimals = 6
+)
+
+// ParseAmount parses an amount from a decimal string. The string may end with
+// the unit "ADA" or "lovelace" (case-insensitive), separated by optional
+// whitespace, and is read in Ada if no unit is given. Ada amounts may have up
+// to six decimal places, Lovelace amounts must be integers. Examples are
+// "1.234567", "5 ADA" and "1000 lovelace".
+func ParseAmount(s string) (Amount, error) {
+	num, unit := splitUnit(strings.TrimSpace(s))
+	var (
+		a   Amount
+		err error
+	)
+	switch strings.ToLower(unit) {
+	case "", "ada":
+		a, err = parseDecimal(num, AdaDecimals)
+	case "lovelace":
+		a, err = parseDecimal(num, 0)
+	default:
+		err = fmt.Errorf("unknown unit %q", unit)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("parsing amount %q: %w", s, err)
+	}
+	return a, nil
+}
+
+// MustParseAmount is like ParseAmount but panics if s cannot be parsed. It is
+// intended for constants in tests and examples.
+func MustParseAmount(s string) Amount {
+	a, err := ParseAmount(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// AmountFromBal converts a channel balance in Lovelace to an Amount. It fails
+// if the balance does not fit into an Amount.
+func AmountFromBal(bal channel.Bal) (Amount, error) {
+	if !bal.IsInt64() {
+		return 0, fmt.Errorf("balance %v Lovelace out of range", bal)
+	}
+	return Amount(bal.Int64()), nil
+}
+
+// splitUnit splits a trailing alphabetic unit off s.
+func splitUnit(s string) (num, unit string) {
+	i := len(s)
+	for i > 0 && isLetter(s[i-1]) {
+		i--
+	}
+	return strings.TrimSpace(s[:i]), s[i:]
+}
+
+func isLetter(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+// parseDecimal parses s as a decimal number with at most decimals fractional
+// digits and returns it scaled by 10^decimals.
+func parseDecimal(s string, decimals int) (Amount, error) {
+	neg := strings.HasPrefix(s, "-")
+	if neg || strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+		if decimals == 0 {
+			return 0, fmt.Errorf("fractional Lovelace")
+		}
+	}
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("missing digits")
+	}
+	if !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("invalid digits")
+	}
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > decimals {
+		return 0, fmt.Errorf("more than %d decimal places", decimals)
+	}
+	digits := strings.TrimLeft(whole+frac+strings.Repeat("0", decimals-len(frac)), "0")
+	if digits == "" {
+		return 0, nil
+	}
+	// The magnitude of math.MinInt64 does not fit into an int64, so parse it
+	// as uint64 and apply the sign afterwards.
+	v, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil || v > math.MaxInt64+boolToUint(neg) {
+		return 0, fmt.Errorf("out of range")
+	}
+	if neg {
+		return Amount(-v), nil
+	}
+	return Amount(v), nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func boolToUint(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Lovelace returns the amount in Lovelace.
+func (a Amount) Lovelace() int64 {
+	return int64(a)
+}
+
+// Bal returns the amount as a channel balance in Lovelace.
+func (a Amount) Bal() channel.Bal {
+	return big.NewInt(int64(a))
+}
+
+// Add returns a+b. It fails if the result overflows.
+func (a Amount) Add(b Amount) (Amount, error) {
+	c := a + b
+	if (c > a) != (b > 0) {
+		return 0, fmt.Errorf("%v + %v overflows", a, b)
+	}
+	return c, nil
+}
+
+// Sub returns a-b. It fails if the result overflows.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	c := a - b
+	if (c < a) != (b > 0) {
+		return 0, fmt.Errorf("%v - %v overflows", a, b)
+	}
+	return c, nil
+}
+
+// Mul returns a*n. It fails if the result overflows.
+func (a Amount) Mul(n int64) (Amount, error) {
+	c := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(n))
+	if !c.IsInt64() {
+		return 0, fmt.Errorf("%v * %d overflows", a, n)
+	}
+	return Amount(c.Int64()), nil
+}
+
+// Cmp compares a and b and returns -1, 0 or +1.
+func (a Amount) Cmp(b Amount) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of a.
+func (a Amount) Sign() int {
+	return a.Cmp(0)
+}
+
+// Format formats the amount in Ada with exactly the given number of decimal
+// places, rounding half away from zero if decimals is less than six. No unit
+// is appended.
+func (a Amount) Format(decimals int) string {
+	if decimals < 0 {
+		decimals = 0
+	} else if decimals > AdaDecimals {
+		decimals = AdaDecimals
+	}
+	// Work on the magnitude as uint64 so that math.MinInt64 is handled.
+	neg := a < 0
+	mag := uint64(a)
+	if neg {
+		mag = -mag
+	}
+	if decimals < AdaDecimals {
+		unit := uint64(math.Pow10(AdaDecimals - decimals))
+		q, r := mag/unit, mag%unit
+		if r >= unit-r {
+			q++
+		}
+		mag = q * unit
+	}
+	whole := strconv.FormatUint(mag/uint64(Ada), 10)
+	frac := fmt.Sprintf("%06d", mag%uint64(Ada))[:decimals]
+	var sb strings.Builder
+	if neg && mag != 0 {
+		sb.WriteByte('-')
+	}
+	sb.WriteString(whole)
+	if decimals > 0 {
+		sb.WriteByte('.')
+		sb.WriteString(frac)
+	}
+	return sb.String()
+}
+
+// AdaString formats the amount exactly in Ada without trailing zeros and
+// without a unit, e.g. "1.5" or "0.000001".
+func (a Amount) AdaString() string {
+	s := a.Format(AdaDecimals)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// String formats the amount exactly in Ada, e.g. "1.5 ADA". ParseAmount
+// parses the result back to the same amount.
+func (a Amount) String() string {
+	return a.AdaString() + " ADA"
+}
+
+// MarshalJSON encodes the amount as a decimal string in Ada.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.AdaString())
+}
+
+// UnmarshalJSON decodes an amount from a JSON string accepted by ParseAmount
+// or from a JSON number in Ada. Numbers are parsed from their decimal text,
+// so they are exact as well. Exponent notation is not supported. Like for
+// the built-in types, null leaves the amount unchanged.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+	v, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
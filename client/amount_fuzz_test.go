@@ -0,0 +1,65 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package client_test
+
+import (
+	"testing"
+
+	"perun.network/perun-cardano-demo/client"
+)
+
+// FuzzAmountRoundTrip checks that formatting any amount and parsing the result
+// yields the same amount.
+func FuzzAmountRoundTrip(f *testing.F) {
+	for _, v := range []int64{0, 1, -1, 100_000, 1_234_567, 1 << 62, -1 << 63} {
+		f.Add(v)
+	}
+	f.Fuzz(func(t *testing.T, v int64) {
+		a := client.Amount(v)
+		for _, s := range []string{a.String(), a.AdaString(), a.Format(client.AdaDecimals)} {
+			b, err := client.ParseAmount(s)
+			if err != nil {
+				t.Fatalf("parsing %q: %v", s, err)
+			}
+			if b != a {
+				t.Fatalf("parsing %q: got %d, want %d", s, b, a)
+			}
+		}
+	})
+}
+
+// FuzzParseAmount checks that every string that parses is formatted back to
+// a string denoting the same amount.
+func FuzzParseAmount(f *testing.F) {
+	for _, s := range []string{"1.234567", "5 ADA", "1000 lovelace", "-0.1", ".5", "1e6", "1.0000001"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		a, err := client.ParseAmount(s)
+		if err != nil {
+			return
+		}
+		b, err := client.ParseAmount(a.String())
+		if err != nil {
+			t.Fatalf("parsing formatted %q of %q: %v", a.String(), s, err)
+		}
+		if b != a {
+			t.Fatalf("round trip of %q: got %d, want %d", s, b, a)
+		}
+	})
+}
@@ -0,0 +1,173 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/perun-cardano-demo/client"
+)
+
+func TestParseAmount(t *testing.T) {
+	for s, want := range map[string]client.Amount{
+		"1.234567":                      1_234_567,
+		"0.1":                           100_000,
+		"5 ADA":                         5 * client.Ada,
+		"5ada":                          5 * client.Ada,
+		" 2.50 Ada ":                    2_500_000,
+		".5":                            500_000,
+		"3.":                            3 * client.Ada,
+		"1000 lovelace":                 1000,
+		"1000 Lovelace":                 1000,
+		"-1.5":                          -1_500_000,
+		"+7":                            7 * client.Ada,
+		"0.000001":                      client.Lovelace,
+		"1.1000000000":                  1_100_000,
+		"0":                             0,
+		"-0":                            0,
+		"-9223372036854775808 lovelace": math.MinInt64,
+		"9223372036854.775807":          math.MaxInt64,
+	} {
+		a, err := client.ParseAmount(s)
+		require.NoError(t, err, s)
+		require.Equal(t, want, a, s)
+	}
+
+	for _, s := range []string{
+		"",
+		"ADA",
+		".",
+		"1.2.3",
+		"1,5",
+		"1e6",
+		"0x10",
+		"1.0000001",
+		"1.5 lovelace",
+		"5 BTC",
+		"- 5",
+		"9223372036854775808 lovelace",
+		"9223372036854.775808",
+	} {
+		_, err := client.ParseAmount(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestAmountFormat(t *testing.T) {
+	a := client.MustParseAmount("1.234567")
+	require.Equal(t, "1.234567", a.Format(6))
+	require.Equal(t, "1.2346", a.Format(4))
+	require.Equal(t, "1.23", a.Format(2))
+	require.Equal(t, "1", a.Format(0))
+	require.Equal(t, "1.234567 ADA", a.String())
+	require.Equal(t, "0.5", client.MustParseAmount("0.45").Format(1), "rounds half away from zero")
+
+	require.Equal(t, "0.000000", client.Amount(0).Format(6))
+	require.Equal(t, "0 ADA", client.Amount(0).String())
+	require.Equal(t, "-0.1 ADA", client.MustParseAmount("-0.1").String())
+	require.Equal(t, "0.0000", client.Amount(-40).Format(4), "no negative zero")
+	require.Equal(t, "-0.0001", client.Amount(-50).Format(4))
+	require.Equal(t, "-9223372036854.775808 ADA", client.Amount(math.MinInt64).String())
+	require.Equal(t, "1.000000", client.FormatBalance(client.Ada))
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	a, err := client.MustParseAmount("0.1").Add(client.MustParseAmount("0.2"))
+	require.NoError(t, err)
+	require.Equal(t, client.MustParseAmount("0.3"), a)
+
+	a, err = a.Sub(client.Ada)
+	require.NoError(t, err)
+	require.Equal(t, "-0.7 ADA", a.String())
+	require.Equal(t, -1, a.Sign())
+	require.Equal(t, 1, client.Ada.Cmp(a))
+
+	a, err = client.MustParseAmount("0.333333").Mul(3)
+	require.NoError(t, err)
+	require.Equal(t, client.Amount(999_999), a)
+	require.Equal(t, int64(999_999), a.Bal().Int64())
+
+	_, err = client.Amount(math.MaxInt64).Add(client.Lovelace)
+	require.Error(t, err)
+	_, err = client.Amount(math.MinInt64).Sub(client.Lovelace)
+	require.Error(t, err)
+	_, err = client.Amount(math.MaxInt64).Mul(2)
+	require.Error(t, err)
+
+	b, err := client.AmountFromBal(client.Ada.Bal())
+	require.NoError(t, err)
+	require.Equal(t, client.Ada, b)
+}
+
+func TestAmountJSON(t *testing.T) {
+	var req struct {
+		A client.Amount `json:"a"`
+		B client.Amount `json:"b"`
+		C client.Amount `json:"c"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"a": 0.1, "b": "5 ADA", "c": "1000 lovelace"}`), &req))
+	require.Equal(t, client.Amount(100_000), req.A)
+	require.Equal(t, 5*client.Ada, req.B)
+	require.Equal(t, client.Amount(1000), req.C)
+
+	data, err := json.Marshal(req.A)
+	require.NoError(t, err)
+	require.Equal(t, `"0.1"`, string(data))
+
+	// Null is a no-op, so optional amounts can be sent as null.
+	require.NoError(t, json.Unmarshal([]byte(`{"a": null, "b": "1"}`), &req))
+	require.Equal(t, client.Amount(100_000), req.A)
+	require.Equal(t, client.Ada, req.B)
+	var opt struct {
+		A *client.Amount `json:"a"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"a": null}`), &opt))
+	require.Nil(t, opt.A)
+
+	require.Error(t, json.Unmarshal([]byte(`{"a": 1e-7}`), &req))
+	require.Error(t, json.Unmarshal([]byte(`{"a": "null"}`), &req))
+}
+
+// TestAmountRoundTrip checks that every amount survives formatting and
+// parsing unchanged. The fuzz targets in amount_fuzz_test.go extend this with
+// coverage-guided inputs on Go 1.18 and later.
+func TestAmountRoundTrip(t *testing.T) {
+	roundTrip := func(v int64) bool {
+		a := client.Amount(v)
+		for _, s := range []string{a.String(), a.AdaString(), a.Format(6), a.Format(6) + " ada"} {
+			b, err := client.ParseAmount(s)
+			if err != nil || b != a {
+				return false
+			}
+		}
+		l, err := client.ParseAmount(fmtLovelace(a))
+		return err == nil && l == a
+	}
+	for _, v := range []int64{0, 1, -1, 999_999, 1_000_000, math.MaxInt64, math.MinInt64} {
+		require.True(t, roundTrip(v), v)
+	}
+	cfg := &quick.Config{MaxCount: 10_000, Rand: rand.New(rand.NewSource(1))}
+	require.NoError(t, quick.Check(roundTrip, cfg))
+}
+
+func fmtLovelace(a client.Amount) string {
+	b, _ := json.Marshal(a.Lovelace())
+	return string(b) + " lovelace"
+}
@@ -0,0 +1,140 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"perun.network/go-perun/channel"
+	channel2 "perun.network/perun-cardano-backend/channel"
+	"perun.network/perun-cardano-demo/cardanowallet"
+)
+
+// Lengths of the components of a native token identifier in bytes.
+const (
+	PolicyIDLength     = 28
+	MaxAssetNameLength = 32
+)
+
+// Token identifies a Cardano native token by its minting policy and asset
+// name.
+//
+// The Cardano channel backend settles channels in Ada only: its allocations
+// hold a single asset and the on-chain contract locks Lovelace. Tokens can
+// therefore be queried and displayed, but proposals and updates over any
+// other asset are rejected until the backend supports them.
+type Token struct {
+	PolicyID  string // PolicyID is the hex-encoded minting policy hash.
+	AssetName string // AssetName is the hex-encoded asset name, may be empty.
+}
+
+// ParseToken parses a token given as "<policy ID>.<asset name>" in hex, as
+// printed by cardano-cli. The asset name and the dot may be omitted.
+func ParseToken(s string) (Token, error) {
+	t := Token{PolicyID: s}
+	if i := strings.Index(s, "."); i >= 0 {
+		t = Token{PolicyID: s[:i], AssetName: s[i+1:]}
+	}
+	t.PolicyID = strings.ToLower(t.PolicyID)
+	t.AssetName = strings.ToLower(t.AssetName)
+	if policy, err := hex.DecodeString(t.PolicyID); err != nil || len(policy) != PolicyIDLength {
+		return Token{}, fmt.Errorf("invalid policy ID %q: expected %d hex-encoded bytes", t.PolicyID, PolicyIDLength)
+	}
+	if name, err := hex.DecodeString(t.AssetName); err != nil || len(name) > MaxAssetNameLength {
+		return Token{}, fmt.Errorf("invalid asset name %q: expected at most %d hex-encoded bytes", t.AssetName, MaxAssetNameLength)
+	}
+	return t, nil
+}
+
+// String returns the token as "<policy ID>.<asset name>".
+func (t Token) String() string {
+	if t.AssetName == "" {
+		return t.PolicyID
+	}
+	return t.PolicyID + "." + t.AssetName
+}
+
+// Name returns the asset name as text if it is printable, otherwise in hex.
+func (t Token) Name() string {
+	name, err := hex.DecodeString(t.AssetName)
+	if err != nil || len(name) == 0 {
+		return t.AssetName
+	}
+	for _, r := range string(name) {
+		if !strconv.IsPrint(r) {
+			return t.AssetName
+		}
+	}
+	return string(name)
+}
+
+// Is reports whether a is an amount of t.
+func (t Token) Is(a cardanowallet.Asset) bool {
+	return strings.EqualFold(a.PolicyID, t.PolicyID) && strings.EqualFold(a.AssetName, t.AssetName)
+}
+
+// TokenBalances queries the available native tokens of the client's wallet.
+func (c *PaymentClient) TokenBalances(ctx context.Context) ([]cardanowallet.Asset, error) {
+	w, err := c.WalletInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return w.Assets.Available, nil
+}
+
+// TokenBalance queries the available amount of the given token in the
+// client's wallet.
+func (c *PaymentClient) TokenBalance(ctx context.Context, t Token) (uint64, error) {
+	assets, err := c.TokenBalances(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var sum uint64
+	for _, a := range assets {
+		if t.Is(a) {
+			sum += a.Quantity
+		}
+	}
+	return sum, nil
+}
+
+// checkAssets checks that the channel assets are supported. The Cardano
+// backend requires exactly one asset, the currency of the client, so
+// channels over native tokens are not supported.
+func (c *PaymentClient) checkAssets(assets []channel.Asset) error {
+	if len(assets) != 1 {
+		return fmt.Errorf("expected exactly one asset, got %d", len(assets))
+	}
+	if !assets[0].Equal(c.currency) {
+		return fmt.Errorf("unsupported asset: the backend only supports Ada channels")
+	}
+	return nil
+}
+
+// formatAmount formats the given amount of a channel asset.
+func formatAmount(a channel.Asset, amount channel.Bal) string {
+	if channel2.Asset.Equal(a) {
+		bal, err := AmountFromBal(amount)
+		if err != nil {
+			return "[green]" + amount.String() + "[white] Lovelace"
+		}
+		return "[green]" + bal.Format(4) + "[white] Ada"
+	}
+	return "[green]" + amount.String() + "[white] units"
+}
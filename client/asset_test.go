@@ -0,0 +1,80 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/perun-cardano-demo/cardanowallet"
+	"perun.network/perun-cardano-demo/client"
+	clienttest "perun.network/perun-cardano-demo/client/test"
+)
+
+const testPolicyID = "65ab82542b0ca20391caaf66a4d4d7897d281f9c136cd3513136945b"
+
+func TestParseToken(t *testing.T) {
+	tok, err := client.ParseToken(testPolicyID + ".5553444D")
+	require.NoError(t, err)
+	require.Equal(t, client.Token{PolicyID: testPolicyID, AssetName: "5553444d"}, tok)
+	require.Equal(t, testPolicyID+".5553444d", tok.String())
+	require.Equal(t, "USDM", tok.Name())
+
+	tok, err = client.ParseToken(testPolicyID)
+	require.NoError(t, err)
+	require.Empty(t, tok.AssetName)
+	require.Equal(t, testPolicyID, tok.String())
+
+	binary, err := client.ParseToken(testPolicyID + ".00ff")
+	require.NoError(t, err)
+	require.Equal(t, "00ff", binary.Name())
+
+	for _, s := range []string{
+		"",
+		"65ab",                  // Policy ID too short.
+		"zz" + testPolicyID[2:], // Policy ID not hex.
+		testPolicyID + ".abc",   // Odd asset name.
+		testPolicyID + "." + testPolicyID + testPolicyID, // Asset name too long.
+	} {
+		_, err := client.ParseToken(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestTokenBalance(t *testing.T) {
+	w := clienttest.NewWallet()
+	defer w.Close()
+	walletID := clienttest.Alice.WalletID
+	usdm := client.Token{PolicyID: testPolicyID, AssetName: "5553444d"}
+	w.SetBalance(walletID, 1)
+	w.SetAssets(walletID,
+		cardanowallet.Asset{PolicyID: testPolicyID, AssetName: "5553444d", Quantity: 1500},
+		cardanowallet.Asset{PolicyID: testPolicyID, AssetName: "6f74686572", Quantity: 3},
+	)
+	c := newWalletClient(t, "A", w.URL())
+
+	bal, err := c.TokenBalance(context.Background(), usdm)
+	require.NoError(t, err)
+	require.EqualValues(t, 1500, bal)
+
+	bal, err = c.TokenBalance(context.Background(), client.Token{PolicyID: testPolicyID})
+	require.NoError(t, err)
+	require.Zero(t, bal)
+
+	assets, err := c.TokenBalances(context.Background())
+	require.NoError(t, err)
+	require.Len(t, assets, 2)
+}
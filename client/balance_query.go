@@ -1,58 +1,102 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
 package client
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
+	"context"
+	"errors"
+	"net"
+
+	"perun.network/perun-cardano-demo/cardanowallet"
 )
 
-type WalletResponse struct {
-	Balance B `json:"balance"`
+// WalletClient returns the cardano-wallet client of the client.
+func (c *PaymentClient) WalletClient() *cardanowallet.Client {
+	return c.wallet
 }
 
-type B struct {
-	Available BalanceResult `json:"available"`
+// QueryBalance queries the available balance of the client's wallet in
+// Lovelace.
+func (c *PaymentClient) QueryBalance(ctx context.Context) (int64, error) {
+	w, err := c.WalletInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return w.Balance.Available.Quantity, nil
 }
 
-type BalanceResult struct {
-	Amount int64  `json:"quantity"`
-	Unit   string `json:"unit"`
+// WalletInfo queries the balances, native assets and sync state of the
+// client's wallet.
+func (c *PaymentClient) WalletInfo(ctx context.Context) (*cardanowallet.Wallet, error) {
+	ctx, cancel := c.opContext(ctx, c.timeouts.Query)
+	defer cancel()
+	w, err := c.wallet.Wallet(ctx, c.Account.GetCardanoWalletID())
+	if err != nil {
+		return nil, newWalletError("query wallet", err)
+	}
+	return w, nil
 }
 
-func (w WalletResponse) Decode() int64 {
-	return w.Balance.Available.Amount
+// UTxOStatistics queries the UTxO distribution of the client's wallet.
+func (c *PaymentClient) UTxOStatistics(ctx context.Context) (*cardanowallet.UTxOStatistics, error) {
+	ctx, cancel := c.opContext(ctx, c.timeouts.Query)
+	defer cancel()
+	s, err := c.wallet.UTxOStatistics(ctx, c.Account.GetCardanoWalletID())
+	if err != nil {
+		return nil, newWalletError("query UTxO statistics", err)
+	}
+	return s, nil
 }
 
-func (c *PaymentClient) QueryBalance() (int64, error) {
-	req, err := http.NewRequest("GET", c.WalletURL.String()+"/wallets/"+c.Account.GetCardanoWalletID(), nil)
+// Transactions queries the on-chain transaction history of the client's
+// wallet.
+func (c *PaymentClient) Transactions(ctx context.Context, q cardanowallet.TransactionQuery) ([]cardanowallet.Transaction, error) {
+	ctx, cancel := c.opContext(ctx, c.timeouts.Query)
+	defer cancel()
+	txs, err := c.wallet.Transactions(ctx, c.Account.GetCardanoWalletID(), q)
 	if err != nil {
-		return 0, err
+		return nil, newWalletError("query transactions", err)
 	}
-	client := &http.Client{}
-	response, err := client.Do(req)
+	return txs, nil
+}
+
+// NetworkInformation queries the sync progress and tips of the node behind
+// the client's wallet server.
+func (c *PaymentClient) NetworkInformation(ctx context.Context) (*cardanowallet.NetworkInformation, error) {
+	ctx, cancel := c.opContext(ctx, c.timeouts.Query)
+	defer cancel()
+	n, err := c.wallet.NetworkInformation(ctx)
 	if err != nil {
-		return 0, err
+		return nil, newWalletError("query network information", err)
 	}
-	defer response.Body.Close()
-	if response.StatusCode != http.StatusOK {
-		errorBody, err := io.ReadAll(response.Body)
-		if err != nil {
-			return 0, fmt.Errorf("failed to interact with wallet server: %s", response.Status)
+	return n, nil
+}
+
+// newWalletError wraps an error of the wallet server. Unreachable servers and
+// server-side failures are classified as ErrWalletUnavailable.
+func newWalletError(op string, err error) error {
+	var kind error
+	var werr *cardanowallet.Error
+	var netErr net.Error
+	switch {
+	case errors.As(err, &werr):
+		if werr.StatusCode >= 500 {
+			kind = ErrWalletUnavailable
 		}
-		return 0, fmt.Errorf(
-			"failed to interact with wallet server: %s with error: %s",
-			response.Status,
-			string(errorBody),
-		)
-	}
-	jsonResponse, err := io.ReadAll(response.Body)
-	if err != nil {
-		return 0, err
-	}
-	var walletResponse WalletResponse
-	if err := json.Unmarshal(jsonResponse, &walletResponse); err != nil {
-		return 0, err
+	case errors.As(err, &netErr):
+		kind = ErrWalletUnavailable
 	}
-	return walletResponse.Decode(), nil
+	return &OpError{Op: op, Kind: kind, Err: err}
 }
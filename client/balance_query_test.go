@@ -1,39 +1,69 @@
 package client_test
 
 import (
+	"context"
 	"encoding/hex"
+	"errors"
 	"github.com/stretchr/testify/require"
 	"perun.network/go-perun/wire"
-	"perun.network/perun-cardano-backend/channel"
-	wallet2 "perun.network/perun-cardano-backend/wallet"
 	"perun.network/perun-cardano-backend/wallet/address"
 	"perun.network/perun-cardano-backend/wallet/test"
+	"perun.network/perun-cardano-demo/cardanowallet"
 	"perun.network/perun-cardano-demo/client"
+	clienttest "perun.network/perun-cardano-demo/client/test"
 	pkgtest "polycry.pt/poly-go/test"
 	"testing"
 )
 
 const (
-	pubKeyAlice         = "5a3aeed83ffe0e41408a41de4cf9e1f1e39416643ea21231a2d00be46f5446a9"
-	walletIDAlice       = "c35896086738b89c00f3ff41f2beced7449fc6e6"
-	cardanoWalletServer = "http://localhost:8090/v2"
+	pubKeyAlice    = "5a3aeed83ffe0e41408a41de4cf9e1f1e39416643ea21231a2d00be46f5446a9"
+	paymentIDAlice = "9706069d2e482d1612cdf062d0d2f9bb3db01ab074f7c3eeb741bcd4"
+	walletIDAlice  = "c35896086738b89c00f3ff41f2beced7449fc6e6"
 )
 
-// The wallet server must be running for this test!
 func TestBalanceQuery(t *testing.T) {
+	w := clienttest.NewWallet()
+	defer w.Close()
+	w.SetBalance(walletIDAlice, 420133769)
+
 	rng := pkgtest.Prng(t)
 	addrBytes, err := hex.DecodeString(pubKeyAlice)
 	require.NoError(t, err)
 	addr, err := address.MakeAddressFromPubKeyByteSlice(addrBytes)
 	require.NoError(t, err)
+	require.NoError(t, addr.SetPaymentPubKeyHashFromHexString(paymentIDAlice))
 	r := test.NewGenericRemote([]address.Address{addr}, rng)
-	w := wallet2.NewRemoteWallet(r, walletIDAlice)
-	acc, err := w.Unlock(&addr)
-	require.NoError(t, err)
 	bus := wire.NewLocalBus()
-	c, err := client.SetupPaymentClient("Alice", bus, acc.(wallet2.RemoteAccount), "", w, channel.Asset, cardanoWalletServer)
+	c, err := client.SetupPaymentClient("Alice", bus, "", pubKeyAlice, paymentIDAlice, walletIDAlice, r, w.URL())
 	require.NoError(t, err)
-	b, err := c.QueryBalance()
+	defer c.Shutdown()
+	b, err := c.QueryBalance(context.Background())
 	require.NoError(t, err)
 	require.Equal(t, int64(420133769), b)
+
+	asset := cardanowallet.Asset{PolicyID: "65ab82542b0ca20391caaf66a4d4d7897d281f9c136cd3513136945b", AssetName: "746f6b656e", Quantity: 7}
+	w.SetAssets(walletIDAlice, asset)
+	info, err := c.WalletInfo(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []cardanowallet.Asset{asset}, info.Assets.Available)
+	require.True(t, info.State.Ready())
+	stats, err := c.UTxOStatistics(context.Background())
+	require.NoError(t, err)
+	require.EqualValues(t, 1, stats.Count())
+	network, err := c.NetworkInformation(context.Background())
+	require.NoError(t, err)
+	require.True(t, network.SyncProgress.Ready())
+
+	unknown := clienttest.NewWallet()
+	defer unknown.Close()
+	c, err = client.SetupPaymentClient("Alice", wire.NewLocalBus(), "", pubKeyAlice, paymentIDAlice, walletIDAlice, r, unknown.URL())
+	require.NoError(t, err)
+	defer c.Shutdown()
+	_, err = c.QueryBalance(context.Background())
+	require.True(t, cardanowallet.IsCode(err, cardanowallet.CodeNoSuchWallet))
+	require.False(t, errors.Is(err, client.ErrWalletUnavailable))
+
+	unknown.Close()
+	_, err = c.QueryBalance(context.Background())
+	require.True(t, errors.Is(err, client.ErrWalletUnavailable))
 }
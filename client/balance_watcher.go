@@ -0,0 +1,247 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// BalanceConfig configures a BalanceWatcher. Zero durations select the
+// defaults.
+type BalanceConfig struct {
+	Interval   time.Duration // Interval between two queries of a wallet.
+	MaxBackoff time.Duration // MaxBackoff bounds the interval after failed queries.
+	// RefreshOnEvents queries the balance as soon as a channel is funded,
+	// settled or changed on-chain, in addition to the periodic queries.
+	RefreshOnEvents bool
+	// Log is the logger of the watcher. By default, the standard logrus
+	// logger is used.
+	Log logrus.FieldLogger
+}
+
+// DefaultBalanceConfig returns the default balance watcher configuration.
+func DefaultBalanceConfig() BalanceConfig {
+	return BalanceConfig{
+		Interval:   10 * time.Second,
+		MaxBackoff: 2 * time.Minute,
+	}
+}
+
+// BalanceWatcher keeps the on-chain balances of payment clients up to date.
+// Each wallet is queried periodically, once for all clients sharing it. After
+// a failed query, the interval doubles up to the maximum backoff. The watcher
+// stops when its context is canceled.
+type BalanceWatcher struct {
+	cfg BalanceConfig
+	ctx context.Context
+
+	mutex   sync.Mutex
+	wallets map[string]*watchedWallet
+}
+
+// watchedWallet is a wallet queried on behalf of one or more clients.
+type watchedWallet struct {
+	key     string
+	clients []*PaymentClient
+	trigger chan struct{}
+	cancel  context.CancelFunc
+	known   bool // known reports whether balance was queried successfully.
+	balance int64
+}
+
+// NewBalanceWatcher returns a balance watcher that runs until ctx is
+// canceled.
+func NewBalanceWatcher(ctx context.Context, cfg BalanceConfig) *BalanceWatcher {
+	def := DefaultBalanceConfig()
+	if cfg.Interval <= 0 {
+		cfg.Interval = def.Interval
+	}
+	if cfg.MaxBackoff < cfg.Interval {
+		cfg.MaxBackoff = cfg.Interval
+	}
+	if cfg.Log == nil {
+		cfg.Log = logrus.StandardLogger()
+	}
+	return &BalanceWatcher{
+		cfg:     cfg,
+		ctx:     ctx,
+		wallets: make(map[string]*watchedWallet),
+	}
+}
+
+// WithBalanceWatcher makes the client report its balance through the given
+// watcher, which may be shared between clients. By default, every client
+// uses its own watcher with the default configuration.
+func WithBalanceWatcher(w *BalanceWatcher) Option {
+	return func(c *PaymentClient) {
+		c.balances = w
+	}
+}
+
+// walletKey identifies the wallet of c across clients.
+func walletKey(c *PaymentClient) string {
+	return c.WalletURL.String() + "/wallets/" + c.Account.GetCardanoWalletID()
+}
+
+// Watch starts watching the balance of c. If another client shares its
+// wallet, c receives the balance queried for that client.
+func (w *BalanceWatcher) Watch(c *PaymentClient) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	key := walletKey(c)
+	if ww, ok := w.wallets[key]; ok {
+		ww.clients = append(ww.clients, c)
+		if ww.known {
+			c.setBalance(ww.balance)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithCancel(w.ctx)
+	ww := &watchedWallet{
+		key:     key,
+		clients: []*PaymentClient{c},
+		trigger: make(chan struct{}, 1),
+		cancel:  cancel,
+	}
+	w.wallets[key] = ww
+	go w.run(ctx, ww)
+}
+
+// Unwatch stops watching the balance of c. The wallet is no longer queried
+// once no client uses it.
+func (w *BalanceWatcher) Unwatch(c *PaymentClient) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	ww, ok := w.wallets[walletKey(c)]
+	if !ok {
+		return
+	}
+	for i, wc := range ww.clients {
+		if wc == c {
+			ww.clients = append(ww.clients[:i], ww.clients[i+1:]...)
+			break
+		}
+	}
+	if len(ww.clients) == 0 {
+		ww.cancel()
+		delete(w.wallets, ww.key)
+	}
+}
+
+// Refresh queries the balance of c immediately if the watcher refreshes on
+// events. A refresh that is already pending is not repeated.
+func (w *BalanceWatcher) Refresh(c *PaymentClient) {
+	if !w.cfg.RefreshOnEvents {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if ww, ok := w.wallets[walletKey(c)]; ok {
+		select {
+		case ww.trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run queries the wallet until ctx is canceled.
+func (w *BalanceWatcher) run(ctx context.Context, ww *watchedWallet) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-ww.trigger:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		}
+
+		err := w.query(ctx, ww)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			if failures == 0 {
+				w.cfg.Log.WithField("wallet", ww.key).WithError(err).Warn("Querying balance failed, backing off")
+			}
+			failures++
+		case failures > 0:
+			w.cfg.Log.WithField("wallet", ww.key).Info("Querying balance succeeded again")
+			failures = 0
+		}
+		timer.Reset(w.backoff(failures))
+	}
+}
+
+// query queries the balance of the wallet and reports it to its clients.
+func (w *BalanceWatcher) query(ctx context.Context, ww *watchedWallet) error {
+	w.mutex.Lock()
+	if len(ww.clients) == 0 {
+		w.mutex.Unlock()
+		return nil
+	}
+	c := ww.clients[0]
+	w.mutex.Unlock()
+
+	bal, err := c.QueryBalance(ctx)
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	ww.known, ww.balance = true, bal
+	for _, c := range ww.clients {
+		c.setBalance(bal)
+	}
+	return nil
+}
+
+// backoff returns the delay before the next query after the given number of
+// consecutive failures.
+func (w *BalanceWatcher) backoff(failures int) time.Duration {
+	d := w.cfg.Interval
+	for i := 0; i < failures && d < w.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > w.cfg.MaxBackoff {
+		return w.cfg.MaxBackoff
+	}
+	return d
+}
+
+// setBalance updates the balance and notifies the observers if it changed.
+func (c *PaymentClient) setBalance(bal int64) {
+	c.balanceMutex.Lock()
+	defer c.balanceMutex.Unlock()
+	if bal != c.balance {
+		c.balance = bal
+		c.NotifyAllBalance(bal)
+	}
+}
+
+// refreshBalance requests a balance query after an on-chain event.
+func (c *PaymentClient) refreshBalance() {
+	c.balances.Refresh(c)
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/wire"
+	"perun.network/perun-cardano-backend/wallet/address"
+	"perun.network/perun-cardano-backend/wallet/test"
+	"perun.network/perun-cardano-demo/client"
+	clienttest "perun.network/perun-cardano-demo/client/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+// newWalletClient sets up a client for Alice that only talks to the given
+// wallet server.
+func newWalletClient(t *testing.T, name, walletURL string, opts ...client.Option) *client.PaymentClient {
+	t.Helper()
+	p := clienttest.Alice
+	r := test.NewGenericRemote([]address.Address{p.Address(t)}, pkgtest.Prng(t))
+	c, err := client.SetupPaymentClient(name, wire.NewLocalBus(), "", p.PublicKey, p.PaymentIdentifier, p.WalletID, r, walletURL, opts...)
+	require.NoError(t, err)
+	t.Cleanup(c.Shutdown)
+	return c
+}
+
+func TestBalanceWatcherSharedWallet(t *testing.T) {
+	w := clienttest.NewWallet()
+	defer w.Close()
+	walletID := clienttest.Alice.WalletID
+	w.SetBalance(walletID, 42)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bw := client.NewBalanceWatcher(ctx, client.BalanceConfig{Interval: time.Hour, RefreshOnEvents: true})
+	a := newWalletClient(t, "A", w.URL(), client.WithBalanceWatcher(bw))
+	require.Eventually(t, func() bool { return a.GetBalance() == 42 }, time.Second, time.Millisecond)
+
+	// The second client shares the wallet and reuses its balance.
+	b := newWalletClient(t, "B", w.URL(), client.WithBalanceWatcher(bw))
+	require.EqualValues(t, 42, b.GetBalance())
+	require.Equal(t, 1, w.Queries(walletID))
+
+	// A refresh queries the wallet once for both clients.
+	w.SetBalance(walletID, 43)
+	bw.Refresh(b)
+	require.Eventually(t, func() bool {
+		return a.GetBalance() == 43 && b.GetBalance() == 43
+	}, time.Second, time.Millisecond)
+	require.Equal(t, 2, w.Queries(walletID))
+}
+
+func TestBalanceWatcherBackoff(t *testing.T) {
+	w := clienttest.NewWallet() // The wallet of Alice is unknown.
+	defer w.Close()
+	walletID := clienttest.Alice.WalletID
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bw := client.NewBalanceWatcher(ctx, client.BalanceConfig{Interval: 10 * time.Millisecond, MaxBackoff: 40 * time.Millisecond})
+	newWalletClient(t, "A", w.URL(), client.WithBalanceWatcher(bw))
+
+	// Without backoff, the wallet would be queried about 30 times.
+	time.Sleep(300 * time.Millisecond)
+	queries := w.Queries(walletID)
+	require.GreaterOrEqual(t, queries, 3)
+	require.LessOrEqual(t, queries, 12)
+
+	// The watcher stops with its context.
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	queries = w.Queries(walletID)
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, queries, w.Queries(walletID))
+}
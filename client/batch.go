@@ -0,0 +1,132 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"perun.network/go-perun/channel"
+)
+
+// Transfer is a payment to the channel peer within a batch.
+type Transfer struct {
+	Amount Amount
+	Memo   string // Memo is recorded with the transfer, see WithMemo.
+}
+
+// Batch is a set of transfers to the channel peer that are applied
+// atomically in a single channel update. Either all transfers are made or
+// none.
+type Batch struct {
+	Transfers []Transfer
+	// Finalize finalizes the channel in the same update, so that it can be
+	// settled right away. A batch without transfers only finalizes.
+	Finalize bool
+	// Expect makes the batch conditional. If it is set, the update is only
+	// made if the channel still matches it, and fails with ErrConflict
+	// otherwise. Updates of the peer are rejected until the batch is sent.
+	Expect *Expectation
+}
+
+// Expectation is the channel state a conditional batch is based on. It
+// guards against double-spending races of concurrent payment workers that
+// compute their payments from the same state: only the first of them
+// succeeds, the others get ErrConflict and can retry with the new state.
+type Expectation struct {
+	Version     uint64
+	OwnBalance  Amount
+	PeerBalance Amount
+}
+
+// ExpectState returns the expectation that the channel is still in the given
+// state, e.g. PaymentChannel.State. It fails if a balance does not fit into
+// an Amount.
+func (c *PaymentChannel) ExpectState(state *channel.State) (*Expectation, error) {
+	idx := c.Idx()
+	own, err := AmountFromBal(state.Allocation.Balance(idx, c.currency))
+	if err != nil {
+		return nil, err
+	}
+	peer, err := AmountFromBal(state.Allocation.Balance(1-idx, c.currency))
+	if err != nil {
+		return nil, err
+	}
+	return &Expectation{Version: state.Version, OwnBalance: own, PeerBalance: peer}, nil
+}
+
+// check returns an error describing the mismatch if state does not match e.
+// A nil expectation matches every state.
+func (e *Expectation) check(state *channel.State, idx channel.Index, currency channel.Asset) error {
+	if e == nil {
+		return nil
+	}
+	own := state.Allocation.Balance(idx, currency)
+	peer := state.Allocation.Balance(1-idx, currency)
+	switch {
+	case state.Version != e.Version:
+		return fmt.Errorf("expected version %d, channel is at version %d", e.Version, state.Version)
+	case own.Cmp(e.OwnBalance.Bal()) != 0 || peer.Cmp(e.PeerBalance.Bal()) != 0:
+		return fmt.Errorf("expected balances %v/%v Lovelace, channel has %v/%v Lovelace",
+			e.OwnBalance.Lovelace(), e.PeerBalance.Lovelace(), own, peer)
+	case state.IsFinal:
+		return fmt.Errorf("channel is final")
+	}
+	return nil
+}
+
+// SendBatch sends the transfers of the batch to the channel peer in a single
+// channel update and records each of them in the ledger with the version of
+// the update. The memos are announced to the peer together, as the memo of
+// the total amount. A conditional batch fails with ErrConflict if the channel
+// does not match its expectation.
+func (c *PaymentChannel) SendBatch(ctx context.Context, b Batch) error {
+	if len(b.Transfers) == 0 && !b.Finalize {
+		return &OpError{Op: "send batch", Kind: ErrInvalidAmount, Err: fmt.Errorf("empty batch")}
+	}
+	ps := make([]Payment, len(b.Transfers))
+	var memos []string
+	info := c.newPayment(0)
+	for i, t := range b.Transfers {
+		if t.Amount <= 0 {
+			return &OpError{Op: "send batch", Kind: ErrInvalidAmount, Err: fmt.Errorf("transfer %d: %v", i, t.Amount)}
+		}
+		ps[i] = c.newPayment(t.Amount)
+		ps[i].Memo = t.Memo
+		info.Amount += t.Amount
+		if t.Memo != "" {
+			memos = append(memos, t.Memo)
+		}
+	}
+	info.Memo = strings.Join(memos, "; ")
+	return c.send(ctx, "send batch", ps, info, b.Finalize, b.Expect)
+}
+
+// SendBatch sends the batch in the channel with the given ID, see
+// PaymentChannel.SendBatch. Errors are also reported to the observers.
+func (c *PaymentClient) SendBatch(ctx context.Context, id channel.ID, b Batch) error {
+	if !c.ops.begin() {
+		return c.notifyError(&OpError{Op: "send batch", Kind: ErrShuttingDown, Err: ErrShuttingDown})
+	}
+	defer c.ops.end()
+	ch, err := c.Channel(id)
+	if err != nil {
+		return c.notifyError(err)
+	}
+	ctx, cancel := c.opContext(ctx, c.timeouts.Update)
+	defer cancel()
+	return c.notifyError(ch.SendBatch(ctx, b))
+}
@@ -4,90 +4,322 @@ import (
 	"context"
 	"encoding/hex"
 	"fmt"
-	"math/big"
+	"github.com/sirupsen/logrus"
 	"perun.network/go-perun/channel"
 	"perun.network/go-perun/client"
+	"perun.network/go-perun/wire"
 	"perun.network/perun-cardano-backend/wallet/address"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // PaymentChannel is a wrapper for a Perun channel for the payment use case.
 type PaymentChannel struct {
 	ch       *client.Channel
 	currency channel.Asset
+	pending  int32 // pending is the number of outgoing payments in flight.
+	settling int32 // settling is 1 while the channel is settled or withdrawn.
+	// conditional is 1 while a conditional update is sent. Updates of the
+	// peer are rejected meanwhile.
+	conditional int32
+	ledger      *Ledger
+	owner       *PaymentClient // owner sends side messages to the peer.
+	log         logrus.FieldLogger
+
+	mutex     sync.Mutex
+	phase     ChannelPhase
+	sendMutex sync.Mutex     // sendMutex serializes our outgoing channel updates.
+	stream    *paymentStream // stream is the current or last payment stream, guarded by mutex.
 }
 
+// FormatState formats the state of the channel for display. The balances
+// are listed per party and asset.
 func FormatState(c *PaymentChannel, state *channel.State) string {
 	id := c.ch.ID()
 	parties := c.ch.Params().Parts
-	balA, _ := LovelaceToAda(state.Allocation.Balance(0, c.currency)).Float64()
-	balAStr := strconv.FormatFloat(balA, 'f', 4, 64)
-
-	fstPartyPaymentAddr := hex.EncodeToString(parties[0].(*address.Address).GetPubKeyHashSlice())
-	sndPartyPaymentAddr := hex.EncodeToString(parties[1].(*address.Address).GetPubKeyHashSlice())
-
-	balB, _ := LovelaceToAda(state.Allocation.Balance(1, c.currency)).Float64()
-	balBStr := strconv.FormatFloat(balB, 'f', 4, 64)
 	if len(parties) != 2 {
 		panic("invalid parties length: " + strconv.Itoa(len(parties)))
 	}
-	ret := fmt.Sprintf(
-		"Channel ID: [green]%s[white]\nBalances:\n    %s: [green]%s[white] Ada\n    %s: [green]%s[white] Ada\nFinal: [green]%t[white]\nVersion: [green]%d[white]",
+
+	var bals strings.Builder
+	for idx, p := range parties {
+		amounts := make([]string, len(state.Allocation.Assets))
+		for i, a := range state.Allocation.Assets {
+			amounts[i] = formatAmount(a, state.Allocation.Balances[i][idx])
+		}
+		fmt.Fprintf(&bals, "    %s: %s\n",
+			hex.EncodeToString(p.(*address.Address).GetPubKeyHashSlice()),
+			strings.Join(amounts, ", "),
+		)
+	}
+	return fmt.Sprintf(
+		"Channel ID: [green]%s[white]\nBalances:\n%sFinal: [green]%t[white]\nVersion: [green]%d[white]",
 		hex.EncodeToString(id[:]),
-		fstPartyPaymentAddr,
-		balAStr,
-		sndPartyPaymentAddr,
-		balBStr,
+		bals.String(),
 		state.IsFinal,
 		state.Version,
 	)
-	return ret
 }
 
-// newPaymentChannel creates a new payment channel.
-func newPaymentChannel(ch *client.Channel, currency channel.Asset) *PaymentChannel {
+// newPaymentChannel creates a new payment channel of owner that records its
+// payments in the ledger of owner.
+func newPaymentChannel(ch *client.Channel, owner *PaymentClient) *PaymentChannel {
+	id := ch.ID()
 	return &PaymentChannel{
 		ch:       ch,
-		currency: currency,
+		currency: owner.currency,
+		ledger:   owner.ledger,
+		owner:    owner,
+		log:      owner.log.WithField(LogFieldChannel, hex.EncodeToString(id[:])),
 	}
 }
 
-// SendPayment sends a payment to the channel peer.
-func (c PaymentChannel) SendPayment(amount float64) {
-	// Transfer the given amount from us to peer.
-	// Use UpdateBy to update the channel state.
-	err := c.ch.Update(context.TODO(), func(state *channel.State) { // We use context.TODO to keep the code simple.
-		lovelaceAmount := AdaToLovelace(big.NewFloat(amount))
-		actor := c.ch.Idx()
+// ID returns the ID of the channel.
+func (c *PaymentChannel) ID() channel.ID {
+	return c.ch.ID()
+}
+
+// Idx returns our index in the channel.
+func (c *PaymentChannel) Idx() channel.Index {
+	return c.ch.Idx()
+}
+
+// Peer returns the off-chain address of the channel peer.
+func (c *PaymentChannel) Peer() wire.Address {
+	return c.ch.Peers()[1-c.ch.Idx()]
+}
+
+// Params returns the channel parameters.
+func (c *PaymentChannel) Params() *channel.Params {
+	return c.ch.Params()
+}
+
+// State returns a copy of the current channel state.
+func (c *PaymentChannel) State() *channel.State {
+	return c.ch.State().Clone()
+}
+
+// Currency returns the asset the channel is denominated in.
+func (c *PaymentChannel) Currency() channel.Asset {
+	return c.currency
+}
+
+// Phase returns the on-chain phase of the channel.
+func (c *PaymentChannel) Phase() ChannelPhase {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.phase
+}
+
+func (c *PaymentChannel) setPhase(p ChannelPhase) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.phase = p
+}
+
+// startSettling marks the channel as being settled. It returns false if it
+// already is.
+func (c *PaymentChannel) startSettling() bool {
+	return atomic.CompareAndSwapInt32(&c.settling, 0, 1)
+}
+
+// stopSettling marks the channel as no longer being settled, e.g. after a
+// failed attempt.
+func (c *PaymentChannel) stopSettling() {
+	atomic.StoreInt32(&c.settling, 0)
+}
+
+// PendingPayments returns the number of outgoing payments in flight.
+func (c *PaymentChannel) PendingPayments() int {
+	return int(atomic.LoadInt32(&c.pending))
+}
+
+// sendingConditional returns whether a conditional update is being sent.
+func (c *PaymentChannel) sendingConditional() bool {
+	return atomic.LoadInt32(&c.conditional) == 1
+}
+
+// PaymentOption configures an outgoing payment.
+type PaymentOption func(*Payment)
+
+// WithMemo attaches a memo to the payment. The memo is recorded in the
+// ledgers of both parties.
+func WithMemo(memo string) PaymentOption {
+	return func(p *Payment) {
+		p.Memo = memo
+	}
+}
+
+// SendPayment sends a payment to the channel peer and records it in the
+// ledger. The invoice and memo of the payment are sent to the peer before
+// the channel update.
+func (c *PaymentChannel) SendPayment(ctx context.Context, amount Amount, opts ...PaymentOption) error {
+	if amount <= 0 {
+		return &OpError{Op: "send payment", Kind: ErrInvalidAmount, Err: fmt.Errorf("%v", amount)}
+	}
+	p := c.newPayment(amount)
+	for _, opt := range opts {
+		opt(&p)
+	}
+	return c.send(ctx, "send payment", []Payment{p}, p, false, nil)
+}
+
+// newPayment returns an outgoing payment of amount in the channel.
+func (c *PaymentChannel) newPayment(amount Amount) Payment {
+	return Payment{
+		ChannelID: c.ID(),
+		Amount:    amount,
+		Direction: PaymentSent,
+		Signer:    partyID(c.ch.Params().Parts[c.ch.Idx()]),
+	}
+}
+
+// send transfers the total amount of the payments to the peer in one channel
+// update and records them in the ledger. The update also finalizes the
+// channel if finalize is set. If expect is not nil, the update is only made
+// if the channel matches it. The invoice and memo of info are announced to
+// the peer before the update.
+func (c *PaymentChannel) send(ctx context.Context, op string, ps []Payment, info Payment, finalize bool, expect *Expectation) error {
+	atomic.AddInt32(&c.pending, 1)
+	defer atomic.AddInt32(&c.pending, -1)
+	var total Amount
+	for _, p := range ps {
+		var err error
+		if total, err = total.Add(p.Amount); err != nil {
+			return &OpError{Op: op, Kind: ErrInvalidAmount, Err: err}
+		}
+	}
+
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+	if expect != nil {
+		// Our own updates are serialized by sendMutex and the peer's are
+		// rejected from now on. Reading the state waits for a peer update
+		// that is being accepted, so the expectation holds until the update.
+		atomic.StoreInt32(&c.conditional, 1)
+		defer atomic.StoreInt32(&c.conditional, 0)
+	}
+	actor := c.ch.Idx()
+	cur := c.ch.State()
+	if bal := cur.Allocation.Balance(actor, c.currency); bal.Cmp(total.Bal()) < 0 {
+		return &OpError{
+			Op:   op,
+			Kind: ErrInsufficientBalance,
+			Err:  fmt.Errorf("cannot send %v Lovelace with a balance of %v Lovelace", total.Lovelace(), bal),
+		}
+	}
+	if err := expect.check(cur, actor, c.currency); err != nil {
+		return &OpError{Op: op, Kind: ErrConflict, Err: err}
+	}
+
+	announced, err := c.announcePayment(ctx, info)
+	if err != nil {
+		return err
+	}
+
+	// Transfer the total amount from us to peer.
+	var version uint64
+	err = c.ch.Update(ctx, func(state *channel.State) {
 		peer := 1 - actor
-		state.Allocation.TransferBalance(actor, peer, c.currency, lovelaceAmount)
+		state.Allocation.TransferBalance(actor, peer, c.currency, total.Bal())
+		state.IsFinal = state.IsFinal || finalize
+		version = state.Version + 1 // The version is increased after the update.
 	})
 	if err != nil {
-		panic(err)
+		return newOpError(op, err)
 	}
-	if err != nil {
-		panic(err) // We panic on error to keep the code simple.
+	if announced != nil && announced.Version != version {
+		// A concurrent update of the peer took the announced version.
+		c.log.WithField(LogFieldVersion, version).Warn("Payment was sent without invoice and memo")
+	}
+
+	now := time.Now()
+	for _, p := range ps {
+		p.Version = version
+		p.Time = now
+		if err := c.ledger.Record(p); err != nil {
+			c.log.WithError(err).Error("Recording payment failed")
+		}
 	}
+	return nil
 }
 
-// Settle settles the payment channel and withdraws the funds.
-func (c PaymentChannel) Settle() {
+// announcePayment sends the invoice and memo of p to the peer, if any. The
+// announcement is valid for the next channel version only, so the caller
+// must hold sendMutex until the payment is sent.
+func (c *PaymentChannel) announcePayment(ctx context.Context, p Payment) (*paymentInfoMsg, error) {
+	if p.Invoice == "" && p.Memo == "" {
+		return nil, nil
+	}
+	info := &paymentInfoMsg{
+		ChannelID: p.ChannelID,
+		Version:   c.ch.State().Version + 1,
+		Amount:    p.Amount,
+		Invoice:   p.Invoice,
+		Memo:      p.Memo,
+	}
+	if err := c.owner.publish(ctx, c.Peer(), info); err != nil {
+		return nil, newOpError("send payment info", err)
+	}
+	return info, nil
+}
+
+// Payments returns the recorded payments of the channel in the order they
+// were made.
+func (c *PaymentChannel) Payments() []Payment {
+	return c.ledger.Payments(PaymentFilter{ChannelID: c.ID()})
+}
+
+// Settle settles the payment channel and withdraws the funds. It fails with
+// ErrSettling if the channel is already being settled, e.g. because it was
+// concluded on-chain and the client withdraws the funds automatically.
+func (c *PaymentChannel) Settle(ctx context.Context) error {
+	if !c.startSettling() {
+		return &OpError{Op: "settle channel", Kind: ErrSettling, Err: ErrSettling}
+	}
+	// Payments of a stream would race with the finalization.
+	if st, ok := c.Stream(); ok && st.State == StreamRunning {
+		_, _ = c.StopStream()
+	}
 	// Finalize the channel to enable fast settlement.
-	if !c.ch.State().IsFinal {
-		err := c.ch.Update(context.TODO(), func(state *channel.State) {
-			state.IsFinal = true
-		})
-		if err != nil {
-			panic(err)
-		}
+	if err := c.finalize(ctx); err != nil {
+		c.stopSettling()
+		return newOpError("finalize channel", err)
 	}
 
+	if err := c.withdraw(ctx); err != nil {
+		c.stopSettling()
+		return err
+	}
+	return nil
+}
+
+// finalize finalizes the channel, unless it is already final or no longer
+// open.
+func (c *PaymentChannel) finalize(ctx context.Context) error {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+	if c.ch.State().IsFinal || c.Phase() != PhaseOpen {
+		return nil
+	}
+	return c.ch.Update(ctx, func(state *channel.State) {
+		state.IsFinal = true
+	})
+}
+
+// withdraw concludes the channel if necessary, withdraws the funds and
+// closes the channel.
+func (c *PaymentChannel) withdraw(ctx context.Context) error {
 	// Settle concludes the channel and withdraws the funds.
-	err := c.ch.Settle(context.TODO(), false)
+	err := c.ch.Settle(ctx, false)
 	if err != nil {
-		panic(err)
+		return newOpError("settle channel", err)
 	}
 
 	// Close frees up channel resources.
 	c.ch.Close()
+	return nil
 }
@@ -19,10 +19,10 @@ import (
 	"encoding/hex"
 	"fmt"
 	"github.com/pkg/errors"
-	"log"
-	"math/big"
+	"github.com/sirupsen/logrus"
 	"net/url"
 	"perun.network/go-perun/channel"
+	"perun.network/go-perun/channel/persistence"
 	"perun.network/go-perun/client"
 	"perun.network/go-perun/wallet"
 	"perun.network/go-perun/watcher/local"
@@ -31,27 +31,49 @@ import (
 	channel2 "perun.network/perun-cardano-backend/channel"
 	wallet2 "perun.network/perun-cardano-backend/wallet"
 	"perun.network/perun-cardano-backend/wallet/address"
+	"perun.network/perun-cardano-demo/cardanowallet"
 	tuiclient "perun.network/perun-demo-tui/client"
 	"polycry.pt/poly-go/sync"
-	"strconv"
-	"time"
+	"sync/atomic"
 )
 
 // PaymentClient is a payment channel client.
 type PaymentClient struct {
-	observerMutex sync.Mutex
-	balanceMutex  sync.Mutex
-	Name          string
-	PerunClient   *client.Client // The core Perun client.
-	Channel       *PaymentChannel
-	Account       wallet2.RemoteAccount // The Account we use for on-chain and off-chain transactions.
-	wAddr         wire.Address          // The address we use for off-chain communication.
-	currency      channel.Asset         // The currency we expect to get paid in.
-	channels      chan *PaymentChannel  // Accepted payment channels.
-	onUpdate      func(from, to *channel.State)
-	observers     []tuiclient.Observer
-	WalletURL     *url.URL
-	balance       int64
+	observerMutex     sync.Mutex
+	balanceMutex      sync.Mutex
+	Name              string
+	PerunClient       *client.Client        // The core Perun client.
+	adj               *adjudicator          // adj disputes and force-closes channels.
+	Account           wallet2.RemoteAccount // The Account we use for on-chain and off-chain transactions.
+	wAddr             wire.Address          // The address we use for off-chain communication.
+	currency          channel.Asset         // The currency we expect to get paid in.
+	channels          *channelRegistry      // Open payment channels.
+	onUpdate          func(from, to *channel.State)
+	observers         []tuiclient.Observer
+	lastState         string // Text representation of the last notified state.
+	timeouts          Timeouts
+	challengeDuration uint64                      // challengeDuration of proposed channels in seconds.
+	events            *eventHistory               // events records on-chain channel events.
+	ledger            *Ledger                     // ledger records the payments.
+	invoices          *invoiceBook                // invoices holds our invoices and the payment information of peers.
+	bus               *sideBus                    // bus carries side messages such as payment information.
+	persister         persistence.PersistRestorer // persister persists channels, may be nil.
+	proposalPolicy    ProposalPolicy
+	prompts           *ProposalQueue // prompts holds proposals awaiting a user decision.
+	updatePolicy      UpdatePolicy
+	requestPolicy     RequestPolicy
+	requests          *RequestQueue // requests holds payment requests awaiting a user decision.
+	clock             Clock         // clock drives the payment streams.
+	updateAuditors    []UpdateAuditor
+	log               logrus.FieldLogger // log is annotated with the client name.
+	ops               operations         // ops tracks in-flight operations and goroutines.
+	stopped           int32              // stopped is set once Shutdown was called.
+	ctx               context.Context    // ctx is canceled on Shutdown.
+	cancel            context.CancelFunc // cancel cancels ctx.
+	WalletURL         *url.URL
+	balance           int64
+	balances          *BalanceWatcher // balances keeps balance up to date.
+	wallet            *cardanowallet.Client
 }
 
 // WalletAddress returns the wallet address of the client.
@@ -72,33 +94,120 @@ func (c *PaymentClient) DisplayAddress() string {
 	return hex.EncodeToString(c.Account.AccountAddress.GetPubKeyHashSlice())
 }
 
-func (c *PaymentClient) SendPaymentToPeer(amount float64) {
-	if !c.HasOpenChannel() {
-		return
+// Channels returns all open channels in order of opening.
+func (c *PaymentClient) Channels() []*PaymentChannel {
+	return c.channels.list()
+}
+
+// ChannelsWithPeer returns all open channels with the given peer in order of
+// opening.
+func (c *PaymentClient) ChannelsWithPeer(peer wire.Address) []*PaymentChannel {
+	return c.channels.withPeer(peer)
+}
+
+// Channel returns the open channel with the given ID.
+func (c *PaymentClient) Channel(id channel.ID) (*PaymentChannel, error) {
+	ch, ok := c.channels.get(id)
+	if !ok {
+		return nil, &OpError{Op: "look up channel", Kind: ErrNoChannel, Err: fmt.Errorf("unknown channel %x", id)}
 	}
-	c.Channel.SendPayment(amount)
+	return ch, nil
 }
 
-func (c *PaymentClient) Settle() {
-	if !c.HasOpenChannel() {
-		return
+// LatestChannel returns the most recently opened channel that is still open.
+func (c *PaymentClient) LatestChannel() (*PaymentChannel, error) {
+	ch, ok := c.channels.latest()
+	if !ok {
+		return nil, &OpError{Op: "look up channel", Kind: ErrNoChannel, Err: ErrNoChannel}
+	}
+	return ch, nil
+}
+
+// SendPayment sends a payment in the channel with the given ID. Errors are
+// also reported to the observers.
+func (c *PaymentClient) SendPayment(ctx context.Context, id channel.ID, amount Amount, opts ...PaymentOption) error {
+	if !c.ops.begin() {
+		return c.notifyError(&OpError{Op: "send payment", Kind: ErrShuttingDown, Err: ErrShuttingDown})
+	}
+	defer c.ops.end()
+	ch, err := c.Channel(id)
+	if err != nil {
+		return c.notifyError(err)
+	}
+	ctx, cancel := c.opContext(ctx, c.timeouts.Update)
+	defer cancel()
+	return c.notifyError(ch.SendPayment(ctx, amount, opts...))
+}
+
+// SettleChannel settles the channel with the given ID and removes it from the
+// open channels. Errors are also reported to the observers.
+func (c *PaymentClient) SettleChannel(ctx context.Context, id channel.ID) error {
+	if !c.ops.begin() {
+		return c.notifyError(&OpError{Op: "settle channel", Kind: ErrShuttingDown, Err: ErrShuttingDown})
+	}
+	defer c.ops.end()
+	return c.settleChannel(ctx, id)
+}
+
+// settleChannel settles the channel with the given ID. Unlike SettleChannel,
+// it does not start an operation, so that it can be used while shutting down.
+func (c *PaymentClient) settleChannel(ctx context.Context, id channel.ID) error {
+	ch, err := c.Channel(id)
+	if err != nil {
+		return c.notifyError(err)
+	}
+	ctx, cancel := c.opContext(ctx, c.timeouts.Settle)
+	defer cancel()
+	if err := ch.Settle(ctx); err != nil {
+		return c.notifyError(err)
+	}
+	c.channels.remove(id)
+	c.refreshBalance()
+	return nil
+}
+
+// SendPaymentToPeer sends a payment in the latest open channel. Errors are also
+// reported to the observers.
+func (c *PaymentClient) SendPaymentToPeer(ctx context.Context, amount Amount, opts ...PaymentOption) error {
+	ch, err := c.LatestChannel()
+	if err != nil {
+		return c.notifyError(err)
 	}
-	c.Channel.Settle()
+	return c.SendPayment(ctx, ch.ID(), amount, opts...)
 }
 
+// Settle settles the latest open channel. Errors are also reported to the
+// observers.
+func (c *PaymentClient) Settle(ctx context.Context) error {
+	ch, err := c.LatestChannel()
+	if err != nil {
+		return c.notifyError(err)
+	}
+	return c.SettleChannel(ctx, ch.ID())
+}
+
+// HasOpenChannel returns whether the client has at least one open channel.
 func (c *PaymentClient) HasOpenChannel() bool {
-	return c.Channel != nil
+	return c.channels.len() > 0
 }
 
 func (c *PaymentClient) Register(observer tuiclient.Observer) {
-	log.Printf("Registering observer %s on client %s", observer.GetID().String(), c.Name)
+	c.log.WithField("observer", observer.GetID().String()).Debug("Registering observer")
 	c.observerMutex.Lock()
 	defer c.observerMutex.Unlock()
 	c.observers = append(c.observers, observer)
-	if c.Channel != nil {
-		observer.UpdateState(FormatState(c.Channel, c.Channel.ch.State().Clone()))
+	bal := c.GetBalance()
+	for _, ch := range c.channels.list() {
+		state := ch.State()
+		observer.UpdateState(FormatState(ch, state))
+		if o, ok := observer.(DataObserver); ok {
+			o.UpdateChannel(ch, state)
+		}
+	}
+	observer.UpdateBalance(FormatBalance(Amount(bal)))
+	if o, ok := observer.(DataObserver); ok {
+		o.UpdateLovelaceBalance(bal)
 	}
-	observer.UpdateBalance(FormatBalance(c.GetBalance()))
 }
 
 func (c *PaymentClient) Deregister(observer tuiclient.Observer) {
@@ -113,43 +222,85 @@ func (c *PaymentClient) Deregister(observer tuiclient.Observer) {
 	}
 }
 
+// NotifyAllState notifies all observers about the new state of the channel
+// with ID to.ID.
 func (c *PaymentClient) NotifyAllState(_, to *channel.State) {
+	ch, ok := c.channels.get(to.ID)
+	if !ok {
+		return
+	}
+	c.notifyAllState(ch, to)
+}
+
+func (c *PaymentClient) notifyAllState(ch *PaymentChannel, to *channel.State) {
 	c.observerMutex.Lock()
 	defer c.observerMutex.Unlock()
-	str := FormatState(c.Channel, to)
+	str := FormatState(ch, to)
+	c.lastState = str
 	for _, o := range c.observers {
 		o.UpdateState(str)
+		if o, ok := o.(DataObserver); ok {
+			o.UpdateChannel(ch, to)
+		}
 	}
 }
 
-func FormatBalance(bal int64) string {
-	balBig := big.NewInt(bal)
-	balAda, _ := LovelaceToAda(balBig).Float64()
-	balString := strconv.FormatFloat(balAda, 'f', 6, 64)
-	return balString
+// NotifyAllError reports err to all observers. Text observers are shown the
+// last state together with the error.
+func (c *PaymentClient) NotifyAllError(err error) {
+	c.observerMutex.Lock()
+	defer c.observerMutex.Unlock()
+	str := fmt.Sprintf("[red]Error: %v[white]", err)
+	if c.lastState != "" {
+		str = c.lastState + "\n\n" + str
+	}
+	for _, o := range c.observers {
+		o.UpdateState(str)
+		if o, ok := o.(DataObserver); ok {
+			o.UpdateError(err)
+		}
+	}
 }
 
-func (c *PaymentClient) NotifyAllBalance(bal int64) {
-	str := FormatBalance(bal)
+// NotifyAllRejection reports a rejected proposal or update to all observers.
+// Text observers are shown the last state together with the rejection.
+func (c *PaymentClient) NotifyAllRejection(r *Rejection) {
+	c.observerMutex.Lock()
+	defer c.observerMutex.Unlock()
+	str := fmt.Sprintf("[yellow]Rejected %s: %v[white]", r.Item, r.RejectionError)
+	if c.lastState != "" {
+		str = c.lastState + "\n\n" + str
+	}
 	for _, o := range c.observers {
-		o.UpdateBalance(str)
+		o.UpdateState(str)
+		if o, ok := o.(RejectionObserver); ok {
+			o.UpdateRejection(r)
+		}
 	}
 }
 
-func (c *PaymentClient) PollBalances() {
-	for {
-		time.Sleep(1 * time.Second)
-		bal, err := c.QueryBalance()
-		if err != nil {
-			log.Println("Error getting balance: ", err)
-			continue
-		}
-		c.balanceMutex.Lock()
-		if bal != c.balance {
-			c.balance = bal
-			c.NotifyAllBalance(bal)
+// notifyError logs and reports err to all observers if it is not nil, and
+// returns it.
+func (c *PaymentClient) notifyError(err error) error {
+	if err != nil {
+		c.log.WithError(err).Error("Operation failed")
+		c.NotifyAllError(err)
+	}
+	return err
+}
+
+// FormatBalance formats bal in Ada with six decimal places.
+func FormatBalance(bal Amount) string {
+	return bal.Format(AdaDecimals)
+}
+
+func (c *PaymentClient) NotifyAllBalance(bal int64) {
+	str := FormatBalance(Amount(bal))
+	for _, o := range c.observers {
+		o.UpdateBalance(str)
+		if o, ok := o.(DataObserver); ok {
+			o.UpdateLovelaceBalance(bal)
 		}
-		c.balanceMutex.Unlock()
 	}
 }
 
@@ -159,7 +310,7 @@ func (c *PaymentClient) GetBalance() int64 {
 	return c.balance
 }
 
-// setupPaymentClient sets up a new client with the given parameters.
+// SetupPaymentClient sets up a new client with the given parameters.
 func SetupPaymentClient(
 	name string,
 	bus wire.Bus,
@@ -169,23 +320,27 @@ func SetupPaymentClient(
 	walletId string,
 	r wallet2.Remote,
 	cardanoWalletServerURL string,
-) *PaymentClient {
-	pubKeyBytes, _ := hex.DecodeString(pubKey)
-	addr, _ := address.MakeAddressFromPubKeyByteSlice(pubKeyBytes)
-	_ = addr.SetPaymentPubKeyHashFromHexString(paymentIdentifier)
-
-	w := wallet2.NewRemoteWallet(r, walletId)
-	acc, err := w.Unlock(&addr)
+	opts ...Option,
+) (*PaymentClient, error) {
+	pubKeyBytes, err := hex.DecodeString(pubKey)
 	if err != nil {
-		log.Fatalf("error unlocking alice's account: %v", err)
+		return nil, fmt.Errorf("decoding public key: %w", err)
+	}
+	addr, err := address.MakeAddressFromPubKeyByteSlice(pubKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := addr.SetPaymentPubKeyHashFromHexString(paymentIdentifier); err != nil {
+		return nil, fmt.Errorf("decoding payment identifier: %w", err)
 	}
 
-	c, err := setupPaymentClient(name, bus, acc.(wallet2.RemoteAccount), pabHost, w, channel2.Asset, cardanoWalletServerURL)
+	w := wallet2.NewRemoteWallet(r, walletId)
+	acc, err := w.Unlock(&addr)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("unlocking account of %s: %w", name, err)
 	}
 
-	return c
+	return setupPaymentClient(name, bus, acc.(wallet2.RemoteAccount), pabHost, w, channel2.Asset, cardanoWalletServerURL, opts...)
 }
 
 // SetupPaymentClient creates a new payment client.
@@ -197,116 +352,181 @@ func setupPaymentClient(
 	wallet *wallet2.RemoteWallet,
 	asset channel.Asset,
 	cardanoWalletServerURL string,
+	opts ...Option,
 ) (*PaymentClient, error) {
 	walletUrl, err := url.Parse(cardanoWalletServerURL)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse cardano wallet server url: %w", err)
 	}
+	walletClient, err := cardanowallet.New(cardanoWalletServerURL)
+	if err != nil {
+		return nil, err
+	}
 	pab, err := channel2.NewPAB(pabHost, acc)
+	if err != nil {
+		return nil, &OpError{Op: "connect to PAB", Kind: ErrPABUnavailable, Err: err}
+	}
+
 	// Setup funder
 
 	funder := channel2.NewFunder(pab)
 
 	// Setup adjudicator.
-	adjudicator := channel2.NewAdjudicator(pab)
+	adj := newAdjudicator(pab, acc.GetCardanoWalletID())
 
 	// Setup dispute watcher.
-	watcher, err := local.NewWatcher(adjudicator)
+	watcher, err := local.NewWatcher(adj)
 	if err != nil {
 		return nil, fmt.Errorf("intializing watcher: %w", err)
 	}
 
 	wAddr := simple.NewAddress(acc.Address().String())
-	// Setup Perun client.
-	perunClient, err := client.New(wAddr, bus, funder, adjudicator, wallet, watcher)
+	// Setup Perun client. Side messages are diverted from it.
+	sb := newSideBus(bus)
+	perunClient, err := client.New(wAddr, sb, funder, adj, wallet, watcher)
 	if err != nil {
 		return nil, errors.WithMessage(err, "creating client")
 	}
 
 	// Create client and start request handler.
+	ctx, cancel := context.WithCancel(context.Background())
 	c := &PaymentClient{
-		Name:        name,
-		PerunClient: perunClient,
-		Account:     acc,
-		wAddr:       wAddr,
-		currency:    asset,
-		channels:    make(chan *PaymentChannel, 1),
-		WalletURL:   walletUrl,
-		balance:     0,
-	}
-	go c.PollBalances()
+		Name:              name,
+		PerunClient:       perunClient,
+		adj:               adj,
+		Account:           acc,
+		wAddr:             wAddr,
+		currency:          asset,
+		channels:          newChannelRegistry(),
+		WalletURL:         walletUrl,
+		wallet:            walletClient,
+		balance:           0,
+		timeouts:          DefaultTimeouts(),
+		challengeDuration: DefaultChallengeDuration,
+		events:            newEventHistory(),
+		ledger:            NewLedger(),
+		invoices:          newInvoiceBook(),
+		bus:               sb,
+		proposalPolicy:    EqualFunding,
+		updatePolicy:      ConsistentUpdates,
+		requestPolicy:     DeclineRequests,
+		clock:             SystemClock,
+		log:               logrus.StandardLogger(),
+		ctx:               ctx,
+		cancel:            cancel,
+	}
+	c.prompts = newProposalQueue(c.notifyProposalPending)
+	c.requests = newRequestQueue(c.notifyRequestPending)
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.log = c.log.WithField(LogFieldClient, name)
+	sb.setHandler(c.handleSideMsg)
+	if c.balances == nil {
+		c.balances = NewBalanceWatcher(ctx, DefaultBalanceConfig())
+	}
+	if c.persister != nil {
+		if err := c.restore(ctx); err != nil {
+			c.Shutdown()
+			return nil, err
+		}
+	}
+	c.balances.Watch(c)
 	go perunClient.Handle(c, c)
 
 	return c, nil
 }
 
-// OpenChannel opens a new channel with the specified peer and funding.
-func (c *PaymentClient) OpenChannel(peer wire.Address, amount float64) {
+// OpenChannel opens a new channel with the specified peer in which we deposit
+// the given amount. By default, the peer deposits the same amount; use
+// WithPeerDeposit and WithChallengeDuration to change the proposal. Errors
+// are also reported to the observers.
+func (c *PaymentClient) OpenChannel(ctx context.Context, peer wire.Address, deposit Amount, opts ...OpenOption) (*PaymentChannel, error) {
+	if !c.ops.begin() {
+		return nil, c.notifyError(&OpError{Op: "open channel", Kind: ErrShuttingDown, Err: ErrShuttingDown})
+	}
+	defer c.ops.end()
+	ctx, cancel := c.opContext(ctx, c.timeouts.Open)
+	defer cancel()
+	ch, err := c.openChannel(ctx, peer, deposit, opts)
+	return ch, c.notifyError(err)
+}
+
+func (c *PaymentClient) openChannel(ctx context.Context, peer wire.Address, deposit Amount, opts []OpenOption) (*PaymentChannel, error) {
+	params, err := c.openParams(deposit, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	// We define the channel participants. The proposer always has index 0. Here
 	// we use the on-chain addresses as off-chain addresses, but we could also
 	// use different ones.
-	log.Println("OpenChannel called")
+	log := c.log.WithField(LogFieldPeer, formatPeer(peer))
+	log.Debug("Opening channel")
 	participants := []wire.Address{c.WireAddress(), peer}
 
 	// We create an initial allocation which defines the starting balances.
 	initAlloc := channel.NewAllocation(2, c.currency)
 	initAlloc.SetAssetBalances(c.currency, []channel.Bal{
-		AdaToLovelace(big.NewFloat(amount)), // Our initial balance.
-		AdaToLovelace(big.NewFloat(amount)), // Peer's initial balance.
+		params.ownDeposit.Bal(),  // Our initial balance.
+		params.peerDeposit.Bal(), // Peer's initial balance.
 	})
-	log.Println("Created Allocation")
 
 	// Prepare the channel proposal by defining the channel parameters.
-	challengeDuration := uint64(10) // On-chain challenge duration in seconds.
 	proposal, err := client.NewLedgerChannelProposal(
-		challengeDuration,
+		params.challengeDuration, // On-chain challenge duration in seconds.
 		c.Account.Address(),
 		initAlloc,
 		participants,
 	)
 	if err != nil {
-		panic(err)
+		return nil, newOpError("create channel proposal", err)
 	}
 
-	log.Println("Created Proposal")
-
 	// Send the proposal.
-	ch, err := c.PerunClient.ProposeChannel(context.TODO(), proposal)
+	ch, err := c.PerunClient.ProposeChannel(ctx, proposal)
 	if err != nil {
-		panic(err)
+		return nil, newOpError("open channel", err)
 	}
 
-	log.Println("Sent Channel")
-
 	// Start the on-chain event watcher. It automatically handles disputes.
 	c.startWatching(ch)
 
-	log.Println("Started Watching")
-
-	c.Channel = newPaymentChannel(ch, c.currency)
-	c.Channel.ch.OnUpdate(c.NotifyAllState)
-	c.NotifyAllState(nil, ch.State())
+	pc := c.addChannel(ch)
+	c.channelLog(pc, ch.State()).Info("Opened channel")
+	c.refreshBalance()
+	return pc, nil
 }
 
 // startWatching starts the dispute watcher for the specified channel.
 func (c *PaymentClient) startWatching(ch *client.Channel) {
-	go func() {
+	c.ops.goroutine(func() {
+		// If the channel is closed before the watcher registered it, go-perun
+		// watches a nil subscription. This happens if the client shuts down
+		// right after opening a channel.
+		defer func() {
+			if r := recover(); r != nil {
+				if atomic.LoadInt32(&c.stopped) == 0 {
+					panic(r)
+				}
+				c.channelIDLog(ch.ID()).Warnf("Watcher stopped during shutdown: %v", r)
+			}
+		}()
 		err := ch.Watch(c)
 		if err != nil {
-			fmt.Printf("Watcher returned with error: %v", err)
+			c.notifyError(fmt.Errorf("watcher returned with error: %w", err))
 		}
-	}()
-}
-
-// AcceptedChannel returns the next accepted channel.
-func (c *PaymentClient) AcceptedChannel() *PaymentChannel {
-	c.Channel = <-c.channels
-	c.Channel.ch.OnUpdate(c.NotifyAllState)
-	c.NotifyAllState(nil, c.Channel.ch.State())
-	return c.Channel
+	})
 }
 
-// Shutdown gracefully shuts down the client.
-func (c *PaymentClient) Shutdown() {
-	c.PerunClient.Close()
+// addChannel registers a newly opened channel and notifies the observers. It
+// returns the already registered channel if ch is known.
+func (c *PaymentClient) addChannel(ch *client.Channel) *PaymentChannel {
+	pc, added := c.channels.add(newPaymentChannel(ch, c))
+	if !added {
+		return pc
+	}
+	ch.OnUpdate(func(_, to *channel.State) { c.notifyAllState(pc, to) })
+	c.notifyAllState(pc, ch.State())
+	return pc
 }
@@ -0,0 +1,71 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"strconv"
+
+	"perun.network/go-perun/wire"
+	tuiclient "perun.network/perun-demo-tui/client"
+)
+
+// DemoAdapter adapts a PaymentClient to the tuiclient.DemoClient interface of
+// the demo UI. The PaymentClient reports failed operations to its observers,
+// so the UI shows them and the adapter can discard the returned errors.
+type DemoAdapter struct {
+	*PaymentClient
+}
+
+var _ tuiclient.DemoClient = (*DemoAdapter)(nil)
+
+// NewDemoAdapter returns a DemoAdapter for c.
+func NewDemoAdapter(c *PaymentClient) *DemoAdapter {
+	return &DemoAdapter{PaymentClient: c}
+}
+
+// OpenChannel opens a channel with the given peer.
+func (a *DemoAdapter) OpenChannel(peer wire.Address, amount float64) {
+	amt, err := a.amount(amount)
+	if err != nil {
+		return
+	}
+	_, _ = a.PaymentClient.OpenChannel(context.Background(), peer, amt)
+}
+
+// SendPaymentToPeer sends a payment in the open channel.
+func (a *DemoAdapter) SendPaymentToPeer(amount float64) {
+	amt, err := a.amount(amount)
+	if err != nil {
+		return
+	}
+	_ = a.PaymentClient.SendPaymentToPeer(context.Background(), amt)
+}
+
+// amount converts an amount in Ada entered in the demo UI. The UI parses
+// user input as float64, so the shortest decimal representation of the float
+// is the number the user typed, which is then parsed exactly.
+func (a *DemoAdapter) amount(ada float64) (Amount, error) {
+	amt, err := ParseAmount(strconv.FormatFloat(ada, 'f', -1, 64))
+	if err != nil {
+		return 0, a.notifyError(&OpError{Op: "parse amount", Kind: ErrInvalidAmount, Err: err})
+	}
+	return amt, nil
+}
+
+// Settle settles the open channel.
+func (a *DemoAdapter) Settle() {
+	_ = a.PaymentClient.Settle(context.Background())
+}
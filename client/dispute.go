@@ -0,0 +1,232 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"perun.network/go-perun/channel"
+)
+
+// ChannelPhase is the on-chain phase of a channel as observed by the client.
+type ChannelPhase int
+
+// Phases of a channel.
+const (
+	// PhaseOpen is the phase of a funded channel without on-chain dispute.
+	PhaseOpen ChannelPhase = iota
+	// PhaseDisputed is the phase of a channel with a state registered
+	// on-chain whose challenge period may not be over yet.
+	PhaseDisputed
+	// PhaseConcluded is the phase of a channel concluded on-chain. Its funds
+	// can be withdrawn.
+	PhaseConcluded
+)
+
+func (p ChannelPhase) String() string {
+	switch p {
+	case PhaseOpen:
+		return "open"
+	case PhaseDisputed:
+		return "disputed"
+	case PhaseConcluded:
+		return "concluded"
+	}
+	return fmt.Sprintf("ChannelPhase(%d)", int(p))
+}
+
+// EventKind is the kind of an on-chain channel event.
+type EventKind string
+
+// Kinds of on-chain channel events.
+const (
+	// EventRegistered is emitted when a state is registered on-chain, which
+	// starts the challenge period.
+	EventRegistered EventKind = "registered"
+	// EventProgressed is emitted when a registered state is progressed
+	// on-chain.
+	EventProgressed EventKind = "progressed"
+	// EventConcluded is emitted when a channel is concluded on-chain.
+	EventConcluded EventKind = "concluded"
+)
+
+// ChannelEvent is an on-chain event of a channel as recorded by the client.
+type ChannelEvent struct {
+	ChannelID channel.ID
+	Kind      EventKind
+	Version   uint64    // Version is the on-chain version of the channel.
+	Latest    uint64    // Latest is our latest off-chain version, if the channel is open.
+	Timeout   time.Time // Timeout is the end of the current phase, zero if elapsed or unknown.
+	Time      time.Time // Time is when the client handled the event.
+}
+
+// Stale returns whether the event registered an outdated state, i.e. a peer
+// tried to close the channel on an old state. The watcher refutes such
+// registrations with the latest state.
+func (e ChannelEvent) Stale() bool {
+	return e.Kind == EventRegistered && e.Version < e.Latest
+}
+
+// String returns a human-readable description of the event.
+func (e ChannelEvent) String() string {
+	id := hex.EncodeToString(e.ChannelID[:])
+	switch e.Kind {
+	case EventRegistered:
+		if e.Stale() {
+			return fmt.Sprintf("Outdated version %d of channel %s registered on-chain, latest is %d. Refuting with the latest state, challenge period ends %s.",
+				e.Version, id, e.Latest, e.formatTimeout())
+		}
+		return fmt.Sprintf("Channel %s disputed on-chain with version %d. Challenge period ends %s.", id, e.Version, e.formatTimeout())
+	case EventProgressed:
+		return fmt.Sprintf("Channel %s progressed on-chain to version %d. Phase ends %s.", id, e.Version, e.formatTimeout())
+	case EventConcluded:
+		return fmt.Sprintf("Channel %s concluded on-chain with version %d.", id, e.Version)
+	}
+	return fmt.Sprintf("Channel %s: %s event at version %d.", id, e.Kind, e.Version)
+}
+
+// formatTimeout formats the timeout relative to the time of the event.
+func (e ChannelEvent) formatTimeout() string {
+	if e.Timeout.IsZero() || !e.Timeout.After(e.Time) {
+		return "now"
+	}
+	return fmt.Sprintf("at %s (in %v)", e.Timeout.Format("15:04:05"), e.Timeout.Sub(e.Time).Round(time.Second))
+}
+
+// timeoutTime returns the time at which t elapses. It returns the zero time
+// for timeouts that are elapsed or of unknown type.
+func timeoutTime(t channel.Timeout) time.Time {
+	if t, ok := t.(*channel.TimeTimeout); ok {
+		return t.Time
+	}
+	return time.Time{}
+}
+
+// eventHistory records the on-chain events of all channels of a client. It
+// keeps the events of channels that are already closed.
+type eventHistory struct {
+	mutex  sync.Mutex
+	events map[channel.ID][]ChannelEvent
+}
+
+func newEventHistory() *eventHistory {
+	return &eventHistory{events: make(map[channel.ID][]ChannelEvent)}
+}
+
+func (h *eventHistory) add(e ChannelEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.events[e.ChannelID] = append(h.events[e.ChannelID], e)
+}
+
+func (h *eventHistory) get(id channel.ID) []ChannelEvent {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]ChannelEvent(nil), h.events[id]...)
+}
+
+// ChannelEvents returns the on-chain events of the channel with the given ID
+// in the order they were handled. Events of closed channels are kept.
+func (c *PaymentClient) ChannelEvents(id channel.ID) []ChannelEvent {
+	return c.events.get(id)
+}
+
+// HandleAdjudicatorEvent is the callback for smart contract events. It
+// records the event, updates the phase of the channel and notifies the
+// observers. Once a channel is concluded, our funds are withdrawn unless we
+// are already settling the channel.
+func (c *PaymentClient) HandleAdjudicatorEvent(e channel.AdjudicatorEvent) {
+	ev := ChannelEvent{
+		ChannelID: e.ID(),
+		Version:   e.Version(),
+		Timeout:   timeoutTime(e.Timeout()),
+		Time:      time.Now(),
+	}
+	var phase ChannelPhase
+	switch e.(type) {
+	case *channel.RegisteredEvent:
+		ev.Kind, phase = EventRegistered, PhaseDisputed
+	case *channel.ProgressedEvent:
+		ev.Kind, phase = EventProgressed, PhaseDisputed
+	case *channel.ConcludedEvent:
+		ev.Kind, phase = EventConcluded, PhaseConcluded
+	default:
+		c.channelIDLog(e.ID()).Warnf("Ignoring adjudicator event of type %T", e)
+		return
+	}
+	log := c.channelIDLog(ev.ChannelID)
+	ch, ok := c.channels.get(ev.ChannelID)
+	if ok {
+		state := ch.State()
+		ev.Latest = state.Version
+		ch.setPhase(phase)
+		log = c.channelLog(ch, state)
+	}
+	c.events.add(ev)
+	log.WithFields(logrus.Fields{"event": ev.Kind, "event_version": ev.Version}).Info(ev)
+	c.NotifyAllChannelEvent(ev)
+
+	if ok && ev.Kind == EventConcluded {
+		c.withdrawConcluded(ch)
+	}
+	c.refreshBalance()
+}
+
+// withdrawConcluded withdraws our funds from a concluded channel and removes
+// it from the open channels. Nothing happens if the channel is being settled
+// already, e.g. because we concluded it ourselves.
+func (c *PaymentClient) withdrawConcluded(ch *PaymentChannel) {
+	if !ch.startSettling() {
+		return
+	}
+	ctx, cancel := c.opContext(context.Background(), c.timeouts.Settle)
+	defer cancel()
+	if err := ch.withdraw(ctx); err != nil {
+		ch.stopSettling()
+		c.notifyError(err)
+		return
+	}
+	c.channelLog(ch, nil).Info("Withdrew funds of concluded channel")
+	c.channels.remove(ch.ID())
+}
+
+// NotifyAllChannelEvent reports an on-chain channel event to all observers.
+// Text observers are shown the last state together with a description of the
+// event.
+func (c *PaymentClient) NotifyAllChannelEvent(e ChannelEvent) {
+	c.observerMutex.Lock()
+	defer c.observerMutex.Unlock()
+	color := "[yellow]"
+	if e.Stale() {
+		color = "[red]"
+	} else if e.Kind == EventConcluded {
+		color = "[green]"
+	}
+	str := color + e.String() + "[white]"
+	if c.lastState != "" {
+		str = c.lastState + "\n\n" + str
+	}
+	for _, o := range c.observers {
+		o.UpdateState(str)
+		if o, ok := o.(ChannelEventObserver); ok {
+			o.UpdateChannelEvent(e)
+		}
+	}
+}
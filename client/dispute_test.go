@@ -0,0 +1,53 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/channel"
+	"perun.network/perun-cardano-demo/client"
+)
+
+func TestChannelEvent(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	e := client.ChannelEvent{
+		ChannelID: channel.ID{0xab},
+		Kind:      client.EventRegistered,
+		Version:   2,
+		Latest:    5,
+		Timeout:   now.Add(90 * time.Second),
+		Time:      now,
+	}
+	require.True(t, e.Stale())
+	require.Contains(t, e.String(), "Outdated version 2 of channel ab00")
+	require.Contains(t, e.String(), "latest is 5")
+	require.Contains(t, e.String(), "ends at 12:01:30 (in 1m30s)")
+
+	e.Version = 5
+	require.False(t, e.Stale())
+	require.Contains(t, e.String(), "disputed on-chain with version 5")
+
+	e.Kind = client.EventConcluded
+	e.Version = 2
+	require.False(t, e.Stale(), "only registrations are stale")
+
+	e.Kind, e.Timeout = client.EventProgressed, time.Time{}
+	require.Contains(t, e.String(), "Phase ends now")
+
+	require.Equal(t, "disputed", client.PhaseDisputed.String())
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"net"
+
+	"perun.network/go-perun/client"
+)
+
+// Error kinds of failed operations. Use errors.Is to check whether an error
+// returned by the payment client is of a given kind.
+var (
+	// ErrNoChannel is returned if an operation requires an open channel.
+	ErrNoChannel = errors.New("no open channel")
+	// ErrInvalidAmount is returned for non-positive payments and negative or
+	// missing deposits.
+	ErrInvalidAmount = errors.New("invalid amount")
+	// ErrInvalidParams is returned for invalid channel parameters, e.g. a
+	// zero challenge duration.
+	ErrInvalidParams = errors.New("invalid channel parameters")
+	// ErrInsufficientBalance is returned if a payment exceeds our channel
+	// balance.
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	// ErrPeerRejected is returned if the peer rejected a proposal or update.
+	ErrPeerRejected = errors.New("rejected by peer")
+	// ErrPABUnavailable is returned if the PAB could not be reached.
+	ErrPABUnavailable = errors.New("PAB unavailable")
+	// ErrWalletUnavailable is returned if the cardano-wallet server could not
+	// be reached or failed to answer.
+	ErrWalletUnavailable = errors.New("wallet server unavailable")
+	// ErrSettling is returned when settling a channel that is already being
+	// settled or withdrawn.
+	ErrSettling = errors.New("channel is being settled")
+	// ErrUnknownProposal is returned when deciding on a proposal that is not
+	// pending.
+	ErrUnknownProposal = errors.New("unknown proposal")
+	// ErrShuttingDown is returned for operations started while the client
+	// shuts down.
+	ErrShuttingDown = errors.New("client is shutting down")
+	// ErrUnknownInvoice is returned when looking up an invoice that does not
+	// exist.
+	ErrUnknownInvoice = errors.New("unknown invoice")
+	// ErrUnknownRequest is returned when deciding on a payment request that
+	// is not pending.
+	ErrUnknownRequest = errors.New("unknown payment request")
+	// ErrStreamRunning is returned when starting a payment stream in a
+	// channel that already streams.
+	ErrStreamRunning = errors.New("payment stream running")
+	// ErrNoStream is returned when stopping the payment stream of a channel
+	// that never streamed.
+	ErrNoStream = errors.New("no payment stream")
+	// ErrConflict is returned by conditional payments if the channel does
+	// not match the expected state.
+	ErrConflict = errors.New("channel state conflict")
+)
+
+// OpError is returned by failed channel operations. It wraps the underlying
+// error and classifies it with one of the error kinds above.
+type OpError struct {
+	Op   string // Op is the failed operation, e.g. "open channel".
+	Kind error  // Kind is one of the error kinds above, or nil if unknown.
+	Err  error
+}
+
+func (e *OpError) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the kind of e.
+func (e *OpError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// newOpError wraps err for the given operation and classifies it.
+func newOpError(op string, err error) error {
+	return &OpError{Op: op, Kind: classifyError(err), Err: err}
+}
+
+// classifyError determines the kind of an error returned by go-perun or the
+// Cardano backend.
+func classifyError(err error) error {
+	for _, kind := range []error{
+		ErrNoChannel, ErrInvalidAmount, ErrInvalidParams, ErrInsufficientBalance, ErrPeerRejected, ErrPABUnavailable, ErrWalletUnavailable,
+		ErrSettling, ErrUnknownProposal, ErrShuttingDown, ErrUnknownInvoice, ErrUnknownRequest,
+		ErrStreamRunning, ErrNoStream, ErrConflict,
+	} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+
+	var rejected client.PeerRejectedError
+	if errors.As(err, &rejected) {
+		return ErrPeerRejected
+	}
+	// Funding errors do not unwrap, so we inspect the cause explicitly.
+	var funding *client.ChannelFundingError
+	if errors.As(err, &funding) {
+		return classifyError(funding.Err)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrPABUnavailable
+	}
+	return nil
+}
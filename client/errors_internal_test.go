@@ -0,0 +1,118 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/channel"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/client"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestClassifyError(t *testing.T) {
+	netErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	for _, tc := range []struct {
+		name string
+		err  error
+		kind error
+	}{
+		{"kind", ErrInsufficientBalance, ErrInsufficientBalance},
+		{"wrapped kind", fmt.Errorf("sending: %w", ErrInvalidAmount), ErrInvalidAmount},
+		{"op error", &OpError{Op: "settle", Kind: ErrSettling, Err: errors.New("withdrawing")}, ErrSettling},
+		{"nested op error", newOpError("send batch", &OpError{Op: "send payment", Kind: ErrConflict, Err: errors.New("stale")}), ErrConflict},
+		{"peer rejected", pkgerrors.WithStack(client.PeerRejectedError{ItemType: "channel update", Reason: "no"}), ErrPeerRejected},
+		{"funding", &client.ChannelFundingError{Err: netErr}, ErrPABUnavailable},
+		{"funding unknown", &client.ChannelFundingError{Err: errors.New("out of gas")}, nil},
+		{"network", fmt.Errorf("querying: %w", netErr), ErrPABUnavailable},
+		{"unknown", errors.New("boom"), nil},
+		{"nil", nil, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.kind, classifyError(tc.err))
+		})
+	}
+}
+
+func TestOpError(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := error(&OpError{Op: "open channel", Kind: ErrPABUnavailable, Err: cause})
+	require.EqualError(t, err, "open channel: connection refused")
+	require.ErrorIs(t, err, ErrPABUnavailable)
+	require.ErrorIs(t, err, cause)
+	require.False(t, errors.Is(err, ErrPeerRejected))
+
+	wrapped := fmt.Errorf("demo: %w", err)
+	require.ErrorIs(t, wrapped, ErrPABUnavailable)
+	var opErr *OpError
+	require.True(t, errors.As(wrapped, &opErr))
+	require.Equal(t, "open channel", opErr.Op)
+
+	require.False(t, errors.Is(newOpError("query", errors.New("boom")), ErrPABUnavailable),
+		"unclassified errors have no kind")
+}
+
+func TestOperationErrors(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	c, _ := newTestClient(chtest.NewRandomAsset(rng))
+	c.challengeDuration = 60
+	ctx := context.Background()
+	unknown := channel.ID{1}
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		kind error
+	}{
+		{"payment in unknown channel", c.SendPayment(ctx, unknown, Ada), ErrNoChannel},
+		{"batch in unknown channel", c.SendBatch(ctx, unknown, Batch{Transfers: []Transfer{{Amount: Ada}}}), ErrNoChannel},
+		{"settle unknown channel", c.SettleChannel(ctx, unknown), ErrNoChannel},
+		{"payment without channel", c.SendPaymentToPeer(ctx, Ada), ErrNoChannel},
+		{"negative deposit", openErr(c.OpenChannel(ctx, nil, -Ada)), ErrInvalidAmount},
+		{"negative peer deposit", openErr(c.OpenChannel(ctx, nil, Ada, WithPeerDeposit(-1))), ErrInvalidAmount},
+		{"no deposits", openErr(c.OpenChannel(ctx, nil, 0)), ErrInvalidAmount},
+		{"zero challenge duration", openErr(c.OpenChannel(ctx, nil, Ada, WithChallengeDuration(0))), ErrInvalidParams},
+		{"unknown proposal", c.DecideProposal("nope", true, ""), ErrUnknownProposal},
+		{"unknown request", c.DecideRequest("nope", true, ""), ErrUnknownRequest},
+		{"unknown invoice", invoiceErr(c.Invoice("nope")), ErrUnknownInvoice},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.ErrorIs(t, tc.err, tc.kind)
+			var opErr *OpError
+			require.True(t, errors.As(tc.err, &opErr), "%T is not an OpError", tc.err)
+		})
+	}
+
+	// Operations fail once the client shuts down.
+	require.NoError(t, c.ops.drain(ctx))
+	require.ErrorIs(t, c.SendPayment(ctx, unknown, Ada), ErrShuttingDown)
+	require.ErrorIs(t, c.SendBatch(ctx, unknown, Batch{Finalize: true}), ErrShuttingDown)
+	require.ErrorIs(t, openErr(c.OpenChannel(ctx, nil, Ada)), ErrShuttingDown)
+	require.ErrorIs(t, c.ForceClose(ctx, unknown), ErrShuttingDown)
+	require.ErrorIs(t, c.StartStream(unknown, Ada, time.Second, 0), ErrShuttingDown)
+	require.ErrorIs(t, c.SettleChannel(ctx, unknown), ErrShuttingDown)
+}
+
+func openErr(_ *PaymentChannel, err error) error { return err }
+
+func invoiceErr(_ Invoice, err error) error { return err }
@@ -0,0 +1,188 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"perun.network/go-perun/channel"
+)
+
+// ForceCloseStage is a stage of force-closing a channel.
+type ForceCloseStage string
+
+// Stages of force-closing a channel.
+const (
+	// ForceCloseRegistering is reported when our latest state is registered
+	// on-chain.
+	ForceCloseRegistering ForceCloseStage = "registering"
+	// ForceCloseWaiting is reported while waiting for the end of the
+	// challenge period.
+	ForceCloseWaiting ForceCloseStage = "waiting"
+	// ForceCloseWithdrawing is reported when the channel is closed on-chain
+	// and the funds are withdrawn.
+	ForceCloseWithdrawing ForceCloseStage = "withdrawing"
+	// ForceCloseDone is reported once the funds are withdrawn.
+	ForceCloseDone ForceCloseStage = "done"
+	// ForceCloseFailed is reported if force-closing failed.
+	ForceCloseFailed ForceCloseStage = "failed"
+)
+
+// ForceCloseProgress reports the progress of force-closing a channel.
+type ForceCloseProgress struct {
+	ChannelID channel.ID
+	Stage     ForceCloseStage
+	Timeout   time.Time // Timeout is the end of the challenge period while waiting.
+	Err       error     // Err is set if force-closing failed.
+	Time      time.Time
+}
+
+// String returns a human-readable description of the progress.
+func (p ForceCloseProgress) String() string {
+	id := hex.EncodeToString(p.ChannelID[:])
+	switch p.Stage {
+	case ForceCloseRegistering:
+		return fmt.Sprintf("Force-closing channel %s: registering the latest state on-chain.", id)
+	case ForceCloseWaiting:
+		wait := "now"
+		if p.Timeout.After(p.Time) {
+			wait = fmt.Sprintf("at %s (in %v)", p.Timeout.Format("15:04:05"), p.Timeout.Sub(p.Time).Round(time.Second))
+		}
+		return fmt.Sprintf("Force-closing channel %s: challenge period ends %s.", id, wait)
+	case ForceCloseWithdrawing:
+		return fmt.Sprintf("Force-closing channel %s: withdrawing funds.", id)
+	case ForceCloseDone:
+		return fmt.Sprintf("Force-closed channel %s.", id)
+	case ForceCloseFailed:
+		return fmt.Sprintf("Force-closing channel %s failed: %v", id, p.Err)
+	}
+	return fmt.Sprintf("Force-closing channel %s: %s.", id, p.Stage)
+}
+
+// ForceClose closes the channel with the given ID without the cooperation of
+// the peer. It registers our latest state on-chain, waits until the challenge
+// period is over and withdraws the funds. The progress is reported to the
+// observers. Errors are also reported to the observers.
+//
+// Channels restored in a dispute are force-closed automatically.
+func (c *PaymentClient) ForceClose(ctx context.Context, id channel.ID) error {
+	if !c.ops.begin() {
+		return c.notifyError(&OpError{Op: "force-close channel", Kind: ErrShuttingDown, Err: ErrShuttingDown})
+	}
+	defer c.ops.end()
+	ch, err := c.Channel(id)
+	if err != nil {
+		return c.notifyError(err)
+	}
+	if !ch.startSettling() {
+		return c.notifyError(&OpError{Op: "force-close channel", Kind: ErrSettling, Err: ErrSettling})
+	}
+	return c.notifyError(c.forceClose(ctx, ch))
+}
+
+// resumeForceClose force-closes a restored channel that is in a dispute, e.g.
+// because the client stopped while force-closing it.
+func (c *PaymentClient) resumeForceClose(ch *PaymentChannel) {
+	if !ch.startSettling() {
+		return
+	}
+	c.channelLog(ch, nil).Info("Resuming to force-close channel")
+	c.notifyError(c.forceClose(c.ctx, ch))
+}
+
+// forceClose force-closes ch, which must be marked as settling. The timeout
+// of the operation is extended by the challenge duration of the channel.
+func (c *PaymentClient) forceClose(ctx context.Context, ch *PaymentChannel) error {
+	timeout := c.timeouts.Settle
+	if timeout > 0 {
+		timeout += time.Duration(ch.Params().ChallengeDuration) * time.Second
+	}
+	ctx, cancel := c.opContext(ctx, timeout)
+	defer cancel()
+
+	// go-perun registers the state and waits out the challenge period before
+	// it withdraws, so the progress is tracked alongside.
+	reportCtx, stopReporting := context.WithCancel(ctx)
+	reported := make(chan struct{})
+	go func() {
+		defer close(reported)
+		c.reportForceClose(reportCtx, ch)
+	}()
+	err := ch.withdraw(ctx)
+	stopReporting()
+	<-reported
+
+	if err != nil {
+		ch.stopSettling()
+		c.NotifyAllForceClose(ForceCloseProgress{ChannelID: ch.ID(), Stage: ForceCloseFailed, Err: err, Time: time.Now()})
+		return err
+	}
+	c.NotifyAllForceClose(ForceCloseProgress{ChannelID: ch.ID(), Stage: ForceCloseDone, Time: time.Now()})
+	c.channels.remove(ch.ID())
+	c.refreshBalance()
+	return nil
+}
+
+// reportForceClose reports the stages of force-closing ch until ctx is done.
+func (c *PaymentClient) reportForceClose(ctx context.Context, ch *PaymentChannel) {
+	id := ch.ID()
+	report := func(stage ForceCloseStage, timeout time.Time) {
+		c.NotifyAllForceClose(ForceCloseProgress{ChannelID: id, Stage: stage, Timeout: timeout, Time: time.Now()})
+	}
+	if ch.State().IsFinal {
+		report(ForceCloseWithdrawing, time.Time{})
+		return
+	}
+	report(ForceCloseRegistering, time.Time{})
+	d, err := c.adj.awaitDispute(ctx, id)
+	if err != nil {
+		return
+	}
+	if !d.concluded {
+		report(ForceCloseWaiting, d.timeout)
+		if _, err := c.adj.awaitTimeout(ctx, id); err != nil {
+			return
+		}
+	}
+	report(ForceCloseWithdrawing, time.Time{})
+}
+
+// NotifyAllForceClose reports the progress of force-closing a channel to all
+// observers. Text observers are shown the last state together with a
+// description of the progress.
+func (c *PaymentClient) NotifyAllForceClose(p ForceCloseProgress) {
+	c.observerMutex.Lock()
+	defer c.observerMutex.Unlock()
+	color := "[yellow]"
+	switch p.Stage {
+	case ForceCloseDone:
+		color = "[green]"
+	case ForceCloseFailed:
+		color = "[red]"
+	}
+	str := color + p.String() + "[white]"
+	if c.lastState != "" {
+		str = c.lastState + "\n\n" + str
+	}
+	for _, o := range c.observers {
+		o.UpdateState(str)
+		if o, ok := o.(ForceCloseObserver); ok {
+			o.UpdateForceClose(p)
+		}
+	}
+}
@@ -16,87 +16,261 @@ package client
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
-	"log"
+	"math/big"
+	"time"
+
 	"perun.network/go-perun/channel"
 	"perun.network/go-perun/client"
 )
 
-// HandleProposal is the callback for incoming channel proposals.
+// Indices of the participants in channels proposed to this client.
+const (
+	proposerIdx = 0
+	proposeeIdx = 1
+)
+
+// rejecter sends rejections of proposals or updates to the peer.
+type rejecter interface {
+	Reject(ctx context.Context, reason string) error
+}
+
+// proposalResponder is the part of client.ProposalResponder used by the
+// proposal handler.
+type proposalResponder interface {
+	rejecter
+	Accept(ctx context.Context, acc client.ChannelProposalAccept) (*client.Channel, error)
+}
+
+// updateResponder is the part of client.UpdateResponder used by the update
+// handler.
+type updateResponder interface {
+	rejecter
+	Accept(ctx context.Context) error
+}
+
+// HandleProposal is the callback for incoming channel proposals. Valid
+// proposals are checked against the proposal policy of the client.
 func (c *PaymentClient) HandleProposal(p client.ChannelProposal, r *client.ProposalResponder) {
-	lcp, err := func() (*client.LedgerChannelProposalMsg, error) {
-		// Ensure that we got a ledger channel proposal.
-		lcp, ok := p.(*client.LedgerChannelProposalMsg)
-		if !ok {
-			return nil, fmt.Errorf("invalid proposal type: %T", p)
-		}
+	c.handleProposal(p, r)
+}
 
-		// Check that we have the correct number of participants.
-		if lcp.NumPeers() != 2 {
-			return nil, fmt.Errorf("invalid number of participants: %d", lcp.NumPeers())
-		}
-		// Check that the channel has the expected assets and funding balances.
-		const assetIdx = 0
-		if err := channel.AssertAssetsEqual(lcp.InitBals.Assets, []channel.Asset{c.currency}); err != nil {
-			return nil, fmt.Errorf("Invalid assets: %v\n", err)
-		} else if lcp.FundingAgreement[assetIdx][0].Cmp(lcp.FundingAgreement[assetIdx][1]) != 0 {
-			return nil, fmt.Errorf("invalid funding balance")
+func (c *PaymentClient) handleProposal(p client.ChannelProposal, r proposalResponder) {
+	ctx, cancel := c.opContext(context.Background(), c.timeouts.Open)
+	defer cancel()
+	if !c.ops.begin() {
+		rej := &Rejection{Item: RejectedProposal, RejectionError: Reject(ReasonShuttingDown, "client is shutting down")}
+		if prop, err := c.validateProposal(p); err == nil {
+			rej.Peer = prop.Peer
 		}
-		return lcp, nil
-	}()
+		c.reject(ctx, r, rej)
+		return
+	}
+	defer c.ops.end()
+	prop, err := c.validateProposal(p)
 	if err != nil {
-		r.Reject(context.TODO(), err.Error()) //nolint:errcheck // It's OK if rejection fails.
+		c.reject(ctx, r, &Rejection{Item: RejectedProposal, RejectionError: Reject(ReasonInvalidProposal, "%v", err)})
+		return
+	}
+	if err := c.proposalPolicy.CheckProposal(ctx, prop); err != nil {
+		c.reject(ctx, r, &Rejection{Item: RejectedProposal, Peer: prop.Peer, RejectionError: asRejection(err, ReasonUnknown)})
+		return
 	}
 
 	// Create a channel accept message and send it.
-	accept := lcp.Accept(
+	accept := prop.Msg.Accept(
 		c.WalletAddress(),        // The Account we use in the channel.
 		client.WithRandomNonce(), // Our share of the channel nonce.
 	)
-	ch, err := r.Accept(context.TODO(), accept)
+	ch, err := r.Accept(ctx, accept)
 	if err != nil {
-		log.Printf("Error accepting channel proposal: %v", err)
+		c.notifyError(newOpError("accept channel proposal", err))
 		return
 	}
 
-	//TODO: startWatching
 	// Start the on-chain event watcher. It automatically handles disputes.
 	c.startWatching(ch)
 
 	// Store channel.
-	c.channels <- newPaymentChannel(ch, c.currency)
-	c.AcceptedChannel()
+	c.addChannel(ch)
+	c.refreshBalance()
+}
+
+// validateProposal checks that p is a proposal this client can handle and
+// returns it for evaluation by the proposal policy.
+func (c *PaymentClient) validateProposal(p client.ChannelProposal) (*Proposal, error) {
+	// Ensure that we got a ledger channel proposal.
+	lcp, ok := p.(*client.LedgerChannelProposalMsg)
+	if !ok {
+		return nil, fmt.Errorf("invalid proposal type: %T", p)
+	}
+
+	// Check that we have the correct number of participants.
+	if lcp.NumPeers() != 2 {
+		return nil, fmt.Errorf("invalid number of participants: %d", lcp.NumPeers())
+	}
+	// Check that the channel has supported assets. The deposits are checked
+	// by the proposal policy, which requires equal deposits by default, see
+	// EqualFunding and FundingLimits.
+	if err := c.checkAssets(lcp.InitBals.Assets); err != nil {
+		return nil, fmt.Errorf("invalid assets: %v", err)
+	}
+	assetIdx, ok := lcp.InitBals.AssetIndex(c.currency)
+	if !ok {
+		return nil, fmt.Errorf("invalid assets: missing %v", c.currency)
+	}
+	return &Proposal{
+		Peer:              lcp.Peers[proposerIdx],
+		PeerDeposit:       lcp.FundingAgreement[assetIdx][proposerIdx],
+		OwnDeposit:        lcp.FundingAgreement[assetIdx][proposeeIdx],
+		ChallengeDuration: lcp.ChallengeDuration,
+		OpenChannels:      c.channels.len(),
+		Msg:               lcp,
+		prompts:           c.prompts,
+	}, nil
 }
 
-// HandleUpdate is the callback for incoming channel updates.
+// HandleUpdate is the callback for incoming channel updates. Updates that do
+// not decrease our balance are checked against the update policy of the
+// client.
 func (c *PaymentClient) HandleUpdate(cur *channel.State, next client.ChannelUpdate, r *client.UpdateResponder) {
-	// We accept every update that increases our balance.
-	err := func() error {
-		err := channel.AssertAssetsEqual(cur.Assets, next.State.Assets)
-		if err != nil {
-			return fmt.Errorf("Invalid assets: %v", err)
-		}
+	c.handleUpdate(cur, next, r)
+}
 
-		receiverIdx := 1 - next.ActorIdx // This works because we are in a two-party channel.
-		curBal := cur.Allocation.Balance(receiverIdx, c.currency)
-		nextBal := next.State.Allocation.Balance(receiverIdx, c.currency)
-		if nextBal.Cmp(curBal) < 0 {
-			return fmt.Errorf("Invalid balance: %v", nextBal)
+func (c *PaymentClient) handleUpdate(cur *channel.State, next client.ChannelUpdate, r updateResponder) {
+	ctx, cancel := c.opContext(context.Background(), c.timeouts.Handle)
+	defer cancel()
+	if !c.ops.begin() {
+		rej := &Rejection{Item: RejectedUpdate, ChannelID: cur.ID, RejectionError: Reject(ReasonShuttingDown, "client is shutting down")}
+		if ch, ok := c.channels.get(cur.ID); ok {
+			rej.Peer = ch.Peer()
 		}
-		return nil
-	}()
+		c.reject(ctx, r, rej)
+		return
+	}
+	defer c.ops.end()
+	u, err := c.validateUpdate(cur, next)
+	if err == nil {
+		err = c.attachPaymentInfo(u)
+	}
+	if err == nil {
+		err = c.updatePolicy.CheckUpdate(ctx, u)
+	}
 	if err != nil {
-		r.Reject(context.TODO(), err.Error()) //nolint:errcheck // It's OK if rejection fails.
+		if u.Invoice != "" {
+			c.invoices.release(u.Invoice)
+		}
+		rej := asRejection(err, ReasonUnknown)
+		c.auditUpdate(u, rej)
+		c.reject(ctx, r, &Rejection{Item: RejectedUpdate, ChannelID: cur.ID, Peer: u.Peer, RejectionError: rej})
+		return
 	}
 
 	// Send the acceptance message.
-	err = r.Accept(context.TODO())
+	err = r.Accept(ctx)
+	if err != nil {
+		if u.Invoice != "" {
+			c.invoices.release(u.Invoice)
+		}
+		c.notifyError(newOpError("accept update", err))
+	} else if u.Amount.Sign() > 0 {
+		c.recordReceived(u)
+	}
+	c.auditUpdate(u, err)
+}
+
+// recordReceived records an accepted update that increased our balance in
+// the ledger and marks the paid invoice, if any.
+func (c *PaymentClient) recordReceived(u *Update) {
+	amount, err := AmountFromBal(u.Amount)
 	if err != nil {
-		panic(err)
+		c.channelIDLog(u.Current.ID).WithError(err).Error("Recording payment failed")
+		return
+	}
+	p := Payment{
+		ChannelID: u.Current.ID,
+		Version:   u.Next.Version,
+		Amount:    amount,
+		Direction: PaymentReceived,
+		Time:      u.Received,
+		Memo:      u.Memo,
+		Invoice:   u.Invoice,
+	}
+	if u.Channel != nil {
+		p.Signer = partyID(u.Channel.Params().Parts[u.ActorIdx])
+	}
+	c.recordPayment(p)
+	if u.Invoice != "" {
+		inv := c.invoices.markPaid(u.Invoice, p)
+		c.channelIDLog(p.ChannelID).WithField("invoice", inv.ID).Info("Invoice paid")
+		c.NotifyAllInvoice(inv)
+	}
+}
+
+// reject sends the rejection to the peer and notifies the observers.
+func (c *PaymentClient) reject(ctx context.Context, r rejecter, rej *Rejection) {
+	log := c.log.WithField("reason", rej.Reason)
+	if rej.ChannelID != (channel.ID{}) {
+		log = log.WithField(LogFieldChannel, hex.EncodeToString(rej.ChannelID[:]))
+	}
+	if rej.Peer != nil {
+		log = log.WithField(LogFieldPeer, formatPeer(rej.Peer))
+	}
+	log.Warnf("Rejecting %s: %v", rej.Item, rej.RejectionError)
+	if err := r.Reject(ctx, rej.RejectionError.Error()); err != nil {
+		log.WithError(err).Error("Sending rejection failed")
 	}
+	c.NotifyAllRejection(rej)
 }
 
-// HandleAdjudicatorEvent is the callback for smart contract events.
-func (c *PaymentClient) HandleAdjudicatorEvent(e channel.AdjudicatorEvent) {
-	log.Printf("Adjudicator event: type = %T, client = %v", e, c.Account)
+// validateUpdate checks that the update does not decrease our balance and
+// returns it for evaluation by the update policy.
+func (c *PaymentClient) validateUpdate(cur *channel.State, next client.ChannelUpdate) (*Update, error) {
+	u := &Update{
+		Current:  cur,
+		Next:     next.State,
+		ActorIdx: next.ActorIdx,
+		Amount:   new(big.Int),
+		Received: time.Now(),
+	}
+	if ch, ok := c.channels.get(cur.ID); ok {
+		u.Channel = ch
+		u.Peer = ch.Peer()
+		u.PendingPayments = ch.PendingPayments()
+		if ch.sendingConditional() {
+			return u, Reject(ReasonUpdatePending, "conditional update in progress")
+		}
+	}
+
+	err := channel.AssertAssetsEqual(cur.Assets, next.State.Assets)
+	if err != nil {
+		return u, Reject(ReasonInvalidUpdate, "invalid assets: %v", err)
+	}
+
+	// We accept every update that does not decrease our balance of any asset.
+	// The amount is measured in our currency.
+	receiverIdx := 1 - next.ActorIdx // This works because we are in a two-party channel.
+	for i, a := range cur.Assets {
+		curBal := cur.Allocation.Balances[i][receiverIdx]
+		nextBal := next.State.Allocation.Balances[i][receiverIdx]
+		if nextBal.Cmp(curBal) < 0 {
+			return u, Reject(ReasonInvalidUpdate, "invalid balance: %v", nextBal)
+		}
+		if a.Equal(c.currency) {
+			u.Amount.Sub(nextBal, curBal)
+		}
+	}
+	return u, nil
+}
+
+// auditUpdate notifies the update policy and auditors about the outcome of an
+// incoming update.
+func (c *PaymentClient) auditUpdate(u *Update, err error) {
+	if a, ok := c.updatePolicy.(UpdateAuditor); ok {
+		a.AuditUpdate(u, err)
+	}
+	for _, a := range c.updateAuditors {
+		a.AuditUpdate(u, err)
+	}
 }
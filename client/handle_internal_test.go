@@ -0,0 +1,315 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	_ "perun.network/go-perun/backend/sim/channel" // backend init
+	_ "perun.network/go-perun/backend/sim/wallet"  // backend init
+	"perun.network/go-perun/channel"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/client"
+	wtest "perun.network/go-perun/wallet/test"
+	"perun.network/go-perun/wire"
+	"perun.network/go-perun/wire/net/simple"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+// fakeResponder records the responses of the handlers.
+type fakeResponder struct {
+	accepted int
+	rejected []string
+}
+
+func (r *fakeResponder) Reject(_ context.Context, reason string) error {
+	r.rejected = append(r.rejected, reason)
+	return nil
+}
+
+// fakeProposalResponder fails accepting proposals so that the handler does not
+// need a funded channel.
+type fakeProposalResponder struct{ fakeResponder }
+
+func (r *fakeProposalResponder) Accept(context.Context, client.ChannelProposalAccept) (*client.Channel, error) {
+	r.accepted++
+	return nil, errors.New("not funded")
+}
+
+type fakeUpdateResponder struct{ fakeResponder }
+
+func (r *fakeUpdateResponder) Accept(context.Context) error {
+	r.accepted++
+	return nil
+}
+
+// rejectionRecorder is an observer that records rejections.
+type rejectionRecorder struct {
+	mutex      sync.Mutex
+	rejections []*Rejection
+}
+
+func (o *rejectionRecorder) UpdateState(string)   {}
+func (o *rejectionRecorder) UpdateBalance(string) {}
+func (o *rejectionRecorder) GetID() uuid.UUID     { return uuid.Nil }
+
+func (o *rejectionRecorder) UpdateRejection(r *Rejection) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.rejections = append(o.rejections, r)
+}
+
+// newTestClient returns a client that only supports the handlers.
+func newTestClient(currency channel.Asset, opts ...Option) (*PaymentClient, *rejectionRecorder) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &PaymentClient{
+		Name:           "test",
+		currency:       currency,
+		channels:       newChannelRegistry(),
+		timeouts:       DefaultTimeouts(),
+		proposalPolicy: AcceptAllProposals,
+		updatePolicy:   ConsistentUpdates,
+		requestPolicy:  DeclineRequests,
+		clock:          SystemClock,
+		ctx:            ctx,
+		cancel:         cancel,
+		balances:       NewBalanceWatcher(ctx, DefaultBalanceConfig()),
+		events:         newEventHistory(),
+		log:            logrus.StandardLogger(),
+		ledger:         NewLedger(),
+		invoices:       newInvoiceBook(),
+	}
+	c.prompts = newProposalQueue(c.notifyProposalPending)
+	c.requests = newRequestQueue(c.notifyRequestPending)
+	for _, opt := range opts {
+		opt(c)
+	}
+	o := &rejectionRecorder{}
+	c.Register(o)
+	return c, o
+}
+
+func newTestProposal(t *testing.T, rng *rand.Rand, asset channel.Asset, bals ...int64) *client.LedgerChannelProposalMsg {
+	t.Helper()
+	alloc := &channel.Allocation{
+		Assets:   []channel.Asset{asset},
+		Balances: channel.Balances{make([]channel.Bal, len(bals))},
+	}
+	peers := make([]wire.Address, len(bals))
+	for i, b := range bals {
+		alloc.Balances[0][i] = big.NewInt(b)
+		peers[i] = simple.NewAddress(string(rune('A' + i)))
+	}
+	p, err := client.NewLedgerChannelProposal(10, wtest.NewRandomAddress(rng), alloc, peers)
+	require.NoError(t, err)
+	return p
+}
+
+func TestHandleProposal(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	asset := chtest.NewRandomAsset(rng)
+
+	tests := []struct {
+		name     string
+		proposal *client.LedgerChannelProposalMsg
+		opts     []Option
+		reason   RejectReason // reason is empty if the proposal is accepted.
+	}{
+		{"valid", newTestProposal(t, rng, asset, 10, 10), nil, ""},
+		{"other asset", newTestProposal(t, rng, chtest.NewRandomAsset(rng), 10, 10), nil, ReasonInvalidProposal},
+		{"unequal funding", newTestProposal(t, rng, asset, 10, 5), nil, ""},
+		{"zero peer deposit", newTestProposal(t, rng, asset, 10, 0), nil, ""},
+		{"equal funding policy", newTestProposal(t, rng, asset, 10, 5), []Option{WithProposalPolicy(EqualFunding)}, ReasonFundingUnequal},
+		{"three parties", newTestProposal(t, rng, asset, 10, 10, 10), nil, ReasonInvalidProposal},
+		{"policy", newTestProposal(t, rng, asset, 10, 10), []Option{WithProposalPolicy(MaxChannels(0))}, ReasonTooManyChannels},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, o := newTestClient(asset, tt.opts...)
+			r := &fakeProposalResponder{}
+			c.handleProposal(tt.proposal, r)
+
+			if tt.reason == "" {
+				require.Equal(t, 1, r.accepted)
+				require.Empty(t, r.rejected)
+				require.Empty(t, o.rejections)
+				return
+			}
+			require.Zero(t, r.accepted, "rejected proposal must not be accepted")
+			require.Len(t, r.rejected, 1)
+			require.Equal(t, tt.reason, ParseRejection(r.rejected[0]).Reason)
+			require.Len(t, o.rejections, 1)
+			require.Equal(t, RejectedProposal, o.rejections[0].Item)
+			require.Equal(t, tt.reason, o.rejections[0].Reason)
+		})
+	}
+}
+
+func TestHandleUpdate(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	asset := chtest.NewRandomAsset(rng)
+	cur := &channel.State{
+		ID:      channel.ID{1},
+		Version: 1,
+		App:     channel.NoApp(),
+		Allocation: channel.Allocation{
+			Assets:   []channel.Asset{asset},
+			Balances: channel.Balances{{big.NewInt(100), big.NewInt(100)}},
+		},
+		Data: channel.NoData(),
+	}
+	// transfer returns the next state in which from sends amount to the
+	// other party.
+	transfer := func(from channel.Index, amount int64) *channel.State {
+		next := cur.Clone()
+		next.Version++
+		next.Allocation.TransferBalance(from, 1-from, asset, big.NewInt(amount))
+		return next
+	}
+	otherAsset := transfer(0, 10)
+	otherAsset.Assets = []channel.Asset{chtest.NewRandomAsset(rng)}
+
+	tests := []struct {
+		name   string
+		next   *channel.State
+		opts   []Option
+		reason RejectReason // reason is empty if the update is accepted.
+	}{
+		{"payment", transfer(0, 10), nil, ""},
+		{"decreasing balance", transfer(1, 10), nil, ReasonInvalidUpdate},
+		{"other asset", otherAsset, nil, ReasonInvalidUpdate},
+		{"policy", transfer(0, 10), []Option{WithUpdatePolicy(PaymentLimits{Max: 5})}, ReasonPaymentLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, o := newTestClient(asset, tt.opts...)
+			var audited []error
+			WithUpdateAuditor(UpdateAuditFunc(func(_ *Update, err error) {
+				audited = append(audited, err)
+			}))(c)
+			r := &fakeUpdateResponder{}
+			c.handleUpdate(cur, client.ChannelUpdate{State: tt.next, ActorIdx: 0}, r)
+
+			require.Len(t, audited, 1, "every update is audited exactly once")
+			if tt.reason == "" {
+				require.Equal(t, 1, r.accepted)
+				require.Empty(t, r.rejected)
+				require.Empty(t, o.rejections)
+				require.NoError(t, audited[0])
+				return
+			}
+			require.Zero(t, r.accepted, "rejected update must not be accepted")
+			require.Len(t, r.rejected, 1)
+			require.Equal(t, tt.reason, ParseRejection(r.rejected[0]).Reason)
+			require.Len(t, o.rejections, 1)
+			require.Equal(t, RejectedUpdate, o.rejections[0].Item)
+			require.Equal(t, cur.ID, o.rejections[0].ChannelID)
+			require.Error(t, audited[0])
+		})
+	}
+}
+
+func TestHandleMultiAssetUpdate(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	asset, token := chtest.NewRandomAsset(rng), chtest.NewRandomAsset(rng)
+	cur := &channel.State{
+		ID:      channel.ID{1},
+		Version: 1,
+		App:     channel.NoApp(),
+		Allocation: channel.Allocation{
+			Assets:   []channel.Asset{asset, token},
+			Balances: channel.Balances{{big.NewInt(100), big.NewInt(100)}, {big.NewInt(5), big.NewInt(5)}},
+		},
+		Data: channel.NoData(),
+	}
+
+	// The peer pays us in our currency but takes tokens from us.
+	next := cur.Clone()
+	next.Version++
+	next.Allocation.TransferBalance(0, 1, asset, big.NewInt(10))
+	next.Allocation.TransferBalance(1, 0, token, big.NewInt(1))
+
+	c, o := newTestClient(asset)
+	r := &fakeUpdateResponder{}
+	c.handleUpdate(cur, client.ChannelUpdate{State: next, ActorIdx: 0}, r)
+	require.Zero(t, r.accepted)
+	require.Len(t, o.rejections, 1)
+	require.Equal(t, ReasonInvalidUpdate, o.rejections[0].Reason)
+
+	// Payments in one asset leave the others untouched.
+	next = cur.Clone()
+	next.Version++
+	next.Allocation.TransferBalance(0, 1, token, big.NewInt(2))
+	c, _ = newTestClient(asset)
+	var amount *big.Int
+	WithUpdateAuditor(UpdateAuditFunc(func(u *Update, _ error) { amount = u.Amount }))(c)
+	r = &fakeUpdateResponder{}
+	c.handleUpdate(cur, client.ChannelUpdate{State: next, ActorIdx: 0}, r)
+	require.Equal(t, 1, r.accepted)
+	require.Zero(t, amount.Sign(), "amount is measured in our currency")
+}
+
+// channelEventRecorder is an observer that records on-chain channel events
+// and the last text notification.
+type channelEventRecorder struct {
+	rejectionRecorder
+	last   string
+	events []ChannelEvent
+}
+
+func (o *channelEventRecorder) UpdateState(s string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.last = s
+}
+
+func (o *channelEventRecorder) UpdateChannelEvent(e ChannelEvent) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.events = append(o.events, e)
+}
+
+func TestHandleAdjudicatorEvent(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	c, _ := newTestClient(chtest.NewRandomAsset(rng))
+	o := &channelEventRecorder{}
+	c.Register(o)
+
+	id := channel.ID{7}
+	timeout := time.Now().Add(time.Minute)
+	c.HandleAdjudicatorEvent(channel.NewRegisteredEvent(id, &channel.TimeTimeout{Time: timeout}, 3, nil, nil))
+	c.HandleAdjudicatorEvent(channel.NewConcludedEvent(id, &channel.ElapsedTimeout{}, 3))
+
+	events := c.ChannelEvents(id)
+	require.Len(t, events, 2)
+	require.Equal(t, EventRegistered, events[0].Kind)
+	require.EqualValues(t, 3, events[0].Version)
+	require.True(t, timeout.Equal(events[0].Timeout))
+	require.False(t, events[0].Stale(), "unknown channels have no latest version")
+	require.Equal(t, EventConcluded, events[1].Kind)
+	require.True(t, events[1].Timeout.IsZero())
+	require.Equal(t, events, o.events)
+	require.Contains(t, o.last, "concluded on-chain with version 3")
+	require.Empty(t, c.ChannelEvents(channel.ID{8}))
+}
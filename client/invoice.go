@@ -0,0 +1,348 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wire"
+	"perun.network/go-perun/wire/perunio"
+)
+
+// InvoiceStatus is the status of an invoice.
+type InvoiceStatus string
+
+// Invoice statuses.
+const (
+	InvoiceOpen    InvoiceStatus = "open"
+	InvoicePaid    InvoiceStatus = "paid"
+	InvoiceExpired InvoiceStatus = "expired"
+)
+
+// Invoice is a request for payment created by the payee. The payer pays it
+// with SendPayment and WithInvoice, and the payee marks it paid when it
+// accepts the payment.
+type Invoice struct {
+	ID          string
+	Amount      Amount
+	Description string
+	Created     time.Time
+	Expires     time.Time // Expires is zero if the invoice does not expire.
+	Status      InvoiceStatus
+	// The following fields are set once the invoice is paid.
+	ChannelID channel.ID
+	Version   uint64    // Version is the channel version created by the payment.
+	Paid      time.Time // Paid is the time the payment was accepted.
+	Payer     string    // Payer is the hex-encoded payment identifier of the payer.
+}
+
+// expired reports whether the open invoice is expired at time now.
+func (inv *Invoice) expired(now time.Time) bool {
+	return inv.Status == InvoiceOpen && !inv.Expires.IsZero() && now.After(inv.Expires)
+}
+
+// invoiceBook holds the invoices of a client and the payment information
+// announced by peers.
+type invoiceBook struct {
+	mutex    sync.Mutex
+	invoices map[string]*Invoice
+	order    []string                       // order holds the invoice IDs in order of creation.
+	reserved map[string]bool                // reserved holds the invoices of updates being handled.
+	infos    map[channel.ID]*paymentInfoMsg // infos holds the latest payment information per channel.
+	waiters  map[string]chan error          // waiters are signaled when requested invoices are paid or declined.
+}
+
+func newInvoiceBook() *invoiceBook {
+	return &invoiceBook{
+		invoices: make(map[string]*Invoice),
+		reserved: make(map[string]bool),
+		infos:    make(map[channel.ID]*paymentInfoMsg),
+		waiters:  make(map[string]chan error),
+	}
+}
+
+func (b *invoiceBook) add(inv Invoice) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.invoices[inv.ID] = &inv
+	b.order = append(b.order, inv.ID)
+}
+
+// get returns the invoice with the given ID as of time now.
+func (b *invoiceBook) get(id string, now time.Time) (Invoice, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	inv, ok := b.invoices[id]
+	if !ok {
+		return Invoice{}, false
+	}
+	return b.status(inv, now), true
+}
+
+// list returns all invoices as of time now in order of creation.
+func (b *invoiceBook) list(now time.Time) []Invoice {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	invs := make([]Invoice, 0, len(b.order))
+	for _, id := range b.order {
+		invs = append(invs, b.status(b.invoices[id], now))
+	}
+	return invs
+}
+
+// status returns a copy of inv with the status at time now.
+func (b *invoiceBook) status(inv *Invoice, now time.Time) Invoice {
+	cp := *inv
+	if inv.expired(now) {
+		cp.Status = InvoiceExpired
+	}
+	return cp
+}
+
+// reserve checks that the invoice with the given ID can be paid with amount
+// at time now and reserves it until it is marked paid or released.
+func (b *invoiceBook) reserve(id string, amount Amount, now time.Time) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	inv, ok := b.invoices[id]
+	switch {
+	case !ok:
+		return Reject(ReasonInvalidInvoice, "unknown invoice %s", id)
+	case inv.Status == InvoicePaid || b.reserved[id]:
+		return Reject(ReasonInvalidInvoice, "invoice %s is already paid", id)
+	case inv.expired(now):
+		return Reject(ReasonInvalidInvoice, "invoice %s expired at %v", id, inv.Expires.Format(time.RFC3339))
+	case inv.Amount != amount:
+		return Reject(ReasonInvalidInvoice, "invoice %s is over %v, got %v", id, inv.Amount, amount)
+	}
+	b.reserved[id] = true
+	return nil
+}
+
+// release releases the reservation of an invoice whose payment was not
+// accepted.
+func (b *invoiceBook) release(id string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.reserved, id)
+}
+
+// markPaid marks the reserved invoice as paid with the given payment and
+// returns it.
+func (b *invoiceBook) markPaid(id string, p Payment) Invoice {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.reserved, id)
+	inv := b.invoices[id]
+	inv.Status = InvoicePaid
+	inv.ChannelID = p.ChannelID
+	inv.Version = p.Version
+	inv.Paid = p.Time
+	inv.Payer = p.Signer
+	b.signal(id, nil)
+	return *inv
+}
+
+// await returns a channel that receives nil once the invoice is paid or the
+// error of the peer declining it.
+func (b *invoiceBook) await(id string) <-chan error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	done := make(chan error, 1)
+	b.waiters[id] = done
+	return done
+}
+
+// stopAwait removes the waiter of the invoice.
+func (b *invoiceBook) stopAwait(id string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.waiters, id)
+}
+
+// decline signals the waiter of the unpaid invoice that the peer declined
+// it.
+func (b *invoiceBook) decline(id string, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if inv, ok := b.invoices[id]; ok && inv.Status != InvoicePaid {
+		b.signal(id, err)
+	}
+}
+
+// signal sends err to the waiter of the invoice. b.mutex must be held.
+func (b *invoiceBook) signal(id string, err error) {
+	if done, ok := b.waiters[id]; ok {
+		delete(b.waiters, id)
+		done <- err
+	}
+}
+
+// addInfo stores payment information announced by the peer of a channel.
+// It replaces earlier information of the channel, whose payment was not
+// proposed.
+func (b *invoiceBook) addInfo(msg *paymentInfoMsg) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.infos[msg.ChannelID] = msg
+}
+
+// takeInfo removes and returns the payment information announced for the
+// given version of a channel. It returns nil if there is none or the amount
+// does not match.
+func (b *invoiceBook) takeInfo(id channel.ID, version uint64, amount Amount) *paymentInfoMsg {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	info, ok := b.infos[id]
+	if !ok || info.Version > version {
+		return nil
+	}
+	delete(b.infos, id)
+	if info.Version != version || info.Amount != amount {
+		return nil
+	}
+	return info
+}
+
+// paymentInfoMsg announces the invoice and memo of a payment to the payee.
+// It is sent right before the channel update of the payment.
+type paymentInfoMsg struct {
+	ChannelID channel.ID
+	Version   uint64 // Version is the channel version of the payment.
+	Amount    Amount
+	Invoice   string
+	Memo      string
+}
+
+func init() {
+	wire.RegisterExternalDecoder(paymentInfoMsgType, func(r io.Reader) (wire.Msg, error) {
+		var msg paymentInfoMsg
+		return &msg, msg.Decode(r)
+	}, "PaymentInfo")
+}
+
+// Type implements wire.Msg.
+func (*paymentInfoMsg) Type() wire.Type {
+	return paymentInfoMsgType
+}
+
+// Encode implements perunio.Encoder.
+func (m *paymentInfoMsg) Encode(w io.Writer) error {
+	return perunio.Encode(w, m.ChannelID, m.Version, int64(m.Amount), m.Invoice, m.Memo)
+}
+
+// Decode implements perunio.Decoder.
+func (m *paymentInfoMsg) Decode(r io.Reader) error {
+	var amount int64
+	if err := perunio.Decode(r, &m.ChannelID, &m.Version, &amount, &m.Invoice, &m.Memo); err != nil {
+		return err
+	}
+	m.Amount = Amount(amount)
+	return nil
+}
+
+// WithInvoice makes the payment pay the invoice of the peer with the given
+// ID. The peer rejects the payment if the invoice is unknown, already paid
+// or expired, or if the amount does not match.
+func WithInvoice(id string) PaymentOption {
+	return func(p *Payment) {
+		p.Invoice = id
+	}
+}
+
+// CreateInvoice creates an invoice over amount for a payment to us. The
+// invoice expires after the given duration, or never if it is zero.
+// Invoices are kept in memory.
+func (c *PaymentClient) CreateInvoice(amount Amount, description string, expiry time.Duration) (Invoice, error) {
+	if amount <= 0 {
+		return Invoice{}, &OpError{Op: "create invoice", Kind: ErrInvalidAmount, Err: fmt.Errorf("%v", amount)}
+	}
+	if expiry < 0 {
+		return Invoice{}, &OpError{Op: "create invoice", Kind: ErrInvalidParams, Err: fmt.Errorf("negative expiry %v", expiry)}
+	}
+	now := time.Now()
+	inv := Invoice{
+		ID:          uuid.New().String(),
+		Amount:      amount,
+		Description: description,
+		Created:     now,
+		Status:      InvoiceOpen,
+	}
+	if expiry > 0 {
+		inv.Expires = now.Add(expiry)
+	}
+	c.invoices.add(inv)
+	c.log.WithField("invoice", inv.ID).Infof("Created invoice over %v", amount)
+	return inv, nil
+}
+
+// Invoice returns the invoice with the given ID.
+func (c *PaymentClient) Invoice(id string) (Invoice, error) {
+	inv, ok := c.invoices.get(id, time.Now())
+	if !ok {
+		return Invoice{}, &OpError{Op: "look up invoice", Kind: ErrUnknownInvoice, Err: fmt.Errorf("unknown invoice %s", id)}
+	}
+	return inv, nil
+}
+
+// Invoices returns all invoices in order of creation.
+func (c *PaymentClient) Invoices() []Invoice {
+	return c.invoices.list(time.Now())
+}
+
+// attachPaymentInfo attaches the invoice and memo announced by the peer to
+// the incoming update and reserves the invoice. It rejects updates that pay
+// an invoice that cannot be paid.
+func (c *PaymentClient) attachPaymentInfo(u *Update) error {
+	amount, err := AmountFromBal(u.Amount)
+	if err != nil {
+		return nil // Not a payment in our currency.
+	}
+	info := c.invoices.takeInfo(u.Current.ID, u.Next.Version, amount)
+	if info == nil {
+		return nil
+	}
+	u.Memo = info.Memo
+	if info.Invoice == "" {
+		return nil
+	}
+	if err := c.invoices.reserve(info.Invoice, amount, u.Received); err != nil {
+		return err
+	}
+	u.Invoice = info.Invoice
+	return nil
+}
+
+// NotifyAllInvoice reports a paid invoice to all observers. Text observers
+// are shown the last state together with the invoice.
+func (c *PaymentClient) NotifyAllInvoice(inv Invoice) {
+	c.observerMutex.Lock()
+	defer c.observerMutex.Unlock()
+	str := fmt.Sprintf("[green]Invoice %s over %v paid[white]", inv.ID, inv.Amount)
+	if c.lastState != "" {
+		str = c.lastState + "\n\n" + str
+	}
+	for _, o := range c.observers {
+		o.UpdateState(str)
+		if o, ok := o.(InvoiceObserver); ok {
+			o.UpdateInvoice(inv)
+		}
+	}
+}
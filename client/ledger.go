@@ -0,0 +1,298 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wallet"
+	"perun.network/perun-cardano-backend/wallet/address"
+)
+
+// PaymentDirection tells whether a payment was sent or received.
+type PaymentDirection string
+
+// Payment directions.
+const (
+	PaymentSent     PaymentDirection = "sent"
+	PaymentReceived PaymentDirection = "received"
+)
+
+// Payment is an entry of the payment ledger. It describes an accepted
+// channel update that transferred funds.
+type Payment struct {
+	ChannelID channel.ID
+	Version   uint64 // Version is the channel version created by the payment.
+	Amount    Amount
+	Direction PaymentDirection
+	Time      time.Time
+	Memo      string // Memo is an optional note, it is sent to the peer with the payment.
+	Signer    string // Signer is the hex-encoded payment identifier of the party that proposed the update.
+	Invoice   string // Invoice is the ID of the invoice paid by the payment, if any.
+}
+
+// paymentJSON is the JSON encoding of a Payment.
+type paymentJSON struct {
+	ChannelID string           `json:"channel_id"`
+	Version   uint64           `json:"version"`
+	Amount    Amount           `json:"amount"` // Amount is in Ada.
+	Lovelace  int64            `json:"lovelace"`
+	Direction PaymentDirection `json:"direction"`
+	Time      time.Time        `json:"time"`
+	Memo      string           `json:"memo,omitempty"`
+	Signer    string           `json:"signer"`
+	Invoice   string           `json:"invoice,omitempty"`
+}
+
+// MarshalJSON encodes the payment with a hex-encoded channel ID and the
+// amount in Ada and Lovelace.
+func (p Payment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(paymentJSON{
+		ChannelID: hex.EncodeToString(p.ChannelID[:]),
+		Version:   p.Version,
+		Amount:    p.Amount,
+		Lovelace:  p.Amount.Lovelace(),
+		Direction: p.Direction,
+		Time:      p.Time,
+		Memo:      p.Memo,
+		Signer:    p.Signer,
+		Invoice:   p.Invoice,
+	})
+}
+
+// UnmarshalJSON decodes a payment encoded by MarshalJSON.
+func (p *Payment) UnmarshalJSON(data []byte) error {
+	var pj paymentJSON
+	if err := json.Unmarshal(data, &pj); err != nil {
+		return err
+	}
+	id, err := ParseChannelID(pj.ChannelID)
+	if err != nil {
+		return err
+	}
+	*p = Payment{
+		ChannelID: id,
+		Version:   pj.Version,
+		Amount:    pj.Amount,
+		Direction: pj.Direction,
+		Time:      pj.Time,
+		Memo:      pj.Memo,
+		Signer:    pj.Signer,
+		Invoice:   pj.Invoice,
+	}
+	return nil
+}
+
+// PaymentFilter selects payments of a ledger. Zero fields match all
+// payments.
+type PaymentFilter struct {
+	ChannelID channel.ID
+	Direction PaymentDirection
+	Start     time.Time // Start is the earliest time of a payment.
+	End       time.Time // End is the latest time of a payment.
+}
+
+// Match reports whether p passes the filter.
+func (f PaymentFilter) Match(p Payment) bool {
+	switch {
+	case f.ChannelID != (channel.ID{}) && f.ChannelID != p.ChannelID:
+		return false
+	case f.Direction != "" && f.Direction != p.Direction:
+		return false
+	case !f.Start.IsZero() && p.Time.Before(f.Start):
+		return false
+	case !f.End.IsZero() && p.Time.After(f.End):
+		return false
+	}
+	return true
+}
+
+// Ledger records the payments of a client in the order they were made.
+// Payments of closed channels are kept.
+type Ledger struct {
+	mutex    sync.Mutex
+	payments []Payment
+	file     *os.File // file persists the payments, may be nil.
+}
+
+// NewLedger returns a ledger that keeps the payments in memory.
+func NewLedger() *Ledger {
+	return new(Ledger)
+}
+
+// OpenLedger opens or creates a ledger that persists the payments in the
+// file at path, one JSON object per line. A last line that was not written
+// completely, e.g. because the process crashed, is discarded.
+func OpenLedger(path string) (*Ledger, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening payment ledger: %w", err)
+	}
+	l := &Ledger{file: f}
+	if err := l.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("loading payment ledger: %w", err)
+	}
+	return l, nil
+}
+
+// load reads the payments from the file and positions it for appending.
+func (l *Ledger) load() error {
+	r := bufio.NewReader(l.file)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break // Discard an incomplete last line.
+		} else if err != nil {
+			return err
+		}
+		var p Payment
+		if err := json.Unmarshal(bytes.TrimSpace(data), &p); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		l.payments = append(l.payments, p)
+		offset += int64(len(data))
+	}
+	if err := l.file.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := l.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// Record adds p to the ledger. The payment is recorded in memory even if it
+// cannot be persisted.
+func (l *Ledger) Record(p Payment) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.payments = append(l.payments, p)
+	if l.file == nil {
+		return nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("persisting payment: %w", err)
+	}
+	return nil
+}
+
+// Payments returns the payments that pass f in the order they were made.
+func (l *Ledger) Payments(f PaymentFilter) []Payment {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var ps []Payment
+	for _, p := range l.payments {
+		if f.Match(p) {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
+// Close closes the file of a persistent ledger. Payments recorded afterwards
+// are kept in memory only.
+func (l *Ledger) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// paymentCSVHeader is the header of the CSV export.
+var paymentCSVHeader = []string{"time", "channel_id", "version", "direction", "amount_ada", "amount_lovelace", "signer", "memo", "invoice"}
+
+// WritePaymentsCSV writes the payments to w as CSV with a header line.
+func WritePaymentsCSV(w io.Writer, payments []Payment) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(paymentCSVHeader); err != nil {
+		return err
+	}
+	for _, p := range payments {
+		if err := cw.Write([]string{
+			p.Time.UTC().Format(time.RFC3339Nano),
+			hex.EncodeToString(p.ChannelID[:]),
+			strconv.FormatUint(p.Version, 10),
+			string(p.Direction),
+			p.Amount.AdaString(),
+			strconv.FormatInt(p.Amount.Lovelace(), 10),
+			p.Signer,
+			p.Memo,
+			p.Invoice,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WritePaymentsJSON writes the payments to w as JSON array.
+func WritePaymentsJSON(w io.Writer, payments []Payment) error {
+	if payments == nil {
+		payments = []Payment{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(payments)
+}
+
+// WithLedger makes the client record its payments in l, which the client
+// closes on Shutdown. By default, payments are recorded in memory only.
+func WithLedger(l *Ledger) Option {
+	return func(c *PaymentClient) {
+		c.ledger = l
+	}
+}
+
+// Payments returns the recorded payments of the client that pass f in the
+// order they were made.
+func (c *PaymentClient) Payments(f PaymentFilter) []Payment {
+	return c.ledger.Payments(f)
+}
+
+// recordPayment records p in the ledger and logs errors.
+func (c *PaymentClient) recordPayment(p Payment) {
+	if err := c.ledger.Record(p); err != nil {
+		c.channelIDLog(p.ChannelID).WithError(err).Error("Recording payment failed")
+	}
+}
+
+// partyID returns the hex-encoded payment identifier of a channel party.
+func partyID(p wallet.Address) string {
+	if addr, ok := p.(*address.Address); ok {
+		return hex.EncodeToString(addr.GetPubKeyHashSlice())
+	}
+	return p.String()
+}
@@ -0,0 +1,111 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/channel"
+	"perun.network/perun-cardano-demo/client"
+)
+
+func testPayments() []client.Payment {
+	t0 := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	return []client.Payment{
+		{ChannelID: channel.ID{1}, Version: 1, Amount: 2 * client.Ada, Direction: client.PaymentSent, Time: t0, Memo: "coffee, large", Signer: "aa"},
+		{ChannelID: channel.ID{2}, Version: 1, Amount: 1, Direction: client.PaymentReceived, Time: t0.Add(time.Hour), Signer: "bb", Invoice: "inv-1"},
+		{ChannelID: channel.ID{1}, Version: 3, Amount: client.Ada / 2, Direction: client.PaymentReceived, Time: t0.Add(2 * time.Hour), Signer: "bb"},
+	}
+}
+
+func TestLedgerFilter(t *testing.T) {
+	l := client.NewLedger()
+	ps := testPayments()
+	for _, p := range ps {
+		require.NoError(t, l.Record(p))
+	}
+
+	require.Equal(t, ps, l.Payments(client.PaymentFilter{}))
+	require.Equal(t, []client.Payment{ps[0], ps[2]}, l.Payments(client.PaymentFilter{ChannelID: channel.ID{1}}))
+	require.Equal(t, []client.Payment{ps[1], ps[2]}, l.Payments(client.PaymentFilter{Direction: client.PaymentReceived}))
+	require.Equal(t, []client.Payment{ps[1]}, l.Payments(client.PaymentFilter{Start: ps[1].Time, End: ps[1].Time}))
+	require.Empty(t, l.Payments(client.PaymentFilter{ChannelID: channel.ID{3}}))
+}
+
+func TestOpenLedger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payments.jsonl")
+	ps := testPayments()
+	l, err := client.OpenLedger(path)
+	require.NoError(t, err)
+	for _, p := range ps[:2] {
+		require.NoError(t, l.Record(p))
+	}
+	require.NoError(t, l.Close())
+
+	// Simulate a crash while writing a payment.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"channel_id":"01`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	l, err = client.OpenLedger(path)
+	require.NoError(t, err)
+	require.Equal(t, ps[:2], l.Payments(client.PaymentFilter{}))
+	require.NoError(t, l.Record(ps[2]))
+	require.NoError(t, l.Close())
+
+	l, err = client.OpenLedger(path)
+	require.NoError(t, err)
+	defer l.Close()
+	require.Equal(t, ps, l.Payments(client.PaymentFilter{}))
+
+	// Corrupt lines are reported.
+	require.NoError(t, os.WriteFile(path, []byte("{}\n"), 0600))
+	_, err = client.OpenLedger(path)
+	require.Error(t, err)
+}
+
+func TestWritePayments(t *testing.T) {
+	ps := testPayments()
+
+	var buf bytes.Buffer
+	require.NoError(t, client.WritePaymentsCSV(&buf, ps[:2]))
+	require.Equal(t, "time,channel_id,version,direction,amount_ada,amount_lovelace,signer,memo,invoice\n"+
+		"2022-06-01T12:00:00Z,01"+zeros(31)+",1,sent,2,2000000,aa,\"coffee, large\",\n"+
+		"2022-06-01T13:00:00Z,02"+zeros(31)+",1,received,0.000001,1,bb,,inv-1\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, client.WritePaymentsJSON(&buf, ps))
+	var decoded []client.Payment
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(t, ps, decoded)
+	require.Contains(t, buf.String(), `"lovelace": 500000`)
+
+	buf.Reset()
+	require.NoError(t, client.WritePaymentsJSON(&buf, nil))
+	require.Equal(t, "[]\n", buf.String())
+}
+
+// zeros returns n hex-encoded zero bytes.
+func zeros(n int) string {
+	return string(bytes.Repeat([]byte("00"), n))
+}
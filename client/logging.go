@@ -0,0 +1,74 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wire"
+	"perun.network/go-perun/wire/net/simple"
+)
+
+// Log fields attached to the entries of a client.
+const (
+	LogFieldClient  = "client"
+	LogFieldChannel = "channel"
+	LogFieldVersion = "version"
+	LogFieldPeer    = "peer"
+)
+
+// WithLogger sets the logger of the client. All entries are annotated with
+// the client name. By default, the standard logrus logger is used.
+func WithLogger(l logrus.FieldLogger) Option {
+	return func(c *PaymentClient) {
+		c.log = l
+	}
+}
+
+// Log returns the logger of the client.
+func (c *PaymentClient) Log() logrus.FieldLogger {
+	return c.log
+}
+
+// channelLog returns the logger of the client annotated with the channel ID
+// and peer of ch and, if state is not nil, its version. ch.State is not used
+// because it blocks while the channel is updated.
+func (c *PaymentClient) channelLog(ch *PaymentChannel, state *channel.State) logrus.FieldLogger {
+	fields := logrus.Fields{LogFieldPeer: formatPeer(ch.Peer())}
+	if state != nil {
+		fields[LogFieldVersion] = state.Version
+	}
+	return c.channelIDLog(ch.ID()).WithFields(fields)
+}
+
+// channelIDLog returns the logger of the client annotated with id.
+func (c *PaymentClient) channelIDLog(id channel.ID) logrus.FieldLogger {
+	return c.log.WithField(LogFieldChannel, hex.EncodeToString(id[:]))
+}
+
+// formatPeer formats the off-chain address of a peer for the log.
+func formatPeer(addr wire.Address) string {
+	switch a := addr.(type) {
+	case *simple.Address: // The demo uses the public key as address.
+		return string(*a)
+	case fmt.Stringer:
+		return a.String()
+	}
+	b, _ := addr.MarshalBinary()
+	return hex.EncodeToString(b)
+}
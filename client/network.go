@@ -0,0 +1,74 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"perun.network/go-perun/wire"
+	"perun.network/go-perun/wire/net"
+	"perun.network/go-perun/wire/net/simple"
+	"perun.network/go-perun/wire/perunio/serializer"
+	"perun.network/perun-cardano-backend/wallet/address"
+)
+
+// PeerAddress maps the off-chain identity of a peer to the host it listens on.
+type PeerAddress struct {
+	WireAddress wire.Address
+	Host        string // Host is the host:port of the peer.
+}
+
+// WireAddressFromPubKey returns the off-chain address used by a client with the
+// given hex-encoded public key.
+func WireAddressFromPubKey(pubKey string) (wire.Address, error) {
+	pubKeyBytes, err := hex.DecodeString(pubKey)
+	if err != nil {
+		return nil, fmt.Errorf("decoding public key: %w", err)
+	}
+	addr, err := address.MakeAddressFromPubKeyByteSlice(pubKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	return simple.NewAddress(addr.String()), nil
+}
+
+// NewTCPBus creates a wire bus for the client with the given off-chain address.
+// The bus accepts peer connections on listenAddr and dials the given peers
+// on demand.
+func NewTCPBus(
+	addr wire.Address,
+	listenAddr string,
+	peers []PeerAddress,
+	dialTimeout time.Duration,
+) (*net.Bus, error) {
+	simpleAddr, ok := addr.(*simple.Address)
+	if !ok {
+		return nil, fmt.Errorf("unsupported wire address type: %T", addr)
+	}
+	listener, err := simple.NewTCPListener(listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s: %w", listenAddr, err)
+	}
+	dialer := simple.NewTCPDialer(dialTimeout)
+	for _, p := range peers {
+		dialer.Register(p.WireAddress, p.Host)
+	}
+
+	bus := net.NewBus(simple.NewAccount(simpleAddr), dialer, serializer.Serializer())
+	go bus.Listen(listener)
+	return bus, nil
+}
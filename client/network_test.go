@@ -0,0 +1,45 @@
+package client_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/wire"
+	"perun.network/perun-cardano-demo/client"
+)
+
+const (
+	pubKeyBob  = "04960fbc5fe4f1ae939fdfed8a13569384474db2a38ce7b65b328d1cd578fded"
+	aliceHost  = "127.0.0.1:15750"
+	bobHost    = "127.0.0.1:15751"
+	busTimeout = 5 * time.Second
+)
+
+func TestTCPBus(t *testing.T) {
+	alice, err := client.WireAddressFromPubKey(pubKeyAlice)
+	require.NoError(t, err)
+	bob, err := client.WireAddressFromPubKey(pubKeyBob)
+	require.NoError(t, err)
+
+	aliceBus, err := client.NewTCPBus(alice, aliceHost, []client.PeerAddress{{WireAddress: bob, Host: bobHost}}, busTimeout)
+	require.NoError(t, err)
+	defer aliceBus.Close()
+	bobBus, err := client.NewTCPBus(bob, bobHost, []client.PeerAddress{{WireAddress: alice, Host: aliceHost}}, busTimeout)
+	require.NoError(t, err)
+	defer bobBus.Close()
+
+	recv := wire.NewReceiver()
+	defer recv.Close()
+	require.NoError(t, bobBus.SubscribeClient(recv, bob))
+
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+	require.NoError(t, aliceBus.Publish(ctx, &wire.Envelope{Sender: alice, Recipient: bob, Msg: wire.NewPingMsg()}))
+
+	env, err := recv.Next(ctx)
+	require.NoError(t, err)
+	require.True(t, env.Sender.Equal(alice))
+	require.Equal(t, wire.Ping, env.Msg.Type())
+}
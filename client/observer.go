@@ -0,0 +1,112 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"perun.network/go-perun/channel"
+	tuiclient "perun.network/perun-demo-tui/client"
+)
+
+// DataObserver is an optional extension of tuiclient.Observer for observers
+// that need structured data instead of the text representation, e.g. API
+// subscribers. Registered observers implementing it are notified through both
+// interfaces.
+type DataObserver interface {
+	tuiclient.Observer
+
+	// UpdateChannel is called with the new state of ch. The state must not be
+	// modified and ch.State must not be called from within the callback.
+	UpdateChannel(ch *PaymentChannel, state *channel.State)
+
+	// UpdateLovelaceBalance is called with the new on-chain balance.
+	UpdateLovelaceBalance(bal int64)
+
+	// UpdateError is called when an operation of the client failed.
+	UpdateError(err error)
+}
+
+// ProposalObserver is an optional extension of tuiclient.Observer for
+// observers that let the user decide on proposals queued by the AskUser
+// policy.
+type ProposalObserver interface {
+	tuiclient.Observer
+
+	// ProposalPending is called when a proposal awaits a decision.
+	ProposalPending(p *PendingProposal)
+}
+
+// RequestObserver is an optional extension of tuiclient.Observer for
+// observers that let the user decide on payment requests queued by the
+// AskUserRequests policy.
+type RequestObserver interface {
+	tuiclient.Observer
+
+	// PaymentRequestPending is called when a payment request awaits a
+	// decision.
+	PaymentRequestPending(r *PendingRequest)
+}
+
+// RejectionObserver is an optional extension of tuiclient.Observer for
+// observers that need structured data about proposals and updates the client
+// rejected.
+type RejectionObserver interface {
+	tuiclient.Observer
+
+	// UpdateRejection is called when the client rejected a proposal or
+	// update.
+	UpdateRejection(r *Rejection)
+}
+
+// ChannelEventObserver is an optional extension of tuiclient.Observer for
+// observers that need structured data about on-chain channel events, e.g. to
+// warn the user about disputes.
+type ChannelEventObserver interface {
+	tuiclient.Observer
+
+	// UpdateChannelEvent is called when an on-chain event of a channel was
+	// handled.
+	UpdateChannelEvent(e ChannelEvent)
+}
+
+// ForceCloseObserver is an optional extension of tuiclient.Observer for
+// observers that need structured data about the progress of force-closing a
+// channel.
+type ForceCloseObserver interface {
+	tuiclient.Observer
+
+	// UpdateForceClose is called when force-closing a channel progressed.
+	UpdateForceClose(p ForceCloseProgress)
+}
+
+// InvoiceObserver is an optional extension of tuiclient.Observer for
+// observers that need to know when invoices are paid, e.g. to reconcile
+// payments with orders.
+type InvoiceObserver interface {
+	tuiclient.Observer
+
+	// UpdateInvoice is called when an invoice was paid.
+	UpdateInvoice(inv Invoice)
+}
+
+// StreamObserver is an optional extension of tuiclient.Observer for
+// observers that need to know the progress and throughput of payment
+// streams.
+type StreamObserver interface {
+	tuiclient.Observer
+
+	// UpdateStream is called after every payment of a stream and when it
+	// ends.
+	UpdateStream(s StreamStatus)
+}
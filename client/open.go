@@ -0,0 +1,82 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import "fmt"
+
+// DefaultChallengeDuration is the challenge duration in seconds of channels
+// opened by a client unless configured otherwise.
+const DefaultChallengeDuration uint64 = 10
+
+// WithDefaultChallengeDuration sets the challenge duration in seconds of the
+// channels the client proposes. It can be overridden per channel with
+// WithChallengeDuration.
+func WithDefaultChallengeDuration(seconds uint64) Option {
+	return func(c *PaymentClient) {
+		c.challengeDuration = seconds
+	}
+}
+
+// OpenOption configures a channel proposal of OpenChannel.
+type OpenOption func(*openParams)
+
+// openParams are the parameters of a channel proposal.
+type openParams struct {
+	ownDeposit        Amount
+	peerDeposit       Amount
+	challengeDuration uint64 // challengeDuration is in seconds.
+}
+
+// WithPeerDeposit sets the deposit the peer is asked for. By default, the
+// peer deposits the same amount as the proposer. A zero deposit opens a
+// channel in which only the proposer can pay, e.g. a customer paying a
+// merchant. Peers reject unequal deposits unless their proposal policy opts
+// in to them, see EqualFunding.
+func WithPeerDeposit(a Amount) OpenOption {
+	return func(p *openParams) {
+		p.peerDeposit = a
+	}
+}
+
+// WithChallengeDuration sets the challenge duration of the channel in
+// seconds. The peer must accept it with its proposal policy.
+func WithChallengeDuration(seconds uint64) OpenOption {
+	return func(p *openParams) {
+		p.challengeDuration = seconds
+	}
+}
+
+// openParams returns the parameters of a proposal with the given own deposit.
+func (c *PaymentClient) openParams(deposit Amount, opts []OpenOption) (openParams, error) {
+	p := openParams{
+		ownDeposit:        deposit,
+		peerDeposit:       deposit,
+		challengeDuration: c.challengeDuration,
+	}
+	for _, opt := range opts {
+		opt(&p)
+	}
+	switch {
+	case p.ownDeposit < 0:
+		return p, &OpError{Op: "open channel", Kind: ErrInvalidAmount, Err: fmt.Errorf("own deposit %v", p.ownDeposit)}
+	case p.peerDeposit < 0:
+		return p, &OpError{Op: "open channel", Kind: ErrInvalidAmount, Err: fmt.Errorf("peer deposit %v", p.peerDeposit)}
+	case p.ownDeposit == 0 && p.peerDeposit == 0:
+		return p, &OpError{Op: "open channel", Kind: ErrInvalidAmount, Err: fmt.Errorf("no deposits")}
+	case p.challengeDuration == 0:
+		return p, &OpError{Op: "open channel", Kind: ErrInvalidParams, Err: fmt.Errorf("zero challenge duration")}
+	}
+	return p, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/channel/persistence"
+	"perun.network/go-perun/channel/persistence/keyvalue"
+	"perun.network/go-perun/client"
+	"polycry.pt/poly-go/sortedkv/leveldb"
+)
+
+// NewLevelDBPersistRestorer opens or creates a LevelDB database at path and
+// returns a PersistRestorer backed by it.
+func NewLevelDBPersistRestorer(path string) (*keyvalue.PersistRestorer, error) {
+	db, err := leveldb.LoadDatabase(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening channel database: %w", err)
+	}
+	return keyvalue.NewPersistRestorer(db), nil
+}
+
+// WithPersistence makes the client persist its channels with pr. Channels
+// found in pr are restored during setup. The client closes pr on Shutdown.
+func WithPersistence(pr persistence.PersistRestorer) Option {
+	return func(c *PaymentClient) {
+		c.persister = pr
+	}
+}
+
+// restore restores the persisted channels, registers them and resumes
+// watching them on-chain. Channels in a dispute are force-closed.
+func (c *PaymentClient) restore(ctx context.Context) error {
+	c.PerunClient.EnablePersistence(c.persister)
+	// Restored channels are handed to OnNewChannel. Channels opened later pass
+	// it as well, which is harmless as registering a channel is idempotent.
+	c.PerunClient.OnNewChannel(func(ch *client.Channel) { c.addChannel(ch) })
+
+	ctx, cancel := c.opContext(ctx, c.timeouts.Open)
+	defer cancel()
+	if err := c.PerunClient.Restore(ctx); err != nil {
+		return fmt.Errorf("restoring channels: %w", err)
+	}
+	for _, ch := range c.channels.list() {
+		c.startWatching(ch.ch)
+		if inDispute(ch.ch.Phase()) {
+			ch := ch
+			ch.setPhase(PhaseDisputed)
+			c.ops.goroutine(func() { c.resumeForceClose(ch) })
+		}
+	}
+	return nil
+}
+
+// inDispute returns whether a channel in the given phase was registered
+// on-chain or is being withdrawn.
+func inDispute(p channel.Phase) bool {
+	switch p {
+	case channel.Registering, channel.Registered, channel.Progressing, channel.Progressed, channel.Withdrawing:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"perun.network/go-perun/client"
+	"perun.network/go-perun/wire"
+)
+
+// Proposal is an incoming channel proposal as presented to a ProposalPolicy.
+type Proposal struct {
+	Peer              wire.Address // Peer is the proposer.
+	PeerDeposit       *big.Int     // PeerDeposit is the proposer's deposit in Lovelace.
+	OwnDeposit        *big.Int     // OwnDeposit is our deposit in Lovelace.
+	ChallengeDuration uint64       // ChallengeDuration is in seconds.
+	OpenChannels      int          // OpenChannels is the number of our open channels.
+	Msg               *client.LedgerChannelProposalMsg
+
+	prompts *ProposalQueue // prompts is used by AskUser.
+}
+
+// ProposalPolicy decides whether to accept an incoming channel proposal.
+// CheckProposal returns nil to accept the proposal. Rejections should be
+// returned as RejectionError so that the peer learns the reason.
+type ProposalPolicy interface {
+	CheckProposal(ctx context.Context, p *Proposal) error
+}
+
+// ProposalPolicyFunc adapts a function to the ProposalPolicy interface.
+type ProposalPolicyFunc func(ctx context.Context, p *Proposal) error
+
+// CheckProposal calls f.
+func (f ProposalPolicyFunc) CheckProposal(ctx context.Context, p *Proposal) error {
+	return f(ctx, p)
+}
+
+// WithProposalPolicy sets the policy for incoming channel proposals. By
+// default, EqualFunding is used, so that a peer cannot make us deposit more
+// than it does. Policies without EqualFunding opt in to unequal funding and
+// should bound our deposit with FundingLimits.
+func WithProposalPolicy(p ProposalPolicy) Option {
+	return func(c *PaymentClient) {
+		c.proposalPolicy = p
+	}
+}
+
+// AcceptAllProposals accepts every valid proposal.
+var AcceptAllProposals ProposalPolicy = ProposalPolicyFunc(func(context.Context, *Proposal) error {
+	return nil
+})
+
+// AllProposals combines policies. A proposal is accepted if all policies
+// accept it. The policies are checked in order and the first rejection is
+// returned, so interactive policies should come last.
+func AllProposals(policies ...ProposalPolicy) ProposalPolicy {
+	return ProposalPolicyFunc(func(ctx context.Context, p *Proposal) error {
+		for _, policy := range policies {
+			if err := policy.CheckProposal(ctx, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AllowPeers only accepts proposals from the given peers.
+func AllowPeers(peers ...wire.Address) ProposalPolicy {
+	return ProposalPolicyFunc(func(_ context.Context, p *Proposal) error {
+		if !containsAddress(peers, p.Peer) {
+			return Reject(ReasonPeerNotAllowed, "peer is not on the allow list")
+		}
+		return nil
+	})
+}
+
+// DenyPeers rejects proposals from the given peers.
+func DenyPeers(peers ...wire.Address) ProposalPolicy {
+	return ProposalPolicyFunc(func(_ context.Context, p *Proposal) error {
+		if containsAddress(peers, p.Peer) {
+			return Reject(ReasonPeerNotAllowed, "peer is on the deny list")
+		}
+		return nil
+	})
+}
+
+// FundingLimits bounds the deposits of a proposal in Lovelace. Zero values
+// are not checked.
+type FundingLimits struct {
+	MinPeerDeposit int64 // MinPeerDeposit is the minimum deposit of the proposer.
+	MaxPeerDeposit int64 // MaxPeerDeposit is the maximum deposit of the proposer.
+	MaxOwnDeposit  int64 // MaxOwnDeposit is the maximum deposit we are asked for.
+}
+
+// CheckProposal implements ProposalPolicy.
+func (l FundingLimits) CheckProposal(_ context.Context, p *Proposal) error {
+	switch {
+	case l.MinPeerDeposit != 0 && p.PeerDeposit.Cmp(big.NewInt(l.MinPeerDeposit)) < 0:
+		return Reject(ReasonFundingTooLow, "peer deposit %v below minimum %d Lovelace", p.PeerDeposit, l.MinPeerDeposit)
+	case l.MaxPeerDeposit != 0 && p.PeerDeposit.Cmp(big.NewInt(l.MaxPeerDeposit)) > 0:
+		return Reject(ReasonFundingTooHigh, "peer deposit %v above maximum %d Lovelace", p.PeerDeposit, l.MaxPeerDeposit)
+	case l.MaxOwnDeposit != 0 && p.OwnDeposit.Cmp(big.NewInt(l.MaxOwnDeposit)) > 0:
+		return Reject(ReasonFundingTooHigh, "own deposit %v above maximum %d Lovelace", p.OwnDeposit, l.MaxOwnDeposit)
+	}
+	return nil
+}
+
+// EqualFunding only accepts proposals in which we deposit as much as the
+// proposer. It is the default proposal policy. Without it, any deposits within
+// the FundingLimits are accepted, including channels in which we deposit
+// nothing or the proposer deposits nothing.
+var EqualFunding ProposalPolicy = ProposalPolicyFunc(func(_ context.Context, p *Proposal) error {
+	if p.PeerDeposit.Cmp(p.OwnDeposit) != 0 {
+		return Reject(ReasonFundingUnequal, "own deposit %v differs from peer deposit %v Lovelace", p.OwnDeposit, p.PeerDeposit)
+	}
+	return nil
+})
+
+// ChallengeDurationRange only accepts challenge durations in [min, max]. A
+// zero max is not checked.
+func ChallengeDurationRange(min, max uint64) ProposalPolicy {
+	return ProposalPolicyFunc(func(_ context.Context, p *Proposal) error {
+		if p.ChallengeDuration < min || (max != 0 && p.ChallengeDuration > max) {
+			return Reject(ReasonChallengeDuration, "challenge duration %d outside [%d, %d]", p.ChallengeDuration, min, max)
+		}
+		return nil
+	})
+}
+
+// MaxChannels rejects proposals if we already have n open channels.
+func MaxChannels(n int) ProposalPolicy {
+	return ProposalPolicyFunc(func(_ context.Context, p *Proposal) error {
+		if p.OpenChannels >= n {
+			return Reject(ReasonTooManyChannels, "%d of %d channels open", p.OpenChannels, n)
+		}
+		return nil
+	})
+}
+
+// AskUser queues proposals as pending until the user decides on them via
+// PaymentClient.DecideProposal. Undecided proposals are rejected after
+// timeout, or when the proposal handling times out if timeout is zero.
+//
+// The demo's terminal UI cannot show or answer pending proposals, so AskUser
+// is only useful in daemon mode, where proposals are listed and decided
+// through the HTTP API or the perun-cardano CLI.
+func AskUser(timeout time.Duration) ProposalPolicy {
+	return ProposalPolicyFunc(func(ctx context.Context, p *Proposal) error {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return p.prompts.ask(ctx, p)
+	})
+}
+
+func containsAddress(addrs []wire.Address, addr wire.Address) bool {
+	for _, a := range addrs {
+		if a.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/perun-cardano-demo/client"
+)
+
+func TestProposalPolicies(t *testing.T) {
+	ctx := context.Background()
+	alice, err := client.WireAddressFromPubKey(pubKeyAlice)
+	require.NoError(t, err)
+	bob, err := client.WireAddressFromPubKey(pubKeyBob)
+	require.NoError(t, err)
+	proposal := func() *client.Proposal {
+		return &client.Proposal{
+			Peer:              alice,
+			PeerDeposit:       big.NewInt(10_000_000),
+			OwnDeposit:        big.NewInt(5_000_000),
+			ChallengeDuration: 10,
+			OpenChannels:      1,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		policy client.ProposalPolicy
+		reason client.RejectReason // reason is empty if the proposal is accepted.
+	}{
+		{"accept all", client.AcceptAllProposals, ""},
+		{"allowed peer", client.AllowPeers(alice), ""},
+		{"peer not allowed", client.AllowPeers(bob), client.ReasonPeerNotAllowed},
+		{"denied peer", client.DenyPeers(bob, alice), client.ReasonPeerNotAllowed},
+		{"funding in range", client.FundingLimits{MinPeerDeposit: 10_000_000, MaxPeerDeposit: 10_000_000, MaxOwnDeposit: 5_000_000}, ""},
+		{"peer deposit too low", client.FundingLimits{MinPeerDeposit: 10_000_001}, client.ReasonFundingTooLow},
+		{"peer deposit too high", client.FundingLimits{MaxPeerDeposit: 9_999_999}, client.ReasonFundingTooHigh},
+		{"own deposit too high", client.FundingLimits{MaxOwnDeposit: 4_999_999}, client.ReasonFundingTooHigh},
+		{"unequal funding", client.EqualFunding, client.ReasonFundingUnequal},
+		{"challenge duration in range", client.ChallengeDurationRange(10, 10), ""},
+		{"challenge duration too short", client.ChallengeDurationRange(11, 0), client.ReasonChallengeDuration},
+		{"challenge duration too long", client.ChallengeDurationRange(0, 9), client.ReasonChallengeDuration},
+		{"below max channels", client.MaxChannels(2), ""},
+		{"max channels reached", client.MaxChannels(1), client.ReasonTooManyChannels},
+		{"all accept", client.AllProposals(client.AllowPeers(alice), client.MaxChannels(2)), ""},
+		{"first rejection wins", client.AllProposals(client.MaxChannels(1), client.AllowPeers(bob)), client.ReasonTooManyChannels},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.CheckProposal(ctx, proposal())
+			if tt.reason == "" {
+				require.NoError(t, err)
+				return
+			}
+			var rej *client.RejectionError
+			require.True(t, errors.As(err, &rej), "expected RejectionError, got %v", err)
+			require.Equal(t, tt.reason, rej.Reason)
+		})
+	}
+}
+
+func TestParseRejection(t *testing.T) {
+	rej := client.Reject(client.ReasonFundingTooLow, "deposit %d below %d", 1, 2)
+	parsed := client.ParseRejection(rej.Error())
+	require.Equal(t, rej, parsed)
+
+	parsed = client.ParseRejection("Invalid balance: 5")
+	require.Equal(t, client.ReasonUnknown, parsed.Reason)
+	require.Equal(t, "Invalid balance: 5", parsed.Msg)
+}
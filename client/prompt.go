@@ -0,0 +1,137 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PendingProposal is a channel proposal awaiting a decision of the user.
+type PendingProposal struct {
+	*Proposal
+	ID       string // ID is the hex-encoded proposal ID.
+	Received time.Time
+
+	decided  bool
+	decision chan error // decision receives nil to accept the proposal.
+}
+
+// ProposalQueue holds the proposals awaiting a decision of the user.
+type ProposalQueue struct {
+	mutex   sync.Mutex
+	pending map[string]*PendingProposal
+	order   []string
+	notify  func(*PendingProposal) // notify is called for new proposals.
+}
+
+func newProposalQueue(notify func(*PendingProposal)) *ProposalQueue {
+	return &ProposalQueue{
+		pending: make(map[string]*PendingProposal),
+		notify:  notify,
+	}
+}
+
+// ask queues p and waits until the user decides on it or ctx is done.
+func (q *ProposalQueue) ask(ctx context.Context, p *Proposal) error {
+	pp := &PendingProposal{
+		Proposal: p,
+		ID:       hex.EncodeToString(p.Msg.ProposalID[:]),
+		Received: time.Now(),
+		decision: make(chan error, 1),
+	}
+	q.mutex.Lock()
+	q.pending[pp.ID] = pp
+	q.order = append(q.order, pp.ID)
+	q.mutex.Unlock()
+	defer q.remove(pp.ID)
+
+	q.notify(pp)
+	select {
+	case err := <-pp.decision:
+		return err
+	case <-ctx.Done():
+		return Reject(ReasonUserDeclined, "no decision: %v", ctx.Err())
+	}
+}
+
+func (q *ProposalQueue) remove(id string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	delete(q.pending, id)
+	for i, o := range q.order {
+		if o == id {
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// list returns the undecided proposals in order of arrival.
+func (q *ProposalQueue) list() []*PendingProposal {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var pps []*PendingProposal
+	for _, id := range q.order {
+		if pp := q.pending[id]; !pp.decided {
+			pps = append(pps, pp)
+		}
+	}
+	return pps
+}
+
+// decide accepts or rejects the pending proposal with the given ID.
+func (q *ProposalQueue) decide(id string, accept bool, reason string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	pp, ok := q.pending[id]
+	if !ok || pp.decided {
+		return &OpError{Op: "decide proposal", Kind: ErrUnknownProposal, Err: fmt.Errorf("no pending proposal %s", id)}
+	}
+	pp.decided = true
+	if accept {
+		pp.decision <- nil
+	} else {
+		pp.decision <- Reject(ReasonUserDeclined, "%s", reason)
+	}
+	return nil
+}
+
+// PendingProposals returns the proposals awaiting a decision of the user in
+// order of arrival.
+func (c *PaymentClient) PendingProposals() []*PendingProposal {
+	return c.prompts.list()
+}
+
+// DecideProposal accepts or rejects the pending proposal with the given ID.
+// The reason is sent to the peer on rejection.
+func (c *PaymentClient) DecideProposal(id string, accept bool, reason string) error {
+	return c.prompts.decide(id, accept, reason)
+}
+
+// notifyProposalPending notifies the observers about a proposal that awaits a
+// decision.
+func (c *PaymentClient) notifyProposalPending(pp *PendingProposal) {
+	c.observerMutex.Lock()
+	defer c.observerMutex.Unlock()
+	for _, o := range c.observers {
+		if o, ok := o.(ProposalObserver); ok {
+			o.ProposalPending(pp)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wire"
+)
+
+// channelRegistry tracks the open payment channels of a client by channel ID
+// and peer.
+type channelRegistry struct {
+	mutex    sync.RWMutex
+	channels map[channel.ID]*PaymentChannel
+	order    []channel.ID // order lists the channel IDs in order of opening.
+}
+
+func newChannelRegistry() *channelRegistry {
+	return &channelRegistry{
+		channels: make(map[channel.ID]*PaymentChannel),
+	}
+}
+
+// add adds ch to the registry. If a channel with the same ID is already
+// registered, it returns the registered channel and false.
+func (r *channelRegistry) add(ch *PaymentChannel) (*PaymentChannel, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if existing, ok := r.channels[ch.ID()]; ok {
+		return existing, false
+	}
+	r.channels[ch.ID()] = ch
+	r.order = append(r.order, ch.ID())
+	return ch, true
+}
+
+// remove removes the channel with the given ID from the registry.
+func (r *channelRegistry) remove(id channel.ID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.channels[id]; !ok {
+		return
+	}
+	delete(r.channels, id)
+	for i, o := range r.order {
+		if o == id {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// get returns the channel with the given ID.
+func (r *channelRegistry) get(id channel.ID) (*PaymentChannel, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	ch, ok := r.channels[id]
+	return ch, ok
+}
+
+// list returns all channels in order of opening.
+func (r *channelRegistry) list() []*PaymentChannel {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	chs := make([]*PaymentChannel, len(r.order))
+	for i, id := range r.order {
+		chs[i] = r.channels[id]
+	}
+	return chs
+}
+
+// withPeer returns all channels with the given peer in order of opening.
+func (r *channelRegistry) withPeer(peer wire.Address) []*PaymentChannel {
+	var chs []*PaymentChannel
+	for _, ch := range r.list() {
+		if ch.Peer().Equal(peer) {
+			chs = append(chs, ch)
+		}
+	}
+	return chs
+}
+
+// latest returns the most recently opened channel.
+func (r *channelRegistry) latest() (*PaymentChannel, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if len(r.order) == 0 {
+		return nil, false
+	}
+	return r.channels[r.order[len(r.order)-1]], true
+}
+
+// len returns the number of channels.
+func (r *channelRegistry) len() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.order)
+}
+
+// ParseChannelID parses a hex-encoded channel ID.
+func ParseChannelID(s string) (channel.ID, error) {
+	var id channel.ID
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return id, fmt.Errorf("decoding channel id: %w", err)
+	}
+	if len(b) != len(id) {
+		return id, fmt.Errorf("invalid channel id length: expected %d bytes, got %d", len(id), len(b))
+	}
+	copy(id[:], b)
+	return id, nil
+}
@@ -0,0 +1,35 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/perun-cardano-demo/client"
+)
+
+func TestParseChannelID(t *testing.T) {
+	raw := "6f1cbd1f4dbf2b7d2b3cbb9e8e0a3e5c3d1f0a9b8c7d6e5f4a3b2c1d0e0f1a2b"
+	id, err := client.ParseChannelID(raw)
+	require.NoError(t, err)
+	require.Equal(t, raw, hex.EncodeToString(id[:]))
+
+	_, err = client.ParseChannelID("zz")
+	require.Error(t, err)
+	_, err = client.ParseChannelID("abcd")
+	require.Error(t, err)
+}
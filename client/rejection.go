@@ -0,0 +1,156 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/client"
+	"perun.network/go-perun/wire"
+)
+
+// RejectReason is a machine-readable reason for rejecting a proposal or
+// update. It is sent to the peer as prefix of the rejection message.
+type RejectReason string
+
+// Reasons for rejecting proposals and updates.
+const (
+	// ReasonInvalidProposal rejects proposals this client cannot handle, e.g.
+	// of a different channel type or currency.
+	ReasonInvalidProposal RejectReason = "invalid_proposal"
+	// ReasonPeerNotAllowed rejects proposals from peers that are not allowed
+	// or explicitly denied.
+	ReasonPeerNotAllowed RejectReason = "peer_not_allowed"
+	// ReasonFundingTooLow rejects proposals with a deposit below the minimum.
+	ReasonFundingTooLow RejectReason = "funding_too_low"
+	// ReasonFundingTooHigh rejects proposals with a deposit above the maximum.
+	ReasonFundingTooHigh RejectReason = "funding_too_high"
+	// ReasonFundingUnequal rejects proposals in which the parties deposit
+	// different amounts.
+	ReasonFundingUnequal RejectReason = "funding_unequal"
+	// ReasonChallengeDuration rejects proposals with a challenge duration
+	// outside the allowed range.
+	ReasonChallengeDuration RejectReason = "challenge_duration"
+	// ReasonTooManyChannels rejects proposals if the maximum number of
+	// concurrent channels is reached.
+	ReasonTooManyChannels RejectReason = "too_many_channels"
+	// ReasonUserDeclined rejects proposals the user declined or did not
+	// answer in time.
+	ReasonUserDeclined RejectReason = "user_declined"
+	// ReasonInvalidUpdate rejects updates that decrease our balance or that
+	// this client cannot handle.
+	ReasonInvalidUpdate RejectReason = "invalid_update"
+	// ReasonChannelChanged rejects updates that change more than the
+	// balances of the channel.
+	ReasonChannelChanged RejectReason = "channel_changed"
+	// ReasonPaymentLimit rejects payments outside the allowed range.
+	ReasonPaymentLimit RejectReason = "payment_limit"
+	// ReasonPeriodLimit rejects payments that exceed the amount allowed per
+	// period.
+	ReasonPeriodLimit RejectReason = "period_limit"
+	// ReasonPaymentsPending rejects finalization while payments are in
+	// flight.
+	ReasonPaymentsPending RejectReason = "payments_pending"
+	// ReasonUpdatePending rejects updates that arrive while a conditional
+	// update of our own is sent.
+	ReasonUpdatePending RejectReason = "update_pending"
+	// ReasonInvalidInvoice rejects payments of invoices that are unknown,
+	// already paid or expired, or whose amount does not match.
+	ReasonInvalidInvoice RejectReason = "invalid_invoice"
+	// ReasonInvalidRequest declines payment requests for unknown channels,
+	// of non-positive amounts or above our balance.
+	ReasonInvalidRequest RejectReason = "invalid_request"
+	// ReasonRequestDeclined declines payment requests if requests are not
+	// accepted.
+	ReasonRequestDeclined RejectReason = "request_declined"
+	// ReasonShuttingDown rejects proposals, updates and payment requests
+	// that arrive while the client shuts down.
+	ReasonShuttingDown RejectReason = "shutting_down"
+	// ReasonUnknown is the reason of rejections without a known reason
+	// prefix.
+	ReasonUnknown RejectReason = "unknown"
+)
+
+// RejectionError is a rejection with a machine-readable reason.
+type RejectionError struct {
+	Reason RejectReason
+	Msg    string
+}
+
+// Reject returns a RejectionError with the given reason and formatted
+// message.
+func Reject(reason RejectReason, format string, args ...interface{}) *RejectionError {
+	return &RejectionError{Reason: reason, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *RejectionError) Error() string {
+	if e.Msg == "" {
+		return string(e.Reason)
+	}
+	return string(e.Reason) + ": " + e.Msg
+}
+
+// asRejection converts err to a RejectionError. Errors that are not a
+// rejection are classified with the given fallback reason.
+func asRejection(err error, fallback RejectReason) *RejectionError {
+	var rej *RejectionError
+	if errors.As(err, &rej) {
+		return rej
+	}
+	return &RejectionError{Reason: fallback, Msg: err.Error()}
+}
+
+// ParseRejection parses a rejection message as sent by Reject.
+func ParseRejection(msg string) *RejectionError {
+	reason, rest := msg, ""
+	if i := strings.Index(msg, ":"); i >= 0 {
+		reason, rest = msg[:i], msg[i+1:]
+	}
+	if reason == "" || strings.ContainsAny(reason, " \t\n") {
+		return &RejectionError{Reason: ReasonUnknown, Msg: msg}
+	}
+	return &RejectionError{Reason: RejectReason(reason), Msg: strings.TrimSpace(rest)}
+}
+
+// PeerRejection returns the rejection sent by the peer if err was caused by
+// the peer rejecting a proposal or update.
+func PeerRejection(err error) (*RejectionError, bool) {
+	var rejected client.PeerRejectedError
+	if !errors.As(err, &rejected) {
+		return nil, false
+	}
+	return ParseRejection(rejected.Reason), true
+}
+
+// RejectedItem is the kind of item rejected by this client.
+type RejectedItem string
+
+// Items rejected by this client.
+const (
+	RejectedProposal RejectedItem = "channel proposal"
+	RejectedUpdate   RejectedItem = "channel update"
+	RejectedRequest  RejectedItem = "payment request"
+)
+
+// Rejection describes a proposal or update that this client rejected.
+type Rejection struct {
+	Item      RejectedItem
+	ChannelID channel.ID   // ChannelID is zero for proposals.
+	Peer      wire.Address // Peer is nil if the peer is unknown.
+	*RejectionError
+}
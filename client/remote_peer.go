@@ -0,0 +1,70 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wire"
+	tuiclient "perun.network/perun-demo-tui/client"
+)
+
+// RemotePeer represents a party that runs in another process. It implements
+// tuiclient.DemoClient so that it can be selected as channel peer in the demo
+// UI, but it cannot be operated from this process.
+type RemotePeer struct {
+	Name              string
+	PaymentIdentifier string // PaymentIdentifier is hex-encoded and only used for display.
+	Address           wire.Address
+}
+
+// DisplayName returns the name of the peer.
+func (p *RemotePeer) DisplayName() string {
+	return p.Name + " (remote)"
+}
+
+// DisplayAddress returns the payment identifier of the peer.
+func (p *RemotePeer) DisplayAddress() string {
+	return p.PaymentIdentifier
+}
+
+// WireAddress returns the off-chain address of the peer.
+func (p *RemotePeer) WireAddress() wire.Address {
+	return p.Address
+}
+
+// OpenChannel does nothing, channels must be opened by the remote process.
+func (p *RemotePeer) OpenChannel(wire.Address, float64) {}
+
+// SendPaymentToPeer does nothing, payments must be sent by the remote process.
+func (p *RemotePeer) SendPaymentToPeer(float64) {}
+
+// Settle does nothing, the remote process settles its own channels.
+func (p *RemotePeer) Settle() {}
+
+// HasOpenChannel always returns false because the channels of a remote peer
+// are not visible to this process.
+func (p *RemotePeer) HasOpenChannel() bool {
+	return false
+}
+
+func (p *RemotePeer) Register(observer tuiclient.Observer) {
+	observer.UpdateState("Channels of remote peers are managed by their own process.")
+}
+
+func (p *RemotePeer) Deregister(tuiclient.Observer) {}
+
+func (p *RemotePeer) NotifyAllState(_, _ *channel.State) {}
+
+func (p *RemotePeer) NotifyAllBalance(int64) {}
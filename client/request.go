@@ -0,0 +1,338 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/client"
+	"perun.network/go-perun/wire"
+	"perun.network/go-perun/wire/perunio"
+)
+
+// PaymentRequest is a request of a channel peer to pay it, as presented to a
+// RequestPolicy. It is answered with a payment of the invoice.
+type PaymentRequest struct {
+	Channel     *PaymentChannel
+	Peer        wire.Address // Peer requested the payment.
+	Amount      Amount
+	Description string
+	Invoice     string // Invoice is the ID of the peer's invoice paid by the payment.
+	Received    time.Time
+
+	prompts *RequestQueue // prompts is used by AskUserRequests.
+}
+
+// PendingRequest is a payment request awaiting a decision of the user.
+type PendingRequest struct {
+	*PaymentRequest
+	ID string // ID is the ID of the invoice.
+
+	decided  bool
+	decision chan error // decision receives nil to pay the request.
+}
+
+// RequestQueue holds the payment requests awaiting a decision of the user.
+type RequestQueue struct {
+	mutex   sync.Mutex
+	pending map[string]*PendingRequest
+	order   []string
+	notify  func(*PendingRequest) // notify is called for new requests.
+}
+
+func newRequestQueue(notify func(*PendingRequest)) *RequestQueue {
+	return &RequestQueue{
+		pending: make(map[string]*PendingRequest),
+		notify:  notify,
+	}
+}
+
+// ask queues r and waits until the user decides on it or ctx is done.
+func (q *RequestQueue) ask(ctx context.Context, r *PaymentRequest) error {
+	pr := &PendingRequest{
+		PaymentRequest: r,
+		ID:             r.Invoice,
+		decision:       make(chan error, 1),
+	}
+	q.mutex.Lock()
+	if _, ok := q.pending[pr.ID]; ok {
+		q.mutex.Unlock()
+		return Reject(ReasonInvalidRequest, "duplicate request %s", pr.ID)
+	}
+	q.pending[pr.ID] = pr
+	q.order = append(q.order, pr.ID)
+	q.mutex.Unlock()
+	defer q.remove(pr.ID)
+
+	q.notify(pr)
+	select {
+	case err := <-pr.decision:
+		return err
+	case <-ctx.Done():
+		return Reject(ReasonUserDeclined, "no decision: %v", ctx.Err())
+	}
+}
+
+func (q *RequestQueue) remove(id string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	delete(q.pending, id)
+	for i, o := range q.order {
+		if o == id {
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// list returns the undecided requests in order of arrival.
+func (q *RequestQueue) list() []*PendingRequest {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var prs []*PendingRequest
+	for _, id := range q.order {
+		if pr := q.pending[id]; !pr.decided {
+			prs = append(prs, pr)
+		}
+	}
+	return prs
+}
+
+// decide pays or declines the pending request with the given ID.
+func (q *RequestQueue) decide(id string, pay bool, reason string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	pr, ok := q.pending[id]
+	if !ok || pr.decided {
+		return &OpError{Op: "decide payment request", Kind: ErrUnknownRequest, Err: fmt.Errorf("no pending request %s", id)}
+	}
+	pr.decided = true
+	if pay {
+		pr.decision <- nil
+	} else {
+		pr.decision <- Reject(ReasonUserDeclined, "%s", reason)
+	}
+	return nil
+}
+
+// PendingRequests returns the payment requests awaiting a decision of the
+// user in order of arrival.
+func (c *PaymentClient) PendingRequests() []*PendingRequest {
+	return c.requests.list()
+}
+
+// DecideRequest pays or declines the pending payment request with the given
+// ID. The reason is sent to the peer if the request is declined.
+func (c *PaymentClient) DecideRequest(id string, pay bool, reason string) error {
+	return c.requests.decide(id, pay, reason)
+}
+
+// notifyRequestPending notifies the observers about a payment request that
+// awaits a decision.
+func (c *PaymentClient) notifyRequestPending(pr *PendingRequest) {
+	c.observerMutex.Lock()
+	defer c.observerMutex.Unlock()
+	for _, o := range c.observers {
+		if o, ok := o.(RequestObserver); ok {
+			o.PaymentRequestPending(pr)
+		}
+	}
+}
+
+// paymentRequestMsg requests the payment of an invoice in a channel.
+type paymentRequestMsg struct {
+	ChannelID   channel.ID
+	Invoice     string
+	Amount      Amount
+	Description string
+}
+
+// paymentDeclinedMsg answers a payment request that the payer declined.
+type paymentDeclinedMsg struct {
+	ChannelID channel.ID
+	Invoice   string
+	Reason    string // Reason is the rejection as sent by Reject.
+}
+
+func init() {
+	wire.RegisterExternalDecoder(paymentRequestMsgType, func(r io.Reader) (wire.Msg, error) {
+		var msg paymentRequestMsg
+		return &msg, msg.Decode(r)
+	}, "PaymentRequest")
+	wire.RegisterExternalDecoder(paymentDeclinedMsgType, func(r io.Reader) (wire.Msg, error) {
+		var msg paymentDeclinedMsg
+		return &msg, perunio.Decode(r, &msg.ChannelID, &msg.Invoice, &msg.Reason)
+	}, "PaymentDeclined")
+}
+
+// Type implements wire.Msg.
+func (*paymentRequestMsg) Type() wire.Type {
+	return paymentRequestMsgType
+}
+
+// Encode implements perunio.Encoder.
+func (m *paymentRequestMsg) Encode(w io.Writer) error {
+	return perunio.Encode(w, m.ChannelID, m.Invoice, int64(m.Amount), m.Description)
+}
+
+// Decode implements perunio.Decoder.
+func (m *paymentRequestMsg) Decode(r io.Reader) error {
+	var amount int64
+	if err := perunio.Decode(r, &m.ChannelID, &m.Invoice, &amount, &m.Description); err != nil {
+		return err
+	}
+	m.Amount = Amount(amount)
+	return nil
+}
+
+// Type implements wire.Msg.
+func (*paymentDeclinedMsg) Type() wire.Type {
+	return paymentDeclinedMsgType
+}
+
+// Encode implements perunio.Encoder.
+func (m *paymentDeclinedMsg) Encode(w io.Writer) error {
+	return perunio.Encode(w, m.ChannelID, m.Invoice, m.Reason)
+}
+
+// RequestPayment requests the channel peer to pay amount in the channel with
+// the given ID. It creates an invoice for the request and returns it once the
+// peer paid it. If the peer declines the request, the error is of kind
+// ErrPeerRejected. The request expires with the request timeout. Errors are
+// also reported to the observers.
+func (c *PaymentClient) RequestPayment(ctx context.Context, id channel.ID, amount Amount, description string) (Invoice, error) {
+	if !c.ops.begin() {
+		return Invoice{}, c.notifyError(&OpError{Op: "request payment", Kind: ErrShuttingDown, Err: ErrShuttingDown})
+	}
+	defer c.ops.end()
+	ctx, cancel := c.opContext(ctx, c.timeouts.Request)
+	defer cancel()
+	inv, err := c.requestPayment(ctx, id, amount, description)
+	return inv, c.notifyError(err)
+}
+
+func (c *PaymentClient) requestPayment(ctx context.Context, id channel.ID, amount Amount, description string) (Invoice, error) {
+	ch, err := c.Channel(id)
+	if err != nil {
+		return Invoice{}, err
+	}
+	if amount > 0 {
+		peer := 1 - ch.Idx()
+		if bal := ch.State().Allocation.Balance(peer, c.currency); bal.Cmp(amount.Bal()) < 0 {
+			return Invoice{}, &OpError{
+				Op:   "request payment",
+				Kind: ErrInsufficientBalance,
+				Err:  fmt.Errorf("cannot request %v Lovelace from a peer balance of %v Lovelace", amount.Lovelace(), bal),
+			}
+		}
+	}
+	inv, err := c.CreateInvoice(amount, description, c.timeouts.Request)
+	if err != nil {
+		return Invoice{}, err
+	}
+	done := c.invoices.await(inv.ID)
+	defer c.invoices.stopAwait(inv.ID)
+	msg := &paymentRequestMsg{ChannelID: id, Invoice: inv.ID, Amount: amount, Description: description}
+	if err := c.publish(ctx, ch.Peer(), msg); err != nil {
+		return Invoice{}, newOpError("request payment", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return Invoice{}, newOpError("request payment", err)
+		}
+		return c.Invoice(inv.ID)
+	case <-ctx.Done():
+		return Invoice{}, newOpError("request payment", ctx.Err())
+	}
+}
+
+// handlePaymentRequest checks an incoming payment request against the request
+// policy and pays or declines it.
+func (c *PaymentClient) handlePaymentRequest(sender wire.Address, msg *paymentRequestMsg) {
+	ctx, cancel := c.opContext(context.Background(), c.timeouts.Request)
+	defer cancel()
+	d := &requestDecliner{c: c, peer: sender, msg: msg}
+	if !c.ops.begin() {
+		c.reject(ctx, d, d.rejection(Reject(ReasonShuttingDown, "client is shutting down")))
+		return
+	}
+	defer c.ops.end()
+	r, err := c.validateRequest(sender, msg)
+	if err == nil {
+		err = c.requestPolicy.CheckRequest(ctx, r)
+	}
+	if err != nil {
+		c.reject(ctx, d, d.rejection(asRejection(err, ReasonUnknown)))
+		return
+	}
+
+	c.channelIDLog(msg.ChannelID).WithField("invoice", msg.Invoice).Infof("Paying requested %v", msg.Amount)
+	// SendPayment reports errors to the observers. The peer learns about them
+	// from the rejected update or once the request expires.
+	_ = c.SendPayment(ctx, msg.ChannelID, msg.Amount, WithInvoice(msg.Invoice), WithMemo(msg.Description))
+}
+
+// validateRequest checks that the request can be paid and returns it for
+// evaluation by the request policy.
+func (c *PaymentClient) validateRequest(sender wire.Address, msg *paymentRequestMsg) (*PaymentRequest, error) {
+	r := &PaymentRequest{
+		Peer:        sender,
+		Amount:      msg.Amount,
+		Description: msg.Description,
+		Invoice:     msg.Invoice,
+		Received:    time.Now(),
+		prompts:     c.requests,
+	}
+	ch, ok := c.channels.get(msg.ChannelID)
+	if !ok || !ch.Peer().Equal(sender) {
+		return r, Reject(ReasonInvalidRequest, "unknown channel %x", msg.ChannelID)
+	}
+	r.Channel = ch
+	if msg.Amount <= 0 {
+		return r, Reject(ReasonInvalidRequest, "invalid amount %v", msg.Amount)
+	}
+	if bal := ch.State().Allocation.Balance(ch.Idx(), c.currency); bal.Cmp(msg.Amount.Bal()) < 0 {
+		return r, Reject(ReasonInvalidRequest, "insufficient balance of %v Lovelace", bal)
+	}
+	return r, nil
+}
+
+// requestDecliner sends the rejection of a payment request to the peer.
+type requestDecliner struct {
+	c    *PaymentClient
+	peer wire.Address
+	msg  *paymentRequestMsg
+}
+
+// Reject implements rejecter.
+func (d *requestDecliner) Reject(ctx context.Context, reason string) error {
+	return d.c.publish(ctx, d.peer, &paymentDeclinedMsg{ChannelID: d.msg.ChannelID, Invoice: d.msg.Invoice, Reason: reason})
+}
+
+func (d *requestDecliner) rejection(err *RejectionError) *Rejection {
+	return &Rejection{Item: RejectedRequest, ChannelID: d.msg.ChannelID, Peer: d.peer, RejectionError: err}
+}
+
+// declined reports that the peer declined our payment request.
+func (c *PaymentClient) declined(msg *paymentDeclinedMsg) {
+	c.invoices.decline(msg.Invoice, client.PeerRejectedError{ItemType: string(RejectedRequest), Reason: msg.Reason})
+}
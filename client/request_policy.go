@@ -0,0 +1,113 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"time"
+
+	"perun.network/go-perun/wire"
+)
+
+// RequestPolicy decides whether to pay an incoming payment request.
+// CheckRequest returns nil to pay the request. Declines should be returned
+// as RejectionError so that the peer learns the reason.
+type RequestPolicy interface {
+	CheckRequest(ctx context.Context, r *PaymentRequest) error
+}
+
+// RequestPolicyFunc adapts a function to the RequestPolicy interface.
+type RequestPolicyFunc func(ctx context.Context, r *PaymentRequest) error
+
+// CheckRequest calls f.
+func (f RequestPolicyFunc) CheckRequest(ctx context.Context, r *PaymentRequest) error {
+	return f(ctx, r)
+}
+
+// WithRequestPolicy sets the policy for incoming payment requests. By
+// default, all requests are declined.
+func WithRequestPolicy(p RequestPolicy) Option {
+	return func(c *PaymentClient) {
+		c.requestPolicy = p
+	}
+}
+
+// DeclineRequests declines every payment request.
+var DeclineRequests RequestPolicy = RequestPolicyFunc(func(context.Context, *PaymentRequest) error {
+	return Reject(ReasonRequestDeclined, "payment requests are not accepted")
+})
+
+// ApproveRequests pays every valid payment request.
+var ApproveRequests RequestPolicy = RequestPolicyFunc(func(context.Context, *PaymentRequest) error {
+	return nil
+})
+
+// AllRequests combines policies. A request is paid if all policies approve
+// it. The policies are checked in order and the first decline is returned,
+// so interactive policies should come last.
+func AllRequests(policies ...RequestPolicy) RequestPolicy {
+	return RequestPolicyFunc(func(ctx context.Context, r *PaymentRequest) error {
+		for _, policy := range policies {
+			if err := policy.CheckRequest(ctx, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RequestsFromPeers declines payment requests of other peers than the given
+// ones.
+func RequestsFromPeers(peers ...wire.Address) RequestPolicy {
+	return RequestPolicyFunc(func(_ context.Context, r *PaymentRequest) error {
+		if !containsAddress(peers, r.Peer) {
+			return Reject(ReasonPeerNotAllowed, "peer not allowed")
+		}
+		return nil
+	})
+}
+
+// ApproveUpTo pays requests of up to max automatically and passes larger
+// requests to otherwise, e.g. AskUserRequests. Larger requests are declined
+// if otherwise is nil.
+func ApproveUpTo(max Amount, otherwise RequestPolicy) RequestPolicy {
+	return RequestPolicyFunc(func(ctx context.Context, r *PaymentRequest) error {
+		switch {
+		case r.Amount <= max:
+			return nil
+		case otherwise == nil:
+			return Reject(ReasonPaymentLimit, "request of %v above maximum %v", r.Amount, max)
+		}
+		return otherwise.CheckRequest(ctx, r)
+	})
+}
+
+// AskUserRequests queues payment requests as pending until the user decides
+// on them via PaymentClient.DecideRequest. Undecided requests are declined
+// after timeout, or when the request handling times out if timeout is zero.
+//
+// The demo's terminal UI cannot show or answer pending requests, so
+// AskUserRequests is only useful in daemon mode, where requests are listed
+// and decided through the HTTP API or the perun-cardano CLI.
+func AskUserRequests(timeout time.Duration) RequestPolicy {
+	return RequestPolicyFunc(func(ctx context.Context, r *PaymentRequest) error {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return r.prompts.ask(ctx, r)
+	})
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/perun-cardano-demo/client"
+)
+
+func TestRequestPolicies(t *testing.T) {
+	ctx := context.Background()
+	alice, err := client.WireAddressFromPubKey(pubKeyAlice)
+	require.NoError(t, err)
+	bob, err := client.WireAddressFromPubKey(pubKeyBob)
+	require.NoError(t, err)
+	request := func() *client.PaymentRequest {
+		return &client.PaymentRequest{Peer: alice, Amount: 2 * client.Ada, Invoice: "inv"}
+	}
+
+	tests := []struct {
+		name   string
+		policy client.RequestPolicy
+		reason client.RejectReason // reason is empty if the request is paid.
+	}{
+		{"decline all", client.DeclineRequests, client.ReasonRequestDeclined},
+		{"approve all", client.ApproveRequests, ""},
+		{"allowed peer", client.RequestsFromPeers(alice), ""},
+		{"peer not allowed", client.RequestsFromPeers(bob), client.ReasonPeerNotAllowed},
+		{"up to limit", client.ApproveUpTo(2*client.Ada, nil), ""},
+		{"above limit", client.ApproveUpTo(client.Ada, nil), client.ReasonPaymentLimit},
+		{"above limit otherwise", client.ApproveUpTo(client.Ada, client.DeclineRequests), client.ReasonRequestDeclined},
+		{"all approve", client.AllRequests(client.RequestsFromPeers(alice), client.ApproveUpTo(2*client.Ada, nil)), ""},
+		{"first decline wins", client.AllRequests(client.RequestsFromPeers(bob), client.DeclineRequests), client.ReasonPeerNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.CheckRequest(ctx, request())
+			if tt.reason == "" {
+				require.NoError(t, err)
+				return
+			}
+			var rej *client.RejectionError
+			require.True(t, errors.As(err, &rej), "expected RejectionError, got %v", err)
+			require.Equal(t, tt.reason, rej.Reason)
+		})
+	}
+}
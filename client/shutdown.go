@@ -0,0 +1,265 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"perun.network/go-perun/channel"
+)
+
+// ShutdownPolicy decides what happens to the open channels of a client that
+// shuts down gracefully.
+type ShutdownPolicy string
+
+// Shutdown policies.
+const (
+	// SettleChannels settles all open channels before shutting down.
+	SettleChannels ShutdownPolicy = "settle"
+	// LeaveChannelsOpen leaves the channels open. With persistence, they are
+	// restored on the next start; otherwise only the peer can close them.
+	LeaveChannelsOpen ShutdownPolicy = "leave_open"
+)
+
+// routineTimeout bounds how long Shutdown waits for the goroutines of the
+// client to return.
+const routineTimeout = 10 * time.Second
+
+// ShutdownSummary reports what happened during a graceful shutdown.
+type ShutdownSummary struct {
+	Client string
+	Policy ShutdownPolicy
+	// Drained is set if all in-flight operations finished in time.
+	Drained bool
+	// Settled are the channels settled during the shutdown.
+	Settled []channel.ID
+	// LeftOpen are the channels that are still open, including those that
+	// failed to settle.
+	LeftOpen []channel.ID
+	// Persisted is set if the open channels are restored on the next start.
+	Persisted bool
+	// Errors are the errors of the channels that failed to settle.
+	Errors   []error
+	Duration time.Duration
+}
+
+// String returns a human-readable description of the summary.
+func (s *ShutdownSummary) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s shut down in %v (policy %s): %d channel(s) settled, %d left open",
+		s.Client, s.Duration.Round(time.Millisecond), s.Policy, len(s.Settled), len(s.LeftOpen))
+	if len(s.LeftOpen) > 0 {
+		if s.Persisted {
+			b.WriteString(" and persisted")
+		} else {
+			b.WriteString(" without persistence")
+		}
+	}
+	if !s.Drained {
+		b.WriteString(", in-flight operations were canceled")
+	}
+	for _, id := range s.LeftOpen {
+		fmt.Fprintf(&b, "\n  open: %s", hex.EncodeToString(id[:]))
+	}
+	for _, err := range s.Errors {
+		fmt.Fprintf(&b, "\n  error: %v", err)
+	}
+	return b.String()
+}
+
+// GracefulShutdown shuts down the client in order. It stops accepting new
+// payments, channels and incoming updates, waits for the operations in
+// flight, applies the policy to the open channels and shuts down the client.
+// If ctx is done before the operations finished, they are canceled. The
+// summary is logged and returned.
+func (c *PaymentClient) GracefulShutdown(ctx context.Context, policy ShutdownPolicy) *ShutdownSummary {
+	start := time.Now()
+	s := &ShutdownSummary{Client: c.Name, Policy: policy}
+	s.Drained = c.ops.drain(ctx) == nil
+
+	if policy == SettleChannels && ctx.Err() == nil {
+		for _, ch := range c.channels.list() {
+			if err := c.settleOnShutdown(ctx, ch); err != nil {
+				s.Errors = append(s.Errors, err)
+				continue
+			}
+			s.Settled = append(s.Settled, ch.ID())
+		}
+	}
+	for _, ch := range c.channels.list() {
+		s.LeftOpen = append(s.LeftOpen, ch.ID())
+	}
+	s.Persisted = c.persister != nil
+
+	c.Shutdown()
+	s.Duration = time.Since(start)
+	c.log.WithFields(logrus.Fields{
+		"policy":  s.Policy,
+		"settled": len(s.Settled),
+		"open":    len(s.LeftOpen),
+		"errors":  len(s.Errors),
+	}).Info(s)
+	return s
+}
+
+// settleOnShutdown settles ch. If the channel is being settled already, e.g.
+// because the peer concluded it, it waits until the channel is closed.
+func (c *PaymentClient) settleOnShutdown(ctx context.Context, ch *PaymentChannel) error {
+	err := c.settleChannel(ctx, ch.ID())
+	if !errors.Is(err, ErrSettling) {
+		return err
+	}
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+	for {
+		if _, ok := c.channels.get(ch.ID()); !ok {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return &OpError{Op: "settle channel", Kind: ErrSettling, Err: ctx.Err()}
+		}
+	}
+}
+
+// Shutdown shuts down the client immediately. In-flight operations are
+// canceled and open channels are left open. Use GracefulShutdown to wait for
+// in-flight operations and settle the channels. Calling Shutdown more than
+// once has no effect.
+func (c *PaymentClient) Shutdown() {
+	if !atomic.CompareAndSwapInt32(&c.stopped, 0, 1) {
+		return
+	}
+	c.ops.close()
+	c.balances.Unwatch(c)
+	c.cancel()
+	if err := c.PerunClient.Close(); err != nil {
+		c.log.WithError(err).Error("Closing Perun client failed")
+	}
+	if !c.ops.wait(routineTimeout) {
+		c.log.Warnf("Goroutines did not return within %v", routineTimeout)
+	}
+	if c.persister != nil {
+		if err := c.persister.Close(); err != nil {
+			c.log.WithError(err).Error("Closing channel database failed")
+		}
+	}
+	if err := c.ledger.Close(); err != nil {
+		c.log.WithError(err).Error("Closing payment ledger failed")
+	}
+
+	c.observerMutex.Lock()
+	defer c.observerMutex.Unlock()
+	c.observers = nil
+}
+
+// operations tracks the operations and goroutines of a client, so that a
+// shutdown can wait for them. Once closed, no new operations start. The zero
+// value is ready to use.
+type operations struct {
+	mutex    sync.Mutex
+	inFlight int
+	closed   bool
+	idle     chan struct{} // idle is closed when the last operation ends after close.
+
+	routines sync.WaitGroup
+}
+
+// begin starts an operation. It returns false if the client shuts down, in
+// which case the operation must not start. Otherwise, end must be called
+// once the operation finished.
+func (o *operations) begin() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.closed {
+		return false
+	}
+	o.inFlight++
+	return true
+}
+
+// end ends an operation started with begin.
+func (o *operations) end() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.inFlight--
+	if o.inFlight == 0 && o.idle != nil {
+		close(o.idle)
+		o.idle = nil
+	}
+}
+
+// close prevents new operations from starting.
+func (o *operations) close() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.closed = true
+}
+
+// drain closes o and waits until all operations ended or ctx is done.
+func (o *operations) drain(ctx context.Context) error {
+	o.mutex.Lock()
+	o.closed = true
+	if o.inFlight == 0 {
+		o.mutex.Unlock()
+		return nil
+	}
+	if o.idle == nil {
+		o.idle = make(chan struct{})
+	}
+	idle := o.idle
+	o.mutex.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// goroutine runs f in a tracked goroutine.
+func (o *operations) goroutine(f func()) {
+	o.routines.Add(1)
+	go func() {
+		defer o.routines.Done()
+		f()
+	}()
+}
+
+// wait waits for the tracked goroutines to return. It returns false if they
+// did not return within the timeout.
+func (o *operations) wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		o.routines.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/channel"
+	chtest "perun.network/go-perun/channel/test"
+	"perun.network/go-perun/client"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestOperations(t *testing.T) {
+	var ops operations
+	require.True(t, ops.begin())
+	require.True(t, ops.begin())
+
+	drained := make(chan error, 1)
+	go func() { drained <- ops.drain(context.Background()) }()
+	require.Eventually(t, func() bool { return !ops.begin() }, time.Second, time.Millisecond,
+		"no operation starts once draining")
+
+	ops.end()
+	select {
+	case <-drained:
+		t.Fatal("drained with an operation in flight")
+	case <-time.After(10 * time.Millisecond):
+	}
+	ops.end()
+	require.NoError(t, <-drained)
+	require.NoError(t, ops.drain(context.Background()), "draining an idle client returns immediately")
+
+	ops = operations{}
+	require.True(t, ops.begin())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, ops.drain(ctx), context.DeadlineExceeded)
+
+	ran := make(chan struct{})
+	ops.goroutine(func() { <-ran })
+	require.False(t, ops.wait(10*time.Millisecond))
+	close(ran)
+	require.True(t, ops.wait(time.Second))
+}
+
+func TestSettleChannelWhileDraining(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	c, _ := newTestClient(chtest.NewRandomAsset(rng))
+	require.True(t, c.ops.begin())
+	drained := make(chan error, 1)
+	go func() { drained <- c.ops.drain(context.Background()) }()
+
+	// Users cannot settle channels once the client drains, only the shutdown
+	// itself can.
+	require.Eventually(t, func() bool {
+		return errors.Is(c.SettleChannel(context.Background(), channel.ID{1}), ErrShuttingDown)
+	}, time.Second, time.Millisecond)
+	require.ErrorIs(t, c.settleChannel(context.Background(), channel.ID{1}), ErrNoChannel)
+	c.ops.end()
+	require.NoError(t, <-drained)
+}
+
+func TestHandleUpdateShuttingDown(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	asset := chtest.NewRandomAsset(rng)
+	cur := &channel.State{
+		ID:         channel.ID{1},
+		Version:    1,
+		App:        channel.NoApp(),
+		Allocation: *channel.NewAllocation(2, asset),
+		Data:       channel.NoData(),
+	}
+	cur.Allocation.SetAssetBalances(asset, []channel.Bal{big.NewInt(100), big.NewInt(100)})
+	next := cur.Clone()
+	next.Version++
+	next.Allocation.TransferBalance(0, 1, asset, big.NewInt(10))
+
+	c, o := newTestClient(asset)
+	require.NoError(t, c.ops.drain(context.Background()))
+	r := &fakeUpdateResponder{}
+	c.handleUpdate(cur, client.ChannelUpdate{State: next, ActorIdx: 0}, r)
+	require.Zero(t, r.accepted)
+	require.Len(t, r.rejected, 1)
+	require.Equal(t, ReasonShuttingDown, ParseRejection(r.rejected[0]).Reason)
+	require.Len(t, o.rejections, 1)
+
+	err := c.SendPayment(context.Background(), cur.ID, Ada)
+	require.ErrorIs(t, err, ErrShuttingDown)
+}
+
+func TestHandleProposalShuttingDown(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	asset := chtest.NewRandomAsset(rng)
+	prop := newTestProposal(t, rng, asset, 10, 10)
+
+	c, o := newTestClient(asset)
+	require.NoError(t, c.ops.drain(context.Background()))
+	r := &fakeProposalResponder{}
+	c.handleProposal(prop, r)
+	require.Zero(t, r.accepted)
+	require.Len(t, r.rejected, 1)
+	require.Equal(t, ReasonShuttingDown, ParseRejection(r.rejected[0]).Reason)
+	require.Len(t, o.rejections, 1)
+	require.Equal(t, RejectedProposal, o.rejections[0].Item)
+	require.Equal(t, prop.Peers[0], o.rejections[0].Peer)
+}
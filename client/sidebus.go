@@ -0,0 +1,115 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sync"
+
+	"perun.network/go-perun/wire"
+	"perun.network/go-perun/wire/perunio"
+)
+
+// firstSideMsgType is the first type of the side messages that clients
+// exchange in addition to the Perun wire protocol. It is well above the types
+// used by go-perun.
+const firstSideMsgType wire.Type = 200
+
+// Types of the side messages.
+const (
+	paymentInfoMsgType = firstSideMsgType + iota
+	paymentRequestMsgType
+	paymentDeclinedMsgType
+)
+
+// sideMsg is a message that the client handles itself instead of passing it
+// to go-perun. Its type must not be below firstSideMsgType.
+type sideMsg interface {
+	wire.Msg
+	perunio.Encoder
+}
+
+// sideBus wraps the wire bus of a client. It hands side messages addressed
+// to the client to a handler and all other messages to go-perun.
+type sideBus struct {
+	wire.Bus
+
+	mutex   sync.Mutex
+	handler func(*wire.Envelope)
+}
+
+func newSideBus(bus wire.Bus) *sideBus {
+	return &sideBus{Bus: bus}
+}
+
+// SubscribeClient subscribes c to the messages for addr, except for side
+// messages.
+func (b *sideBus) SubscribeClient(c wire.Consumer, addr wire.Address) error {
+	return b.Bus.SubscribeClient(&sideConsumer{Consumer: c, bus: b}, addr)
+}
+
+// setHandler sets the handler of side messages. Side messages that arrive
+// before the handler is set are dropped.
+func (b *sideBus) setHandler(h func(*wire.Envelope)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.handler = h
+}
+
+func (b *sideBus) handle(e *wire.Envelope) {
+	b.mutex.Lock()
+	h := b.handler
+	b.mutex.Unlock()
+	if h != nil {
+		h(e)
+	}
+}
+
+// sideConsumer diverts side messages from the consumer of go-perun. Side
+// messages are handled synchronously, so that they are handled before any
+// message the peer sent after them.
+type sideConsumer struct {
+	wire.Consumer
+	bus *sideBus
+}
+
+// Put implements wire.Consumer.
+func (c *sideConsumer) Put(e *wire.Envelope) {
+	if e.Msg.Type() >= firstSideMsgType {
+		c.bus.handle(e)
+		return
+	}
+	c.Consumer.Put(e)
+}
+
+// publish sends a side message to the given peer.
+func (c *PaymentClient) publish(ctx context.Context, peer wire.Address, msg sideMsg) error {
+	return c.bus.Publish(ctx, &wire.Envelope{Sender: c.wAddr, Recipient: peer, Msg: msg})
+}
+
+// handleSideMsg handles a side message from a peer. It must not block.
+func (c *PaymentClient) handleSideMsg(e *wire.Envelope) {
+	switch msg := e.Msg.(type) {
+	case *paymentInfoMsg:
+		c.invoices.addInfo(msg)
+	case *paymentRequestMsg:
+		sender := e.Sender
+		c.ops.goroutine(func() { c.handlePaymentRequest(sender, msg) })
+	case *paymentDeclinedMsg:
+		c.declined(msg)
+	default:
+		c.log.WithField(LogFieldPeer, formatPeer(e.Sender)).Warnf("Ignoring side message of type %v", e.Msg.Type())
+	}
+}
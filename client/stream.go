@@ -0,0 +1,336 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"perun.network/go-perun/channel"
+)
+
+// StreamState is the state of a payment stream.
+type StreamState string
+
+// States of a payment stream. All states but StreamRunning are final.
+const (
+	StreamRunning    StreamState = "running"
+	StreamStopped    StreamState = "stopped"     // StreamStopped streams were stopped by StopStream, a settlement or a shutdown.
+	StreamCapReached StreamState = "cap_reached" // StreamCapReached streams paid their cap.
+	StreamRejected   StreamState = "rejected"    // StreamRejected streams ended because the peer rejected a payment.
+	StreamFailed     StreamState = "failed"      // StreamFailed streams ended because a payment failed otherwise.
+)
+
+// StreamStatus describes the progress of a payment stream.
+type StreamStatus struct {
+	ChannelID channel.ID
+	Rate      Amount        // Rate is paid per interval.
+	Interval  time.Duration // Interval between two payments, unless the peer is slow.
+	Cap       Amount        // Cap is the total amount of the stream, unlimited if zero.
+	State     StreamState
+	Paid      Amount // Paid is the total amount paid.
+	Payments  int    // Payments is the number of channel updates, which may pay several intervals each.
+	Started   time.Time
+	Time      time.Time // Time is the time of the status.
+	Err       error     // Err is the error that ended a rejected or failed stream.
+}
+
+// Throughput returns the average amount paid per second since the start of
+// the stream, rounded down to whole Lovelace.
+func (s StreamStatus) Throughput() Amount {
+	elapsed := s.Time.Sub(s.Started)
+	if elapsed <= 0 {
+		return 0
+	}
+	if perSecond, err := s.Paid.Mul(int64(time.Second)); err == nil {
+		return perSecond / Amount(elapsed)
+	}
+	// Paid is too large to be scaled to nanoseconds in an int64.
+	q := new(big.Int).Mul(s.Paid.Bal(), big.NewInt(int64(time.Second)))
+	a, err := AmountFromBal(q.Quo(q, big.NewInt(int64(elapsed))))
+	if err != nil {
+		return math.MaxInt64
+	}
+	return a
+}
+
+// paymentStream pays rate per interval in a channel. At most one payment is
+// in flight. The intervals that elapse meanwhile are paid in one batch once
+// it completes.
+type paymentStream struct {
+	ch     *PaymentChannel
+	clock  Clock
+	ticker Ticker
+	stop   chan struct{} // stop is closed by StopStream.
+	done   chan struct{} // done is closed once the stream ended.
+	log    logrus.FieldLogger
+
+	mutex    sync.Mutex
+	status   StreamStatus
+	inFlight Amount // inFlight is the amount of the payment in flight.
+	stopOnce sync.Once
+}
+
+// StartStream starts paying rate per interval to the channel peer until cap
+// is paid, StopStream is called or a payment fails. A zero cap does not
+// limit the stream, but then rate must be small enough for the total not to
+// overflow. Each interval is paid with a channel update. If the peer
+// answers slower than the interval, the elapsed intervals are batched into
+// one update. The progress is reported to StreamObservers. Only one stream
+// can run per channel.
+func (c *PaymentChannel) StartStream(rate Amount, interval time.Duration, cap Amount) error {
+	switch {
+	case rate <= 0:
+		return &OpError{Op: "start stream", Kind: ErrInvalidAmount, Err: fmt.Errorf("rate %v", rate)}
+	case cap < 0:
+		return &OpError{Op: "start stream", Kind: ErrInvalidAmount, Err: fmt.Errorf("cap %v", cap)}
+	case interval <= 0:
+		return &OpError{Op: "start stream", Kind: ErrInvalidParams, Err: fmt.Errorf("interval %v", interval)}
+	}
+	// The elapsed time saturates at the maximum duration, which bounds the
+	// number of intervals an uncapped stream owes.
+	if _, err := rate.Mul(int64(math.MaxInt64 / interval)); cap == 0 && err != nil {
+		return &OpError{Op: "start stream", Kind: ErrInvalidAmount, Err: fmt.Errorf("uncapped stream of %v per %v overflows", rate, interval)}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.stream != nil && c.stream.running() {
+		return &OpError{Op: "start stream", Kind: ErrStreamRunning, Err: ErrStreamRunning}
+	}
+	clk := c.owner.clock
+	now := clk.Now()
+	s := &paymentStream{
+		ch:     c,
+		clock:  clk,
+		ticker: clk.NewTicker(interval),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		log:    c.log,
+		status: StreamStatus{
+			ChannelID: c.ID(),
+			Rate:      rate,
+			Interval:  interval,
+			Cap:       cap,
+			State:     StreamRunning,
+			Started:   now,
+			Time:      now,
+		},
+	}
+	c.stream = s
+	c.owner.ops.goroutine(func() { s.run(c.owner.ctx) })
+	s.log.WithFields(logrus.Fields{"rate": rate, "interval": interval, "cap": cap}).Info("Started payment stream")
+	return nil
+}
+
+// StartStream starts a payment stream in the channel with the given ID, see
+// PaymentChannel.StartStream. It fails with ErrShuttingDown once the client
+// shuts down. Errors are also reported to the observers.
+func (c *PaymentClient) StartStream(id channel.ID, rate Amount, interval time.Duration, cap Amount) error {
+	if !c.ops.begin() {
+		return c.notifyError(&OpError{Op: "start stream", Kind: ErrShuttingDown, Err: ErrShuttingDown})
+	}
+	defer c.ops.end()
+	ch, err := c.Channel(id)
+	if err != nil {
+		return c.notifyError(err)
+	}
+	return c.notifyError(ch.StartStream(rate, interval, cap))
+}
+
+// StopStream stops the payment stream of the channel and returns its final
+// status. It waits for the payment in flight, if any. The time elapsed since
+// the last completed interval is not paid. If the stream already ended, its
+// final status is returned.
+func (c *PaymentChannel) StopStream() (StreamStatus, error) {
+	c.mutex.Lock()
+	s := c.stream
+	c.mutex.Unlock()
+	if s == nil {
+		return StreamStatus{}, &OpError{Op: "stop stream", Kind: ErrNoStream, Err: ErrNoStream}
+	}
+	s.stopOnce.Do(func() { close(s.stop) })
+	<-s.done
+	return s.snapshot(), nil
+}
+
+// Stream returns the status of the current or last payment stream of the
+// channel, or false if no stream was started.
+func (c *PaymentChannel) Stream() (StreamStatus, bool) {
+	c.mutex.Lock()
+	s := c.stream
+	c.mutex.Unlock()
+	if s == nil {
+		return StreamStatus{}, false
+	}
+	return s.snapshot(), true
+}
+
+func (s *paymentStream) snapshot() StreamStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.status
+}
+
+func (s *paymentStream) running() bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// run pays the elapsed intervals on every tick until the stream ends. Once
+// stopped, it waits for the payment in flight.
+func (s *paymentStream) run(ctx context.Context) {
+	defer close(s.done)
+	defer s.ticker.Stop()
+	results := make(chan error, 1)
+	sending := false
+	stop, canceled := s.stop, ctx.Done()
+	for {
+		select {
+		case <-s.ticker.Chan():
+			// Ticks may be late, so the amount due is based on the current
+			// time.
+			if !sending {
+				sending = s.send(ctx, results)
+			}
+		case err := <-results:
+			sending = false
+			if state := s.paid(err); state != StreamRunning {
+				s.end(state, err)
+				return
+			}
+			if stop == nil {
+				s.end(StreamStopped, nil)
+				return
+			}
+			// Pay the intervals that elapsed during the payment in one batch.
+			sending = s.send(ctx, results)
+		case <-stop:
+			stop, canceled = nil, nil
+		case <-canceled:
+			// The client shuts down, which cancels the payment in flight.
+			stop, canceled = nil, nil
+		}
+		if stop == nil && !sending {
+			s.end(StreamStopped, nil)
+			return
+		}
+	}
+}
+
+// send starts a payment of the amount due for the elapsed intervals. It
+// returns false if nothing is due. If the amount owed by an uncapped stream
+// overflows, the stream fails.
+func (s *paymentStream) send(ctx context.Context, results chan<- error) bool {
+	now := s.clock.Now()
+	s.mutex.Lock()
+	st := s.status
+	periods := int64(now.Sub(st.Started) / st.Interval)
+	owed, err := st.Rate.Mul(periods)
+	switch {
+	case err != nil && st.Cap == 0:
+		// Nothing is in flight, so the result does not block.
+		s.mutex.Unlock()
+		results <- &OpError{Op: "stream payment", Kind: ErrInvalidAmount, Err: err}
+		return true
+	case err != nil || (st.Cap > 0 && owed > st.Cap):
+		owed = st.Cap
+	}
+	due := owed - st.Paid
+	if due <= 0 {
+		s.mutex.Unlock()
+		return false
+	}
+	s.inFlight = due
+	s.mutex.Unlock()
+
+	id := st.ChannelID
+	s.ch.owner.ops.goroutine(func() {
+		results <- s.ch.owner.SendPayment(ctx, id, due)
+	})
+	return true
+}
+
+// paid records the result of the payment in flight and returns the state of
+// the stream.
+func (s *paymentStream) paid(err error) StreamState {
+	s.mutex.Lock()
+	amount := s.inFlight
+	s.inFlight = 0
+	s.status.Time = s.clock.Now()
+	if err != nil {
+		s.mutex.Unlock()
+		if errors.Is(err, ErrPeerRejected) {
+			return StreamRejected
+		}
+		return StreamFailed
+	}
+	s.status.Paid += amount
+	s.status.Payments++
+	status := s.status
+	s.mutex.Unlock()
+
+	s.log.WithFields(logrus.Fields{"amount": amount, "paid": status.Paid}).Debug("Stream payment sent")
+	if status.Cap > 0 && status.Paid >= status.Cap {
+		return StreamCapReached
+	}
+	s.ch.owner.NotifyAllStream(status)
+	return StreamRunning
+}
+
+// end sets the final state of the stream and reports it.
+func (s *paymentStream) end(state StreamState, err error) {
+	s.mutex.Lock()
+	s.status.State = state
+	s.status.Err = err
+	s.status.Time = s.clock.Now()
+	status := s.status
+	s.mutex.Unlock()
+
+	log := s.log.WithFields(logrus.Fields{"paid": status.Paid, "payments": status.Payments, "state": state})
+	if err != nil {
+		log.WithError(err).Warn("Payment stream ended")
+	} else {
+		log.Info("Payment stream ended")
+	}
+	s.ch.owner.NotifyAllStream(status)
+}
+
+// NotifyAllStream notifies the observers about the progress of a payment
+// stream.
+func (c *PaymentClient) NotifyAllStream(s StreamStatus) {
+	c.observerMutex.Lock()
+	defer c.observerMutex.Unlock()
+	str := fmt.Sprintf("[green]Stream %s: paid %v in %d payment(s), %v/s[white]", s.State, s.Paid, s.Payments, s.Throughput())
+	if c.lastState != "" {
+		str = c.lastState + "\n\n" + str
+	}
+	for _, o := range c.observers {
+		o.UpdateState(str)
+		if o, ok := o.(StreamObserver); ok {
+			o.UpdateStream(s)
+		}
+	}
+}
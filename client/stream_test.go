@@ -0,0 +1,46 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/perun-cardano-demo/client"
+)
+
+func TestStreamThroughput(t *testing.T) {
+	start := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name    string
+		paid    client.Amount
+		elapsed time.Duration
+		want    client.Amount
+	}{
+		{"not started", client.Ada, 0, 0},
+		{"whole", 3 * client.Ada, 3 * time.Second, client.Ada},
+		{"rounded down", client.Ada, 13 * time.Second, 76923},
+		{"sub-second", client.Lovelace, time.Millisecond, 1000},
+		{"large", client.Amount(math.MaxInt64 / 2), 2 * time.Second, client.Amount(math.MaxInt64 / 4)},
+		{"saturated", client.Amount(math.MaxInt64), time.Nanosecond, client.Amount(math.MaxInt64)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := client.StreamStatus{Paid: tc.paid, Started: start, Time: start.Add(tc.elapsed)}
+			require.Equal(t, tc.want, s.Throughput())
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"sync"
+	"time"
+
+	"perun.network/go-perun/channel"
+)
+
+// drainInterval is the interval at which a subscription polls the backend
+// for pending errors.
+const drainInterval = 10 * time.Millisecond
+
+// eventSub decouples an adjudicator subscription of the backend from its
+// consumer. The backend subscription reports read errors on an unbuffered
+// channel before it stops delivering events, so the go-perun watcher, which
+// only asks for the error after the last event, blocks forever when the
+// subscription is closed. eventSub consumes the errors continuously instead
+// and returns from Next as soon as it is closed.
+type eventSub struct {
+	sub    channel.AdjudicatorSubscription
+	events chan channel.AdjudicatorEvent
+	done   chan struct{} // closed by Close.
+	once   sync.Once
+
+	mutex sync.Mutex
+	err   error
+}
+
+func newEventSub(sub channel.AdjudicatorSubscription) *eventSub {
+	s := &eventSub{
+		sub:    sub,
+		events: make(chan channel.AdjudicatorEvent),
+		done:   make(chan struct{}),
+	}
+	go s.drain(s.pump())
+	return s
+}
+
+// pump forwards the events of the backend subscription until it ends. The
+// returned channel is closed when it does.
+func (s *eventSub) pump() <-chan struct{} {
+	ended := make(chan struct{})
+	go func() {
+		defer close(ended)
+		defer close(s.events)
+		for e := s.sub.Next(); e != nil; e = s.sub.Next() {
+			select {
+			case s.events <- e:
+			case <-s.done: // Drop events until the backend notices the close.
+			}
+		}
+	}()
+	return ended
+}
+
+// drain collects the errors of the backend subscription until it ends.
+func (s *eventSub) drain(ended <-chan struct{}) {
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ended:
+			s.setErr(s.sub.Err())
+			return
+		case <-ticker.C:
+			s.setErr(s.sub.Err())
+		}
+	}
+}
+
+func (s *eventSub) setErr(err error) {
+	if err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// Next returns the next event or nil if the subscription ended.
+func (s *eventSub) Next() channel.AdjudicatorEvent {
+	select {
+	case e, ok := <-s.events:
+		if !ok {
+			return nil
+		}
+		return e
+	case <-s.done:
+		return nil
+	}
+}
+
+// Err returns the error that ended the subscription. Errors caused by
+// closing the subscription are not reported.
+func (s *eventSub) Err() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err
+}
+
+// Close closes the subscription.
+func (s *eventSub) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		err = s.sub.Close()
+	})
+	return err
+}
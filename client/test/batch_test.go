@@ -0,0 +1,113 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/wire"
+	"perun.network/perun-cardano-demo/client"
+	"perun.network/perun-cardano-demo/client/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestBatch(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	alice := s.NewClient(t, test.Alice, bus)
+	bob := s.NewClient(t, test.Bob, bus)
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+
+	ch, err := alice.OpenChannel(ctx, test.Bob.WireAddress(t), 10*client.Ada)
+	require.NoError(t, err)
+	id := ch.ID()
+
+	// Several transfers are made in one update and recorded one by one.
+	require.NoError(t, alice.SendBatch(ctx, id, client.Batch{Transfers: []client.Transfer{
+		{Amount: client.Ada},
+		{Amount: 2 * client.Ada, Memo: "tea"},
+		{Amount: client.Ada / 2, Memo: "cake"},
+	}}))
+	state := ch.State()
+	require.EqualValues(t, 1, state.Version)
+	requireBalances(t, state, 65*ada/10, 135*ada/10)
+	sent := ch.Payments()
+	require.Len(t, sent, 3)
+	for i, amount := range []client.Amount{client.Ada, 2 * client.Ada, client.Ada / 2} {
+		require.Equal(t, amount, sent[i].Amount)
+		require.EqualValues(t, 1, sent[i].Version)
+	}
+	require.Equal(t, "tea", sent[1].Memo)
+	var received []client.Payment
+	require.Eventually(t, func() bool {
+		received = bob.Payments(client.PaymentFilter{ChannelID: id})
+		return len(received) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 35*client.Ada/10, received[0].Amount)
+	require.Equal(t, "tea; cake", received[0].Memo)
+
+	// Of two workers paying based on the same state, only one succeeds.
+	expect, err := ch.ExpectState(ch.State())
+	require.NoError(t, err)
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- alice.SendBatch(ctx, id, client.Batch{Transfers: []client.Transfer{{Amount: client.Ada}}, Expect: expect})
+		}()
+	}
+	err1, err2 := <-errs, <-errs
+	if err1 != nil {
+		err1, err2 = err2, err1
+	}
+	require.NoError(t, err1)
+	require.ErrorIs(t, err2, client.ErrConflict)
+	state = ch.State()
+	require.EqualValues(t, 2, state.Version)
+	requireBalances(t, state, 55*ada/10, 145*ada/10)
+
+	// Expected balances are checked, too.
+	expect, err = ch.ExpectState(state)
+	require.NoError(t, err)
+	expect.PeerBalance++
+	err = alice.SendBatch(ctx, id, client.Batch{Transfers: []client.Transfer{{Amount: client.Ada}}, Expect: expect})
+	require.ErrorIs(t, err, client.ErrConflict)
+	require.ErrorIs(t, alice.SendBatch(ctx, id, client.Batch{}), client.ErrInvalidAmount)
+	err = alice.SendBatch(ctx, id, client.Batch{Transfers: []client.Transfer{{Amount: client.Ada}, {Amount: -1}}})
+	require.ErrorIs(t, err, client.ErrInvalidAmount)
+	err = alice.SendBatch(ctx, id, client.Batch{Transfers: []client.Transfer{{Amount: 5 * client.Ada}, {Amount: client.Ada}}})
+	require.ErrorIs(t, err, client.ErrInsufficientBalance)
+	require.EqualValues(t, 2, ch.State().Version)
+
+	// A transfer and the finalization are made in one update.
+	expect, err = ch.ExpectState(ch.State())
+	require.NoError(t, err)
+	err = alice.SendBatch(ctx, id, client.Batch{
+		Transfers: []client.Transfer{{Amount: client.Ada, Memo: "final"}},
+		Finalize:  true,
+		Expect:    expect,
+	})
+	require.NoError(t, err)
+	state = ch.State()
+	require.EqualValues(t, 3, state.Version)
+	require.True(t, state.IsFinal)
+	requireBalances(t, state, 45*ada/10, 155*ada/10)
+	require.NoError(t, alice.SettleChannel(ctx, id))
+}
@@ -0,0 +1,166 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wire"
+	"perun.network/perun-cardano-backend/channel/types"
+	"perun.network/perun-cardano-demo/client"
+	"perun.network/perun-cardano-demo/client/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+// challengeDuration is the challenge duration of force-closed channels in
+// seconds.
+const challengeDuration = 1
+
+func TestForceClose(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	alice := s.NewClient(t, test.Alice, bus)
+	bob := s.NewClient(t, test.Bob, bus)
+	o := &forceCloseRecorder{Observer: test.NewObserver()}
+	alice.Register(o)
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+
+	ch, err := alice.OpenChannel(ctx, test.Bob.WireAddress(t), 10*client.Ada, client.WithChallengeDuration(challengeDuration))
+	require.NoError(t, err)
+	id := ch.ID()
+	require.NoError(t, alice.SendPayment(ctx, id, 2*client.Ada))
+
+	// Alice closes the channel on the non-final state of the payment. Bob
+	// sees the conclusion on-chain and withdraws automatically.
+	start := time.Now()
+	require.NoError(t, alice.ForceClose(ctx, id))
+	require.GreaterOrEqual(t, time.Since(start), challengeDuration*time.Second)
+	require.Empty(t, alice.Channels())
+	require.Eventually(t, func() bool {
+		return len(bob.Channels()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{types.CreatedTag, types.DepositedTag, types.DisputedTag, types.ConcludedTag}, s.PAB.Events(id))
+	require.EqualValues(t, test.DefaultBalance-2*ada, s.Wallet.Balance(test.Alice.WalletID))
+	require.EqualValues(t, test.DefaultBalance+2*ada, s.Wallet.Balance(test.Bob.WalletID))
+
+	stages := o.stages()
+	require.Equal(t, []client.ForceCloseStage{
+		client.ForceCloseRegistering, client.ForceCloseWaiting, client.ForceCloseWithdrawing, client.ForceCloseDone,
+	}, stages)
+	require.False(t, o.progress[1].Timeout.IsZero())
+
+	bobEvents := bob.ChannelEvents(id)
+	require.Len(t, bobEvents, 2)
+	require.Equal(t, client.EventRegistered, bobEvents[0].Kind)
+	require.EqualValues(t, 1, bobEvents[0].Version)
+	require.False(t, bobEvents[0].Stale())
+	require.Equal(t, client.EventConcluded, bobEvents[1].Kind)
+
+	// Force-closing a closed channel fails.
+	require.ErrorIs(t, alice.ForceClose(ctx, id), client.ErrNoChannel)
+}
+
+func TestForceCloseResume(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	db := filepath.Join(t.TempDir(), "alice")
+	persistence := func() client.Option {
+		pr, err := client.NewLevelDBPersistRestorer(db)
+		require.NoError(t, err)
+		return client.WithPersistence(pr)
+	}
+	alice := s.NewClient(t, test.Alice, bus, persistence())
+	bob := s.NewClient(t, test.Bob, bus)
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+
+	var ids []channel.ID
+	for i := 0; i < 2; i++ {
+		ch, err := alice.OpenChannel(ctx, test.Bob.WireAddress(t), 10*client.Ada, client.WithChallengeDuration(challengeDuration))
+		require.NoError(t, err)
+		ids = append(ids, ch.ID())
+		require.NoError(t, alice.SendPayment(ctx, ch.ID(), 2*client.Ada))
+	}
+
+	// Alice force-closes both channels and stops during their challenge
+	// periods.
+	closeCtx, stop := context.WithCancel(ctx)
+	closed := make(chan error, len(ids))
+	for _, id := range ids {
+		id := id
+		go func() { closed <- alice.ForceClose(closeCtx, id) }()
+	}
+	require.Eventually(t, func() bool {
+		for _, id := range ids {
+			if len(s.PAB.Events(id)) != 3 { // Created, Deposited, Disputed.
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	stop()
+	require.Error(t, <-closed)
+	require.Error(t, <-closed)
+	alice.Shutdown()
+	for _, id := range ids {
+		require.False(t, s.PAB.Concluded(id))
+	}
+
+	// After the restart, Alice finishes closing both channels.
+	alice = s.NewClient(t, test.Alice, bus, persistence())
+	require.Eventually(t, func() bool {
+		return len(alice.Channels()) == 0 && len(bob.Channels()) == 0
+	}, 10*time.Second, 10*time.Millisecond)
+	for _, id := range ids {
+		require.True(t, s.PAB.Concluded(id))
+	}
+	require.EqualValues(t, test.DefaultBalance-4*ada, s.Wallet.Balance(test.Alice.WalletID))
+	require.EqualValues(t, test.DefaultBalance+4*ada, s.Wallet.Balance(test.Bob.WalletID))
+}
+
+// forceCloseRecorder is an observer that records the progress of
+// force-closing channels.
+type forceCloseRecorder struct {
+	test.Observer
+	mutex    sync.Mutex
+	progress []client.ForceCloseProgress
+}
+
+func (o *forceCloseRecorder) UpdateForceClose(p client.ForceCloseProgress) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.progress = append(o.progress, p)
+}
+
+func (o *forceCloseRecorder) stages() []client.ForceCloseStage {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	stages := make([]client.ForceCloseStage, len(o.progress))
+	for i, p := range o.progress {
+		stages[i] = p.Stage
+	}
+	return stages
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/wire"
+	"perun.network/perun-cardano-demo/client"
+	"perun.network/perun-cardano-demo/client/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestInvoice(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	alice := s.NewClient(t, test.Alice, bus)
+	bob := s.NewClient(t, test.Bob, bus)
+	o := &invoiceRecorder{Observer: test.NewObserver()}
+	bob.Register(o)
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+
+	ch, err := alice.OpenChannel(ctx, test.Bob.WireAddress(t), 10*client.Ada)
+	require.NoError(t, err)
+	id := ch.ID()
+
+	// Bob invoices an order, Alice pays it.
+	inv, err := bob.CreateInvoice(2*client.Ada, "order 42", time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, client.InvoiceOpen, inv.Status)
+	require.NoError(t, alice.SendPayment(ctx, id, 2*client.Ada, client.WithInvoice(inv.ID), client.WithMemo("order 42")))
+	require.Eventually(t, func() bool {
+		inv, err := bob.Invoice(inv.ID)
+		return err == nil && inv.Status == client.InvoicePaid
+	}, 5*time.Second, 10*time.Millisecond)
+	paid, err := bob.Invoice(inv.ID)
+	require.NoError(t, err)
+	require.Equal(t, id, paid.ChannelID)
+	require.EqualValues(t, 1, paid.Version)
+	require.Equal(t, alice.DisplayAddress(), paid.Payer)
+	require.Equal(t, []client.Invoice{paid}, o.paid())
+
+	// Both ledgers reference the invoice.
+	require.Equal(t, inv.ID, ch.Payments()[0].Invoice)
+	received := bob.Payments(client.PaymentFilter{ChannelID: id})
+	require.Len(t, received, 1)
+	require.Equal(t, inv.ID, received[0].Invoice)
+	require.Equal(t, "order 42", received[0].Memo)
+
+	// Invoices can be paid once, with the exact amount and before they
+	// expire.
+	requireInvoiceRejected(t, alice.SendPayment(ctx, id, 2*client.Ada, client.WithInvoice(inv.ID)))
+	inv, err = bob.CreateInvoice(3*client.Ada, "order 43", time.Hour)
+	require.NoError(t, err)
+	requireInvoiceRejected(t, alice.SendPayment(ctx, id, 2*client.Ada, client.WithInvoice(inv.ID)))
+	expired, err := bob.CreateInvoice(client.Ada, "order 44", time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+	requireInvoiceRejected(t, alice.SendPayment(ctx, id, client.Ada, client.WithInvoice(expired.ID)))
+	requireInvoiceRejected(t, alice.SendPayment(ctx, id, client.Ada, client.WithInvoice("unknown")))
+
+	// A rejected payment does not reserve the invoice.
+	require.NoError(t, alice.SendPayment(ctx, id, 3*client.Ada, client.WithInvoice(inv.ID)))
+	require.Eventually(t, func() bool {
+		return len(o.paid()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	requireBalances(t, ch.State(), 5*ada, 15*ada)
+
+	invs := bob.Invoices()
+	require.Len(t, invs, 3)
+	require.Equal(t, client.InvoicePaid, invs[0].Status)
+	require.Equal(t, client.InvoicePaid, invs[1].Status)
+	require.Equal(t, client.InvoiceExpired, invs[2].Status)
+	_, err = bob.Invoice("unknown")
+	require.ErrorIs(t, err, client.ErrUnknownInvoice)
+	_, err = bob.CreateInvoice(0, "", 0)
+	require.ErrorIs(t, err, client.ErrInvalidAmount)
+}
+
+func requireInvoiceRejected(t *testing.T, err error) {
+	t.Helper()
+	require.ErrorIs(t, err, client.ErrPeerRejected)
+	rej, ok := client.PeerRejection(err)
+	require.True(t, ok)
+	require.Equal(t, client.ReasonInvalidInvoice, rej.Reason)
+}
+
+// invoiceRecorder is an observer that records paid invoices.
+type invoiceRecorder struct {
+	test.Observer
+	mutex    sync.Mutex
+	invoices []client.Invoice
+}
+
+func (o *invoiceRecorder) UpdateInvoice(inv client.Invoice) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.invoices = append(o.invoices, inv)
+}
+
+func (o *invoiceRecorder) paid() []client.Invoice {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return append([]client.Invoice(nil), o.invoices...)
+}
@@ -0,0 +1,262 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wire"
+	"perun.network/perun-cardano-backend/channel/types"
+	"perun.network/perun-cardano-demo/cardanowallet"
+	"perun.network/perun-cardano-demo/client"
+	"perun.network/perun-cardano-demo/client/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+const (
+	lifecycleTimeout = time.Minute
+	ada              = 1_000_000
+)
+
+func TestLifecycle(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	alice := s.NewClient(t, test.Alice, bus)
+	bob := s.NewClient(t, test.Bob, bus)
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+
+	// Open: both parties deposit 10 Ada.
+	ch, err := alice.OpenChannel(ctx, test.Bob.WireAddress(t), 10*client.Ada)
+	require.NoError(t, err)
+	id := ch.ID()
+	require.Eventually(t, func() bool {
+		_, err := bob.Channel(id)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{types.CreatedTag, types.DepositedTag}, s.PAB.Events(id))
+	require.EqualValues(t, test.DefaultBalance-10*ada, s.Wallet.Balance(test.Alice.WalletID))
+	require.EqualValues(t, test.DefaultBalance-10*ada, s.Wallet.Balance(test.Bob.WalletID))
+	bal, err := alice.QueryBalance(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, test.DefaultBalance-10*ada, bal)
+
+	// Pay: Alice sends 2 Ada to Bob.
+	require.NoError(t, alice.SendPayment(ctx, id, 2*client.Ada, client.WithMemo("coffee")))
+	bobCh, err := bob.Channel(id)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return bobCh.State().Version == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	requireBalances(t, bobCh.State(), 8*ada, 12*ada)
+
+	// Both ledgers record the payment, signed by Alice.
+	sent := ch.Payments()
+	require.Len(t, sent, 1)
+	require.Equal(t, client.PaymentSent, sent[0].Direction)
+	require.EqualValues(t, 1, sent[0].Version)
+	require.Equal(t, 2*client.Ada, sent[0].Amount)
+	require.Equal(t, "coffee", sent[0].Memo)
+	require.Equal(t, alice.DisplayAddress(), sent[0].Signer)
+	require.Eventually(t, func() bool {
+		return len(bob.Payments(client.PaymentFilter{Direction: client.PaymentReceived})) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	received := bob.Payments(client.PaymentFilter{ChannelID: id})[0]
+	require.Equal(t, client.PaymentReceived, received.Direction)
+	require.EqualValues(t, 1, received.Version)
+	require.Equal(t, 2*client.Ada, received.Amount)
+	require.Equal(t, "coffee", received.Memo)
+	require.Equal(t, alice.DisplayAddress(), received.Signer)
+
+	// Settle: Alice finalizes and withdraws. Bob sees the conclusion on-chain
+	// and withdraws automatically, which is a no-op on the concluded channel.
+	require.NoError(t, alice.SettleChannel(ctx, id))
+	require.True(t, s.PAB.Concluded(id))
+	require.True(t, bobCh.State().IsFinal)
+	require.Eventually(t, func() bool {
+		return len(bob.Channels()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, client.PhaseConcluded, bobCh.Phase())
+	bobEvents := bob.ChannelEvents(id)
+	require.Len(t, bobEvents, 1)
+	require.Equal(t, client.EventConcluded, bobEvents[0].Kind)
+	// The backend reports version 0 for all concluded events.
+	require.Zero(t, bobEvents[0].Version)
+	require.EqualValues(t, 2, bobEvents[0].Latest) // The payment and the final state.
+	require.Equal(t, []string{types.CreatedTag, types.DepositedTag, types.ConcludedTag}, s.PAB.Events(id))
+	require.EqualValues(t, test.DefaultBalance-2*ada, s.Wallet.Balance(test.Alice.WalletID))
+	require.EqualValues(t, test.DefaultBalance+2*ada, s.Wallet.Balance(test.Bob.WalletID))
+	require.Empty(t, alice.Channels())
+	require.Empty(t, bob.Channels())
+	// Finalizing is not a payment, and payments of closed channels are kept.
+	require.Len(t, alice.Payments(client.PaymentFilter{}), 1)
+	require.Len(t, bob.Payments(client.PaymentFilter{}), 1)
+
+	// The wallet history shows the deposit and the payout.
+	txs, err := alice.Transactions(ctx, cardanowallet.TransactionQuery{Order: cardanowallet.OrderAscending})
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+	require.Equal(t, cardanowallet.DirectionOutgoing, txs[0].Direction)
+	require.EqualValues(t, 10*ada, txs[0].Amount.Quantity)
+	require.Equal(t, cardanowallet.DirectionIncoming, txs[1].Direction)
+	require.EqualValues(t, 8*ada, txs[1].Amount.Quantity)
+}
+
+func TestAsymmetricFunding(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	alice := s.NewClient(t, test.Alice, bus)
+	bob := s.NewClient(t, test.Bob, bus, client.WithProposalPolicy(client.FundingLimits{MaxOwnDeposit: 1}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+
+	// Open: only Alice deposits, as a customer paying a merchant.
+	ch, err := alice.OpenChannel(ctx, test.Bob.WireAddress(t), 10*client.Ada,
+		client.WithPeerDeposit(0), client.WithChallengeDuration(60))
+	require.NoError(t, err)
+	id := ch.ID()
+	require.Eventually(t, func() bool {
+		_, err := bob.Channel(id)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	bobCh, err := bob.Channel(id)
+	require.NoError(t, err)
+	require.EqualValues(t, 60, bobCh.Params().ChallengeDuration)
+	requireBalances(t, bobCh.State(), 10*ada, 0)
+	require.EqualValues(t, test.DefaultBalance-10*ada, s.Wallet.Balance(test.Alice.WalletID))
+	require.EqualValues(t, test.DefaultBalance, s.Wallet.Balance(test.Bob.WalletID))
+
+	// Bob has nothing to send.
+	require.ErrorIs(t, bob.SendPayment(ctx, id, client.Lovelace), client.ErrInsufficientBalance)
+
+	// Pay and settle, Bob withdraws automatically.
+	require.NoError(t, alice.SendPayment(ctx, id, 3*client.Ada))
+	require.NoError(t, alice.SettleChannel(ctx, id))
+	require.Eventually(t, func() bool {
+		return len(bob.Channels()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.EqualValues(t, test.DefaultBalance-3*ada, s.Wallet.Balance(test.Alice.WalletID))
+	require.EqualValues(t, test.DefaultBalance+3*ada, s.Wallet.Balance(test.Bob.WalletID))
+}
+
+func TestUnequalFundingRejectedByDefault(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	alice := s.NewClient(t, test.Alice, bus)
+	bob := s.NewClient(t, test.Bob, bus)
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+
+	// Alice cannot make Bob deposit more than she does.
+	_, err := alice.OpenChannel(ctx, test.Bob.WireAddress(t), 0, client.WithPeerDeposit(10*client.Ada))
+	require.ErrorIs(t, err, client.ErrPeerRejected)
+	require.Contains(t, err.Error(), string(client.ReasonFundingUnequal))
+	_, err = alice.OpenChannel(ctx, test.Bob.WireAddress(t), 10*client.Ada, client.WithPeerDeposit(5*client.Ada))
+	require.ErrorIs(t, err, client.ErrPeerRejected)
+	require.Empty(t, bob.Channels())
+	require.EqualValues(t, test.DefaultBalance, s.Wallet.Balance(test.Bob.WalletID))
+}
+
+func TestMultipleChannels(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	alice := s.NewClient(t, test.Alice, bus)
+	bob := s.NewClient(t, test.Bob, bus)
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+
+	// Open two channels with the same peer.
+	ch1, err := alice.OpenChannel(ctx, test.Bob.WireAddress(t), 10*client.Ada)
+	require.NoError(t, err)
+	ch2, err := alice.OpenChannel(ctx, test.Bob.WireAddress(t), 5*client.Ada)
+	require.NoError(t, err)
+	id1, id2 := ch1.ID(), ch2.ID()
+	require.NotEqual(t, id1, id2)
+	require.Equal(t, []channel.ID{id1, id2}, channelIDs(alice.ChannelsWithPeer(test.Bob.WireAddress(t))))
+	require.Eventually(t, func() bool {
+		return len(bob.ChannelsWithPeer(test.Alice.WireAddress(t))) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	latest, err := alice.LatestChannel()
+	require.NoError(t, err)
+	require.Equal(t, id2, latest.ID())
+
+	// Payments are made in the channel with the given ID only.
+	require.NoError(t, alice.SendPayment(ctx, id1, 2*client.Ada))
+	require.NoError(t, alice.SendPayment(ctx, id2, client.Ada))
+	requireBalances(t, ch1.State(), 8*ada, 12*ada)
+	requireBalances(t, ch2.State(), 4*ada, 6*ada)
+	require.Len(t, ch1.Payments(), 1)
+	require.Len(t, ch2.Payments(), 1)
+
+	// Settling the latest channel leaves the other one open and makes it the
+	// latest channel again.
+	require.NoError(t, alice.SettleChannel(ctx, id2))
+	require.True(t, s.PAB.Concluded(id2))
+	require.False(t, s.PAB.Concluded(id1))
+	require.Equal(t, []channel.ID{id1}, channelIDs(alice.ChannelsWithPeer(test.Bob.WireAddress(t))))
+	latest, err = alice.LatestChannel()
+	require.NoError(t, err)
+	require.Equal(t, id1, latest.ID())
+	require.Eventually(t, func() bool {
+		return len(bob.ChannelsWithPeer(test.Alice.WireAddress(t))) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	latest, err = bob.LatestChannel()
+	require.NoError(t, err)
+	require.Equal(t, id1, latest.ID())
+	_, err = alice.Channel(id2)
+	require.ErrorIs(t, err, client.ErrNoChannel)
+
+	// The remaining channel is still usable.
+	require.NoError(t, alice.SendPayment(ctx, id1, client.Ada))
+	require.NoError(t, alice.SettleChannel(ctx, id1))
+	require.Eventually(t, func() bool {
+		return len(bob.Channels()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Empty(t, alice.ChannelsWithPeer(test.Bob.WireAddress(t)))
+	_, err = alice.LatestChannel()
+	require.ErrorIs(t, err, client.ErrNoChannel)
+	require.EqualValues(t, test.DefaultBalance-4*ada, s.Wallet.Balance(test.Alice.WalletID))
+	require.EqualValues(t, test.DefaultBalance+4*ada, s.Wallet.Balance(test.Bob.WalletID))
+}
+
+func requireBalances(t *testing.T, s *channel.State, bals ...int64) {
+	t.Helper()
+	got := s.Allocation.Balances[0]
+	require.Len(t, got, len(bals))
+	for i, b := range bals {
+		require.Zero(t, big.NewInt(b).Cmp(got[i]), "balance of party %d: %v", i, got[i])
+	}
+}
+
+func channelIDs(chs []*client.PaymentChannel) []channel.ID {
+	ids := make([]channel.ID, len(chs))
+	for i, ch := range chs {
+		ids[i] = ch.ID()
+	}
+	return ids
+}
@@ -0,0 +1,44 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"github.com/google/uuid"
+	tuiclient "perun.network/perun-demo-tui/client"
+)
+
+// Observer is a client observer that ignores the updates for the demo UI.
+// Tests embed it in recorders of the notifications they check.
+type Observer struct {
+	id uuid.UUID
+}
+
+var _ tuiclient.Observer = (*Observer)(nil)
+
+// NewObserver returns an observer with a random ID.
+func NewObserver() Observer {
+	return Observer{id: uuid.New()}
+}
+
+// UpdateState ignores the state update.
+func (o *Observer) UpdateState(string) {}
+
+// UpdateBalance ignores the balance update.
+func (o *Observer) UpdateBalance(string) {}
+
+// GetID returns the ID of the observer.
+func (o *Observer) GetID() uuid.UUID {
+	return o.id
+}
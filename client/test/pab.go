@@ -0,0 +1,548 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	channel2 "perun.network/perun-cardano-backend/channel"
+	"perun.network/perun-cardano-backend/channel/types"
+	"perun.network/perun-cardano-backend/wire"
+)
+
+// writeTimeout bounds how long an event may take to reach a subscriber.
+const writeTimeout = 5 * time.Second
+
+// PAB is a fake Plutus Application Backend. It implements the HTTP and
+// websocket endpoints used by channel2.PAB and keeps the on-chain channel
+// state in memory. Signatures are not verified, but the fake enforces the
+// protocol rules the funder and adjudicator rely on: a channel must be
+// started by party 0 before the others fund it, only final states can be
+// closed, disputes must register newer states and disputed channels can only
+// be force-closed after the challenge period. Closing or force-closing an
+// already concluded channel succeeds ("try-close").
+//
+// If a Wallet is attached, deposits are debited from and payouts credited to
+// the wallet of the calling contract instance.
+type PAB struct {
+	server   *httptest.Server
+	wallet   *Wallet
+	upgrader websocket.Upgrader
+
+	mutex     sync.Mutex
+	instances map[string]instance
+	channels  map[wire.ChannelID]*chainChannel
+}
+
+// instance is an activated contract instance.
+type instance struct {
+	walletID string
+	// channelID is set for adjudicator subscriptions.
+	channelID *wire.ChannelID
+}
+
+// chainChannel is the on-chain representation of a channel.
+type chainChannel struct {
+	started   bool
+	concluded bool
+	datum     wire.ChannelDatum
+	wallets   []string // Funding wallet ID per party.
+	events    []wire.Event
+	subs      map[*websocket.Conn]struct{}
+}
+
+// NewPAB starts a fake PAB. w may be nil, in which case no balances are
+// tracked. The PAB must be closed using Close.
+func NewPAB(w *Wallet) *PAB {
+	p := &PAB{
+		wallet:    w,
+		instances: make(map[string]instance),
+		channels:  make(map[wire.ChannelID]*chainChannel),
+	}
+	p.server = httptest.NewServer(http.HandlerFunc(p.serve))
+	return p
+}
+
+// Host returns the host of the PAB as expected by channel2.NewPAB.
+func (p *PAB) Host() string {
+	return p.server.Listener.Addr().String()
+}
+
+// Close closes all subscriptions and shuts down the server.
+func (p *PAB) Close() {
+	p.mutex.Lock()
+	for _, ch := range p.channels {
+		for conn := range ch.subs {
+			_ = conn.Close()
+		}
+		ch.subs = nil
+	}
+	p.mutex.Unlock()
+	p.server.Close()
+}
+
+// Events returns the tags of the events emitted for the given channel.
+func (p *PAB) Events(id [32]byte) []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	ch, ok := p.channels[wire.ChannelID(id)]
+	if !ok {
+		return nil
+	}
+	tags := make([]string, len(ch.events))
+	for i, e := range ch.events {
+		tags[i] = e.Tag
+	}
+	return tags
+}
+
+// Concluded returns whether the given channel was concluded on-chain.
+func (p *PAB) Concluded(id [32]byte) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	ch, ok := p.channels[wire.ChannelID(id)]
+	return ok && ch.concluded
+}
+
+func (p *PAB) serve(rw http.ResponseWriter, r *http.Request) {
+	var err error
+	switch path := r.URL.Path; {
+	case path == channel2.ActivateEndpoint && r.Method == http.MethodPost:
+		err = p.activate(rw, r)
+	case strings.HasPrefix(path, channel2.WebSocketEndpoint+"/"):
+		err = p.subscribe(rw, r, strings.TrimPrefix(path, channel2.WebSocketEndpoint+"/"))
+	case strings.HasPrefix(path, channel2.InstanceEndpoint+"/") && r.Method == http.MethodPost:
+		err = p.callEndpoint(rw, r, strings.TrimPrefix(path, channel2.InstanceEndpoint+"/"))
+	default:
+		err = errNotFound
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(rw, err.Error(), status)
+	}
+}
+
+var errNotFound = errors.New("not found")
+
+// activationBody covers both the Perun contract and the adjudicator
+// subscription activation bodies.
+type activationBody struct {
+	CaID struct {
+		Tag       string          `json:"tag"`
+		ChannelID *wire.ChannelID `json:"contents"`
+	} `json:"caID"`
+	Wallet wire.ContractActivationWallet `json:"caWallet"`
+}
+
+func (p *PAB) activate(rw http.ResponseWriter, r *http.Request) error {
+	var body activationBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return fmt.Errorf("decoding activation body: %w", err)
+	}
+	inst := instance{walletID: body.Wallet.WalletID}
+	switch body.CaID.Tag {
+	case wire.PerunContractTag:
+	case wire.AdjudicatorTag:
+		if body.CaID.ChannelID == nil {
+			return errors.New("adjudicator subscription without channel ID")
+		}
+		inst.channelID = body.CaID.ChannelID
+	default:
+		return fmt.Errorf("unknown contract: %q", body.CaID.Tag)
+	}
+
+	id := randomHex(16)
+	p.mutex.Lock()
+	p.instances[id] = inst
+	p.mutex.Unlock()
+	writeJSON(rw, http.StatusOK, wire.ContractInstanceID{ID: id})
+	return nil
+}
+
+// subscribe upgrades the request to a websocket connection and streams the
+// events of the subscribed channel. Past events are replayed first.
+func (p *PAB) subscribe(rw http.ResponseWriter, r *http.Request, id string) error {
+	p.mutex.Lock()
+	inst, ok := p.instances[id]
+	p.mutex.Unlock()
+	if !ok || inst.channelID == nil {
+		return fmt.Errorf("subscription %q: %w", id, errNotFound)
+	}
+	conn, err := p.upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		// The upgrader already replied to the client.
+		return nil
+	}
+
+	p.mutex.Lock()
+	ch := p.channel(*inst.channelID)
+	ch.subs[conn] = struct{}{}
+	for _, e := range ch.events {
+		if !send(conn, e) {
+			delete(ch.subs, conn)
+			break
+		}
+	}
+	p.mutex.Unlock()
+
+	// Drain the connection to process control frames and notice when the
+	// subscriber goes away.
+	go func() {
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				p.mutex.Lock()
+				delete(ch.subs, conn)
+				p.mutex.Unlock()
+				_ = conn.Close()
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (p *PAB) callEndpoint(rw http.ResponseWriter, r *http.Request, path string) error {
+	parts := strings.Split(path, "/")
+	if len(parts) != 3 || parts[1] != "endpoint" {
+		return errNotFound
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	inst, ok := p.instances[parts[0]]
+	if !ok || inst.channelID != nil {
+		return fmt.Errorf("contract instance %q: %w", parts[0], errNotFound)
+	}
+
+	var err error
+	switch parts[2] {
+	case "start":
+		var params wire.OpenParams
+		if err = json.NewDecoder(r.Body).Decode(&params); err == nil {
+			err = p.start(inst, params)
+		}
+	case "fund":
+		var params wire.FundParams
+		if err = json.NewDecoder(r.Body).Decode(&params); err == nil {
+			err = p.fund(inst, params)
+		}
+	case "close":
+		var params wire.CloseParams
+		if err = json.NewDecoder(r.Body).Decode(&params); err == nil {
+			err = p.close(params)
+		}
+	case "dispute":
+		var params wire.DisputeParams
+		if err = json.NewDecoder(r.Body).Decode(&params); err == nil {
+			err = p.dispute(params)
+		}
+	case "forceClose":
+		var params wire.ForceCloseParams
+		if err = json.NewDecoder(r.Body).Decode(&params); err == nil {
+			err = p.forceClose(params)
+		}
+	default:
+		return fmt.Errorf("endpoint %q: %w", parts[2], errNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("endpoint %s: %w", parts[2], err)
+	}
+	writeJSON(rw, http.StatusOK, []interface{}{})
+	return nil
+}
+
+// start creates the channel and funds the deposit of party 0. Must be called
+// with the mutex held.
+func (p *PAB) start(inst instance, params wire.OpenParams) error {
+	ch := p.channel(params.ChannelID)
+	if ch.started {
+		return errors.New("channel already started")
+	}
+	n := len(params.Balances)
+	if n == 0 || len(params.SigningPubKeys) != n || len(params.PaymentPubKeyHashes) != n {
+		return errors.New("inconsistent channel parameters")
+	}
+
+	var token wire.ChannelToken
+	token.TokenName.Name = randomHex(32)
+	token.CurrencySymbol.Symbol = randomHex(28)
+	token.CtTxOutRef.TxOutRefId.GetTxId = randomHex(32)
+	funding := make([]uint64, n)
+	funding[0] = params.Balances[0]
+	ch.started = true
+	ch.wallets = make([]string, n)
+	ch.wallets[0] = inst.walletID
+	ch.datum = wire.ChannelDatum{
+		ChannelParameters: wire.ChannelParameters{
+			Nonce:               params.Nonce,
+			PaymentPubKeyHashes: params.PaymentPubKeyHashes,
+			SigningPubKeys:      params.SigningPubKeys,
+			TimeLock:            params.TimeLock,
+		},
+		ChannelToken: token,
+		Funding:      funding,
+		Funded:       funded(funding, params.Balances),
+		ChannelState: wire.ChannelState{
+			Balances:  append([]uint64(nil), params.Balances...),
+			ChannelID: params.ChannelID,
+		},
+		Time: time.Now().UnixMilli(),
+	}
+	p.transfer(inst.walletID, -int64(params.Balances[0]))
+	p.emit(ch, types.CreatedTag, copyDatum(ch.datum))
+	return nil
+}
+
+// fund funds the deposit of the given party. Must be called with the mutex
+// held.
+func (p *PAB) fund(inst instance, params wire.FundParams) error {
+	ch, ok := p.channels[params.ChannelID]
+	if !ok || !ch.started {
+		return errors.New("channel not started")
+	}
+	if ch.concluded {
+		return errors.New("channel already concluded")
+	}
+	idx := int(params.Index)
+	bals := ch.datum.ChannelState.Balances
+	if idx >= len(bals) {
+		return fmt.Errorf("invalid party index: %d", idx)
+	}
+	if ch.datum.Funding[idx] == bals[idx] && bals[idx] != 0 {
+		return fmt.Errorf("party %d already funded", idx)
+	}
+	if err := checkToken(ch.datum.ChannelToken, params.ChannelToken); err != nil {
+		return err
+	}
+
+	old := copyDatum(ch.datum)
+	ch.datum.Funding[idx] = bals[idx]
+	ch.datum.Funded = funded(ch.datum.Funding, bals)
+	ch.datum.Time = time.Now().UnixMilli()
+	ch.wallets[idx] = inst.walletID
+	p.transfer(inst.walletID, -int64(bals[idx]))
+	p.emit(ch, types.DepositedTag, old, copyDatum(ch.datum))
+	return nil
+}
+
+// close concludes the channel with the given final state and pays out the
+// final balances. Must be called with the mutex held.
+func (p *PAB) close(params wire.CloseParams) error {
+	ch, ok := p.channels[params.ChannelID]
+	if !ok || !ch.started {
+		return errors.New("channel not started")
+	}
+	if ch.concluded {
+		return nil
+	}
+	state := params.SignedState.ChannelState
+	if err := checkToken(ch.datum.ChannelToken, params.ChannelToken); err != nil {
+		return err
+	}
+	if !ch.datum.Funded {
+		return errors.New("channel not funded")
+	}
+	if !state.Final {
+		return errors.New("channel state is not final")
+	}
+	if state.ChannelID != params.ChannelID || len(state.Balances) != len(ch.datum.ChannelState.Balances) {
+		return errors.New("state does not belong to channel")
+	}
+	if len(params.SignedState.Signatures) != len(state.Balances) {
+		return fmt.Errorf("expected %d signatures, got %d", len(state.Balances), len(params.SignedState.Signatures))
+	}
+
+	ch.datum.ChannelState = wire.ChannelState{
+		Balances:  append([]uint64(nil), state.Balances...),
+		ChannelID: state.ChannelID,
+		Final:     true,
+		Version:   state.Version,
+	}
+	ch.datum.Time = time.Now().UnixMilli()
+	ch.concluded = true
+	for i, bal := range state.Balances {
+		p.transfer(ch.wallets[i], int64(bal))
+	}
+	p.emit(ch, types.ConcludedTag, copyDatum(ch.datum))
+	return nil
+}
+
+// dispute registers the given state, which starts the challenge period. A
+// disputed channel can only be disputed with newer states. Must be called
+// with the mutex held.
+func (p *PAB) dispute(params wire.DisputeParams) error {
+	ch, ok := p.channels[params.ChannelID]
+	if !ok || !ch.started {
+		return errors.New("channel not started")
+	}
+	if ch.concluded {
+		return errors.New("channel already concluded")
+	}
+	state := params.SignedState.ChannelState
+	if err := checkToken(ch.datum.ChannelToken, params.ChannelToken); err != nil {
+		return err
+	}
+	if !ch.datum.Funded {
+		return errors.New("channel not funded")
+	}
+	if state.ChannelID != params.ChannelID || len(state.Balances) != len(ch.datum.ChannelState.Balances) {
+		return errors.New("state does not belong to channel")
+	}
+	if len(params.SignedState.Signatures) != len(state.Balances) {
+		return fmt.Errorf("expected %d signatures, got %d", len(state.Balances), len(params.SignedState.Signatures))
+	}
+	if ch.datum.Disputed && state.Version <= ch.datum.ChannelState.Version {
+		return fmt.Errorf("version %d is not newer than disputed version %d", state.Version, ch.datum.ChannelState.Version)
+	}
+
+	old := copyDatum(ch.datum)
+	ch.datum.ChannelState = wire.ChannelState{
+		Balances:  append([]uint64(nil), state.Balances...),
+		ChannelID: state.ChannelID,
+		Final:     state.Final,
+		Version:   state.Version,
+	}
+	ch.datum.Disputed = true
+	ch.datum.Time = time.Now().UnixMilli()
+	p.emit(ch, types.DisputedTag, old, copyDatum(ch.datum))
+	return nil
+}
+
+// forceClose concludes a disputed channel after the challenge period and
+// pays out the disputed balances. Must be called with the mutex held.
+func (p *PAB) forceClose(params wire.ForceCloseParams) error {
+	ch, ok := p.channels[params.ChannelID]
+	if !ok || !ch.started {
+		return errors.New("channel not started")
+	}
+	if ch.concluded {
+		return nil
+	}
+	if err := checkToken(ch.datum.ChannelToken, params.ChannelToken); err != nil {
+		return err
+	}
+	if !ch.datum.Disputed {
+		return errors.New("channel not disputed")
+	}
+	timeout := time.UnixMilli(ch.datum.Time + ch.datum.ChannelParameters.TimeLock)
+	if now := time.Now(); now.Before(timeout) {
+		return fmt.Errorf("challenge period ends in %v", timeout.Sub(now))
+	}
+
+	ch.datum.Time = time.Now().UnixMilli()
+	ch.concluded = true
+	for i, bal := range ch.datum.ChannelState.Balances {
+		p.transfer(ch.wallets[i], int64(bal))
+	}
+	p.emit(ch, types.ConcludedTag, copyDatum(ch.datum))
+	return nil
+}
+
+// channel returns the channel with the given ID, creating an empty entry if
+// it is unknown. Must be called with the mutex held.
+func (p *PAB) channel(id wire.ChannelID) *chainChannel {
+	ch, ok := p.channels[id]
+	if !ok {
+		ch = &chainChannel{subs: make(map[*websocket.Conn]struct{})}
+		p.channels[id] = ch
+	}
+	return ch
+}
+
+// transfer credits amount Lovelace to the given wallet. Negative amounts are
+// debited.
+func (p *PAB) transfer(walletID string, amount int64) {
+	if p.wallet == nil || walletID == "" {
+		return
+	}
+	p.wallet.credit(walletID, amount)
+}
+
+// emit records the event and broadcasts it to all subscribers. Must be
+// called with the mutex held.
+func (p *PAB) emit(ch *chainChannel, tag string, datums ...wire.ChannelDatum) {
+	e := wire.Event{Tag: tag, DatumList: datums, Signatures: []wire.Signature{}}
+	ch.events = append(ch.events, e)
+	for conn := range ch.subs {
+		if !send(conn, e) {
+			delete(ch.subs, conn)
+		}
+	}
+}
+
+// send sends e to the subscriber and reports whether it succeeded.
+func send(conn *websocket.Conn, e wire.Event) bool {
+	contents, err := json.Marshal([]wire.Event{e})
+	if err != nil {
+		return false
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	err = conn.WriteJSON(wire.SubscriptionMessage{Tag: wire.EventMessageTag, Contents: contents})
+	if err != nil {
+		_ = conn.Close()
+		return false
+	}
+	return true
+}
+
+func checkToken(token wire.ChannelToken, class wire.AssetClass) error {
+	want, err := json.Marshal(wire.AssetClass{A: []interface{}{token.CurrencySymbol, token.TokenName}})
+	if err != nil {
+		return err
+	}
+	got, err := json.Marshal(class)
+	if err != nil {
+		return err
+	}
+	if string(want) != string(got) {
+		return errors.New("mismatching channel token")
+	}
+	return nil
+}
+
+func funded(funding, balances []uint64) bool {
+	for i := range balances {
+		if funding[i] != balances[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func copyDatum(d wire.ChannelDatum) wire.ChannelDatum {
+	d.Funding = append([]uint64(nil), d.Funding...)
+	d.ChannelState.Balances = append([]uint64(nil), d.ChannelState.Balances...)
+	return d
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,82 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/wire"
+	"perun.network/perun-cardano-demo/client"
+	"perun.network/perun-cardano-demo/client/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestRestore(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	db := filepath.Join(t.TempDir(), "alice")
+	persistence := func() client.Option {
+		pr, err := client.NewLevelDBPersistRestorer(db)
+		require.NoError(t, err)
+		return client.WithPersistence(pr)
+	}
+	alice := s.NewClient(t, test.Alice, bus, persistence())
+	bob := s.NewClient(t, test.Bob, bus)
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+
+	ch, err := alice.OpenChannel(ctx, test.Bob.WireAddress(t), 10*client.Ada)
+	require.NoError(t, err)
+	id := ch.ID()
+	require.NoError(t, alice.SendPayment(ctx, id, 2*client.Ada))
+	require.NoError(t, alice.SendPayment(ctx, id, client.Ada))
+	state := ch.State()
+	params := ch.Params()
+	alice.Shutdown()
+
+	// After the restart on the same database, the channel is registered with
+	// its parameters and latest state.
+	alice = s.NewClient(t, test.Alice, bus, persistence())
+	require.Len(t, alice.Channels(), 1)
+	restored, err := alice.Channel(id)
+	require.NoError(t, err)
+	require.Equal(t, params.ID(), restored.Params().ID())
+	require.Equal(t, params.ChallengeDuration, restored.Params().ChallengeDuration)
+	require.Equal(t, state.Version, restored.State().Version)
+	require.EqualValues(t, 2, restored.State().Version)
+	require.NoError(t, state.Equal(restored.State()))
+	require.Equal(t, ch.Idx(), restored.Idx())
+	require.True(t, restored.Peer().Equal(test.Bob.WireAddress(t)))
+	require.Equal(t, client.PhaseOpen, restored.Phase())
+
+	// The restored channel can be used with the peer.
+	require.NoError(t, alice.SendPayment(ctx, id, client.Ada))
+	require.Eventually(t, func() bool {
+		bch, err := bob.Channel(id)
+		return err == nil && bch.State().Version == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, alice.SettleChannel(ctx, id))
+	alice.Shutdown()
+
+	// Settled channels are not restored.
+	alice = s.NewClient(t, test.Alice, bus, persistence())
+	require.Empty(t, alice.Channels())
+}
@@ -0,0 +1,130 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/wire"
+	"perun.network/perun-cardano-demo/client"
+	"perun.network/perun-cardano-demo/client/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestRequestPayment(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	o := &requestRecorder{Observer: test.NewObserver()}
+	alice := s.NewClient(t, test.Alice, bus,
+		client.WithRequestPolicy(client.ApproveUpTo(2*client.Ada, client.AskUserRequests(0))))
+	alice.Register(o)
+	bob := s.NewClient(t, test.Bob, bus)
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+
+	ch, err := alice.OpenChannel(ctx, test.Bob.WireAddress(t), 10*client.Ada)
+	require.NoError(t, err)
+	id := ch.ID()
+	require.Eventually(t, func() bool {
+		_, err := bob.Channel(id)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Small requests are paid automatically.
+	inv, err := bob.RequestPayment(ctx, id, client.Ada, "minute 1")
+	require.NoError(t, err)
+	require.Equal(t, client.InvoicePaid, inv.Status)
+	require.Equal(t, id, inv.ChannelID)
+	// The payee learns about the payment before the payer recorded it.
+	require.Eventually(t, func() bool {
+		return len(ch.Payments()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "minute 1", ch.Payments()[0].Memo)
+	require.Equal(t, inv.ID, ch.Payments()[0].Invoice)
+
+	// Larger requests wait for the user, who declines the first one.
+	done := make(chan error, 1)
+	go func() {
+		_, err := bob.RequestPayment(ctx, id, 3*client.Ada, "minutes 2-4")
+		done <- err
+	}()
+	pending := o.await(t, 1)
+	require.Equal(t, []*client.PendingRequest{pending}, alice.PendingRequests())
+	require.Equal(t, 3*client.Ada, pending.Amount)
+	require.Equal(t, "minutes 2-4", pending.Description)
+	require.True(t, pending.Peer.Equal(test.Bob.WireAddress(t)))
+	require.NoError(t, alice.DecideRequest(pending.ID, false, "too expensive"))
+	err = <-done
+	require.ErrorIs(t, err, client.ErrPeerRejected)
+	rej, ok := client.PeerRejection(err)
+	require.True(t, ok)
+	require.Equal(t, client.ReasonUserDeclined, rej.Reason)
+	require.Equal(t, "too expensive", rej.Msg)
+	require.ErrorIs(t, alice.DecideRequest(pending.ID, true, ""), client.ErrUnknownRequest)
+
+	// The user approves the second one.
+	go func() {
+		_, err := bob.RequestPayment(ctx, id, 3*client.Ada, "minutes 2-4")
+		done <- err
+	}()
+	pending = o.await(t, 2)
+	require.NoError(t, alice.DecideRequest(pending.ID, true, ""))
+	require.NoError(t, <-done)
+	requireBalances(t, ch.State(), 6*ada, 14*ada)
+	require.Empty(t, alice.PendingRequests())
+
+	// Requests above the peer's balance are not sent, and clients decline
+	// requests by default.
+	_, err = bob.RequestPayment(ctx, id, 7*client.Ada, "")
+	require.ErrorIs(t, err, client.ErrInsufficientBalance)
+	_, err = alice.RequestPayment(ctx, id, client.Ada, "")
+	require.ErrorIs(t, err, client.ErrPeerRejected)
+	rej, ok = client.PeerRejection(err)
+	require.True(t, ok)
+	require.Equal(t, client.ReasonRequestDeclined, rej.Reason)
+	requireBalances(t, ch.State(), 6*ada, 14*ada)
+}
+
+// requestRecorder is an observer that records pending payment requests.
+type requestRecorder struct {
+	test.Observer
+	mutex    sync.Mutex
+	requests []*client.PendingRequest
+}
+
+func (o *requestRecorder) PaymentRequestPending(r *client.PendingRequest) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.requests = append(o.requests, r)
+}
+
+// await waits until n requests were recorded and returns the last one.
+func (o *requestRecorder) await(t *testing.T, n int) *client.PendingRequest {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		return len(o.requests) >= n
+	}, 5*time.Second, 10*time.Millisecond)
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.requests[n-1]
+}
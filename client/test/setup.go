@@ -0,0 +1,136 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"encoding/hex"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	gpchannel "perun.network/go-perun/channel"
+	gpwallet "perun.network/go-perun/wallet"
+	"perun.network/go-perun/wire"
+	channel2 "perun.network/perun-cardano-backend/channel"
+	wallet2 "perun.network/perun-cardano-backend/wallet"
+	"perun.network/perun-cardano-backend/wallet/address"
+	wallettest "perun.network/perun-cardano-backend/wallet/test"
+	"perun.network/perun-cardano-demo/client"
+)
+
+// DefaultBalance is the initial wallet balance of every party in Lovelace.
+const DefaultBalance = 1_000_000_000
+
+// Party is a demo participant.
+type Party struct {
+	Name              string
+	PublicKey         string
+	PaymentIdentifier string
+	WalletID          string
+}
+
+// The demo parties, as in config.example.yaml.
+var (
+	Alice = Party{
+		Name:              "Alice",
+		PublicKey:         "5a3aeed83ffe0e41408a41de4cf9e1f1e39416643ea21231a2d00be46f5446a9",
+		PaymentIdentifier: "9706069d2e482d1612cdf062d0d2f9bb3db01ab074f7c3eeb741bcd4",
+		WalletID:          "c35896086738b89c00f3ff41f2beced7449fc6e6",
+	}
+	Bob = Party{
+		Name:              "Bob",
+		PublicKey:         "04960fbc5fe4f1ae939fdfed8a13569384474db2a38ce7b65b328d1cd578fded",
+		PaymentIdentifier: "b50a436ae002343d30c9ddd48608a13e0e38b6785a47121c80cf45ff",
+		WalletID:          "34dd5c2bc7ec25850765242b83a31053ac3d3fb5",
+	}
+)
+
+// Address returns the Cardano address of the party.
+func (p Party) Address(t *testing.T) address.Address {
+	t.Helper()
+	pubKey, err := hex.DecodeString(p.PublicKey)
+	require.NoError(t, err)
+	addr, err := address.MakeAddressFromPubKeyByteSlice(pubKey)
+	require.NoError(t, err)
+	require.NoError(t, addr.SetPaymentPubKeyHashFromHexString(p.PaymentIdentifier))
+	return addr
+}
+
+// WireAddress returns the off-chain address of the party.
+func (p Party) WireAddress(t *testing.T) wire.Address {
+	t.Helper()
+	addr, err := client.WireAddressFromPubKey(p.PublicKey)
+	require.NoError(t, err)
+	return addr
+}
+
+// Setup bundles a fake cardano-wallet, a fake PAB and a fake remote wallet
+// holding the keys of the given parties.
+type Setup struct {
+	Wallet *Wallet
+	PAB    *PAB
+	Remote wallet2.Remote
+}
+
+// NewSetup starts the fakes for the given parties and funds their wallets
+// with DefaultBalance. The fakes are shut down when the test ends.
+func NewSetup(t *testing.T, rng *rand.Rand, parties ...Party) *Setup {
+	t.Helper()
+	addrs := make([]address.Address, len(parties))
+	for i, p := range parties {
+		addrs[i] = p.Address(t)
+	}
+	s := &Setup{
+		Wallet: NewWallet(),
+		Remote: wallettest.NewGenericRemote(addrs, rng),
+	}
+	s.PAB = NewPAB(s.Wallet)
+	t.Cleanup(s.PAB.Close)
+	t.Cleanup(s.Wallet.Close)
+	for _, p := range parties {
+		s.Wallet.SetBalance(p.WalletID, DefaultBalance)
+	}
+	SetBackends(s.Remote)
+	return s
+}
+
+// NewClient sets up a payment client for p that uses the fakes. It is shut
+// down when the test ends.
+func (s *Setup) NewClient(t *testing.T, p Party, bus wire.Bus, opts ...client.Option) *client.PaymentClient {
+	t.Helper()
+	c, err := client.SetupPaymentClient(
+		p.Name, bus, s.PAB.Host(), p.PublicKey, p.PaymentIdentifier, p.WalletID, s.Remote, s.Wallet.URL(), opts...,
+	)
+	require.NoError(t, err)
+	t.Cleanup(c.Shutdown)
+	return c
+}
+
+var backendsOnce sync.Once
+
+// SetBackends sets the Cardano wallet and channel backends of go-perun, like
+// the demo does on startup. The backends are global and can only be set
+// once per process, so subsequent calls have no effect. The signatures
+// created by the fake remote wallets are recorded globally, so the remote of
+// the first call verifies those of all later setups, too.
+func SetBackends(r wallet2.Remote) {
+	backendsOnce.Do(func() {
+		wb := wallet2.MakeRemoteBackend(r)
+		gpwallet.SetBackend(wb)
+		channel2.SetWalletBackend(wb)
+		gpchannel.SetBackend(channel2.Backend)
+	})
+}
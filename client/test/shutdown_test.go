@@ -0,0 +1,102 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wire"
+	"perun.network/perun-cardano-demo/client"
+	"perun.network/perun-cardano-demo/client/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestGracefulShutdownSettle(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	alice := s.NewClient(t, test.Alice, bus)
+	bob := s.NewClient(t, test.Bob, bus)
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+
+	ch, err := alice.OpenChannel(ctx, test.Bob.WireAddress(t), 10*client.Ada)
+	require.NoError(t, err)
+	id := ch.ID()
+	require.NoError(t, alice.SendPayment(ctx, id, 2*client.Ada))
+
+	summary := alice.GracefulShutdown(ctx, client.SettleChannels)
+	require.True(t, summary.Drained)
+	require.Equal(t, []channel.ID{id}, summary.Settled)
+	require.Empty(t, summary.LeftOpen)
+	require.Empty(t, summary.Errors)
+	require.True(t, s.PAB.Concluded(id))
+	require.Eventually(t, func() bool {
+		return len(bob.Channels()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.EqualValues(t, test.DefaultBalance-2*ada, s.Wallet.Balance(test.Alice.WalletID))
+	require.EqualValues(t, test.DefaultBalance+2*ada, s.Wallet.Balance(test.Bob.WalletID))
+
+	// The client does not start new operations.
+	_, err = alice.OpenChannel(ctx, test.Bob.WireAddress(t), client.Ada)
+	require.ErrorIs(t, err, client.ErrShuttingDown)
+}
+
+func TestGracefulShutdownLeaveOpen(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	db := filepath.Join(t.TempDir(), "alice")
+	persistence := func() client.Option {
+		pr, err := client.NewLevelDBPersistRestorer(db)
+		require.NoError(t, err)
+		return client.WithPersistence(pr)
+	}
+	alice := s.NewClient(t, test.Alice, bus, persistence())
+	bob := s.NewClient(t, test.Bob, bus)
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+
+	ch, err := alice.OpenChannel(ctx, test.Bob.WireAddress(t), 10*client.Ada)
+	require.NoError(t, err)
+	id := ch.ID()
+	require.NoError(t, alice.SendPayment(ctx, id, 2*client.Ada))
+
+	summary := alice.GracefulShutdown(ctx, client.LeaveChannelsOpen)
+	require.True(t, summary.Drained)
+	require.Empty(t, summary.Settled)
+	require.Equal(t, []channel.ID{id}, summary.LeftOpen)
+	require.True(t, summary.Persisted)
+	require.False(t, s.PAB.Concluded(id))
+	require.ErrorIs(t, alice.SettleChannel(ctx, id), client.ErrShuttingDown)
+
+	// After the restart, the channel is open with the latest state.
+	alice = s.NewClient(t, test.Alice, bus, persistence())
+	restored, err := alice.Channel(id)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, restored.State().Version)
+	require.Equal(t, client.PhaseOpen, restored.Phase())
+	require.NoError(t, alice.SettleChannel(ctx, id))
+	require.Eventually(t, func() bool {
+		return len(bob.Channels()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,191 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/wire"
+	"perun.network/perun-cardano-demo/client"
+	"perun.network/perun-cardano-demo/client/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestStream(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	clk := test.NewFakeClock(time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC))
+	alice := s.NewClient(t, test.Alice, bus, client.WithClock(clk))
+	o := &streamRecorder{Observer: test.NewObserver()}
+	alice.Register(o)
+	peer := &slowPeer{entered: make(chan struct{}, 8)}
+	bob := s.NewClient(t, test.Bob, bus, client.WithUpdatePolicy(client.AllUpdates(client.ConsistentUpdates, peer)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+
+	ch, err := alice.OpenChannel(ctx, test.Bob.WireAddress(t), 10*client.Ada)
+	require.NoError(t, err)
+	const rate = client.Ada / 10
+
+	// While Bob holds the first payment, the elapsed intervals accumulate
+	// and are paid in one batch.
+	hold := peer.hold()
+	require.NoError(t, ch.StartStream(rate, time.Second, client.Ada))
+	require.ErrorIs(t, ch.StartStream(rate, time.Second, 0), client.ErrStreamRunning)
+	clk.Advance(time.Second)
+	<-peer.entered
+	clk.Advance(2 * time.Second)
+	peer.release(hold)
+	st := o.await(t, func(s client.StreamStatus) bool { return s.Payments == 2 })
+	require.Equal(t, client.StreamRunning, st.State)
+	require.Equal(t, 3*rate, st.Paid)
+
+	// The stream stops at the cap.
+	clk.Advance(10 * time.Second)
+	st = o.await(t, func(s client.StreamStatus) bool { return s.State != client.StreamRunning })
+	require.Equal(t, client.StreamCapReached, st.State)
+	require.Equal(t, client.Ada, st.Paid)
+	require.Equal(t, 3, st.Payments)
+	require.Equal(t, client.Amount(1_000_000/13), st.Throughput())
+	amounts := func() []client.Amount {
+		var as []client.Amount
+		for _, p := range ch.Payments() {
+			as = append(as, p.Amount)
+		}
+		return as
+	}
+	require.Equal(t, []client.Amount{rate, 2 * rate, 7 * rate}, amounts())
+	require.Zero(t, clk.Tickers())
+
+	// The stream stops if the peer rejects a payment.
+	peer.setReject(true)
+	require.NoError(t, ch.StartStream(rate, time.Second, 0))
+	clk.Advance(time.Second)
+	st = o.await(t, func(s client.StreamStatus) bool { return s.State == client.StreamRejected })
+	require.ErrorIs(t, st.Err, client.ErrPeerRejected)
+	require.Zero(t, st.Paid)
+
+	// StopStream stops the stream after the payment in flight.
+	peer.setReject(false)
+	require.NoError(t, ch.StartStream(rate, time.Second, 0))
+	hold = peer.hold()
+	clk.Advance(time.Second)
+	<-peer.entered
+	stopped := make(chan client.StreamStatus, 1)
+	go func() {
+		st, err := ch.StopStream()
+		require.NoError(t, err)
+		stopped <- st
+	}()
+	peer.release(hold)
+	st = <-stopped
+	require.Equal(t, client.StreamStopped, st.State)
+	require.Equal(t, rate, st.Paid)
+	clk.Advance(time.Hour)
+	require.Equal(t, []client.Amount{rate, 2 * rate, 7 * rate, rate}, amounts())
+	requireBalances(t, ch.State(), 89*ada/10, 111*ada/10)
+
+	require.ErrorIs(t, ch.StartStream(0, time.Second, 0), client.ErrInvalidAmount)
+	require.ErrorIs(t, ch.StartStream(rate, 0, 0), client.ErrInvalidParams)
+	// The total of an uncapped stream must not overflow, however long it runs.
+	require.ErrorIs(t, ch.StartStream(client.Ada, time.Nanosecond, 0), client.ErrInvalidAmount)
+	bobCh, err := bob.Channel(ch.ID())
+	require.NoError(t, err)
+	_, err = bobCh.StopStream()
+	require.ErrorIs(t, err, client.ErrNoStream)
+}
+
+// slowPeer is an update policy that holds or rejects updates on demand.
+type slowPeer struct {
+	entered chan struct{} // entered receives a value for every held update.
+
+	mutex   sync.Mutex
+	held    chan struct{}
+	rejects bool
+}
+
+// hold holds updates until release is called with the returned channel.
+func (p *slowPeer) hold() chan struct{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.held = make(chan struct{})
+	return p.held
+}
+
+func (p *slowPeer) release(held chan struct{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.held = nil
+	close(held)
+}
+
+func (p *slowPeer) setReject(reject bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.rejects = reject
+}
+
+func (p *slowPeer) CheckUpdate(ctx context.Context, _ *client.Update) error {
+	p.mutex.Lock()
+	held, rejects := p.held, p.rejects
+	p.mutex.Unlock()
+	if rejects {
+		return client.Reject(client.ReasonPaymentLimit, "no more payments")
+	}
+	if held != nil {
+		p.entered <- struct{}{}
+		select {
+		case <-held:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// streamRecorder is an observer that records the status of payment streams.
+type streamRecorder struct {
+	test.Observer
+	mutex    sync.Mutex
+	statuses []client.StreamStatus
+}
+
+func (o *streamRecorder) UpdateStream(s client.StreamStatus) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.statuses = append(o.statuses, s)
+}
+
+// await waits until the latest status satisfies cond and returns it.
+func (o *streamRecorder) await(t *testing.T, cond func(client.StreamStatus) bool) client.StreamStatus {
+	t.Helper()
+	var last client.StreamStatus
+	require.Eventually(t, func() bool {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		if len(o.statuses) == 0 {
+			return false
+		}
+		last = o.statuses[len(o.statuses)-1]
+		return cond(last)
+	}, 5*time.Second, 10*time.Millisecond)
+	return last
+}
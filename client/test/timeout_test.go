@@ -0,0 +1,110 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/wire"
+	"perun.network/perun-cardano-demo/client"
+	"perun.network/perun-cardano-demo/client/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestOperationTimeout(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	timeouts := client.DefaultTimeouts()
+	timeouts.Update = 200 * time.Millisecond
+	alice := s.NewClient(t, test.Alice, bus, client.WithTimeouts(timeouts))
+	peer := &slowPeer{entered: make(chan struct{}, 8)}
+	s.NewClient(t, test.Bob, bus, client.WithUpdatePolicy(client.AllUpdates(client.ConsistentUpdates, peer)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+	ch, err := alice.OpenChannel(ctx, test.Bob.WireAddress(t), 10*client.Ada)
+	require.NoError(t, err)
+
+	// The update deadline applies although the caller's context has none.
+	hold := peer.hold()
+	start := time.Now()
+	err = alice.SendPayment(context.Background(), ch.ID(), client.Ada)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+	require.Less(t, int64(time.Since(start)), int64(5*time.Second))
+	<-peer.entered
+	peer.release(hold)
+	require.EqualValues(t, 0, ch.State().Version)
+
+	// The caller's context is respected as well. A failed update leaves the
+	// channel unusable, so another channel is used.
+	ch, err = alice.OpenChannel(ctx, test.Bob.WireAddress(t), 10*client.Ada)
+	require.NoError(t, err)
+	hold = peer.hold()
+	callerCtx, callerCancel := context.WithCancel(ctx)
+	sent := make(chan error, 1)
+	go func() { sent <- alice.SendPayment(callerCtx, ch.ID(), client.Ada) }()
+	select {
+	case <-peer.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("payment did not reach the peer")
+	}
+	callerCancel()
+	err = <-sent
+	require.Error(t, err)
+	require.Contains(t, err.Error(), context.Canceled.Error())
+	peer.release(hold)
+
+}
+
+func TestShutdownCancelsOperations(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	// Disabling the update timeout leaves the payment to the shutdown.
+	timeouts := client.DefaultTimeouts()
+	timeouts.Update = 0
+	alice := s.NewClient(t, test.Alice, bus, client.WithTimeouts(timeouts))
+	peer := &slowPeer{entered: make(chan struct{}, 8)}
+	s.NewClient(t, test.Bob, bus, client.WithUpdatePolicy(client.AllUpdates(client.ConsistentUpdates, peer)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycleTimeout)
+	defer cancel()
+	ch, err := alice.OpenChannel(ctx, test.Bob.WireAddress(t), 10*client.Ada)
+	require.NoError(t, err)
+
+	hold := peer.hold()
+	defer peer.release(hold)
+	sent := make(chan error, 1)
+	go func() { sent <- alice.SendPayment(context.Background(), ch.ID(), client.Ada) }()
+	<-peer.entered
+
+	// The payment keeps the shutdown from draining until its context ends.
+	shutdownCtx, shutdownCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer shutdownCancel()
+	summary := alice.GracefulShutdown(shutdownCtx, client.LeaveChannelsOpen)
+	require.False(t, summary.Drained)
+	select {
+	case err := <-sent:
+		require.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("payment not canceled by the shutdown")
+	}
+	require.ErrorIs(t, alice.SendPayment(ctx, ch.ID(), client.Ada), client.ErrShuttingDown)
+}
@@ -0,0 +1,231 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package test provides in-process fakes of the external services a
+// PaymentClient talks to, so that complete channel lifecycles can run in
+// `go test` without a Cardano node, cardano-wallet or PAB.
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"perun.network/perun-cardano-demo/cardanowallet"
+)
+
+// Wallet is a fake cardano-wallet server. It serves the wallet details, UTxO
+// statistics and transaction history of the wallets whose balance was set,
+// as well as the network information of an always synced node. Every
+// deposit and payout of the fake PAB appears as a transaction.
+type Wallet struct {
+	server *httptest.Server
+
+	mutex   sync.Mutex
+	wallets map[string]*fakeWallet
+	queries map[string]int // Number of requests per wallet ID.
+}
+
+type fakeWallet struct {
+	balance int64 // Lovelace.
+	assets  []cardanowallet.Asset
+	txs     []cardanowallet.Transaction
+}
+
+// NewWallet starts a fake cardano-wallet server. It must be closed using
+// Close.
+func NewWallet() *Wallet {
+	w := &Wallet{
+		wallets: make(map[string]*fakeWallet),
+		queries: make(map[string]int),
+	}
+	w.server = httptest.NewServer(http.HandlerFunc(w.serve))
+	return w
+}
+
+// URL returns the base URL of the wallet API as expected by
+// client.SetupPaymentClient.
+func (w *Wallet) URL() string {
+	return w.server.URL + "/v2"
+}
+
+// Close shuts down the server.
+func (w *Wallet) Close() {
+	w.server.Close()
+}
+
+// SetBalance sets the available balance of the given wallet in Lovelace.
+func (w *Wallet) SetBalance(walletID string, lovelace int64) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.wallet(walletID).balance = lovelace
+}
+
+// SetAssets sets the native tokens of the given wallet.
+func (w *Wallet) SetAssets(walletID string, assets ...cardanowallet.Asset) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.wallet(walletID).assets = assets
+}
+
+// Balance returns the available balance of the given wallet in Lovelace.
+func (w *Wallet) Balance(walletID string) int64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if fw, ok := w.wallets[walletID]; ok {
+		return fw.balance
+	}
+	return 0
+}
+
+// Queries returns the number of requests for the given wallet, including
+// requests for unknown wallets.
+func (w *Wallet) Queries(walletID string) int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.queries[walletID]
+}
+
+// credit adds amount to the balance of the given wallet and records the
+// transaction. Negative amounts are debited.
+func (w *Wallet) credit(walletID string, amount int64) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	fw := w.wallet(walletID)
+	fw.balance += amount
+	tx := cardanowallet.Transaction{
+		ID:        randomHex(32),
+		Amount:    lovelace(amount),
+		Fee:       lovelace(0),
+		Direction: cardanowallet.DirectionIncoming,
+		Status:    cardanowallet.TxInLedger,
+		InsertedAt: &cardanowallet.TimeReference{
+			Time: time.Now().UTC(),
+		},
+	}
+	if amount < 0 {
+		tx.Amount.Quantity = -amount
+		tx.Direction = cardanowallet.DirectionOutgoing
+	}
+	fw.txs = append(fw.txs, tx)
+}
+
+// wallet returns the wallet with the given ID, creating it if it is unknown.
+// Must be called with the mutex held.
+func (w *Wallet) wallet(id string) *fakeWallet {
+	fw, ok := w.wallets[id]
+	if !ok {
+		fw = &fakeWallet{}
+		w.wallets[id] = fw
+	}
+	return fw
+}
+
+func (w *Wallet) serve(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeWalletError(rw, http.StatusMethodNotAllowed, "method_not_allowed", "unsupported method: "+r.Method)
+		return
+	}
+	if r.URL.Path == "/v2/network/information" {
+		w.serveNetwork(rw)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/v2/wallets/"), "/", 2)
+	if !strings.HasPrefix(r.URL.Path, "/v2/wallets/") || parts[0] == "" {
+		writeWalletError(rw, http.StatusNotFound, cardanowallet.CodeNotFound, "unsupported request: "+r.URL.Path)
+		return
+	}
+
+	id := parts[0]
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.queries[id]++
+	fw, ok := w.wallets[id]
+	if !ok {
+		writeWalletError(rw, http.StatusNotFound, cardanowallet.CodeNoSuchWallet,
+			fmt.Sprintf("I couldn't find a wallet with the given id: %s", id))
+		return
+	}
+
+	switch sub := strings.Join(parts[1:], ""); sub {
+	case "":
+		writeJSON(rw, http.StatusOK, cardanowallet.Wallet{
+			ID:   id,
+			Name: id,
+			Balance: cardanowallet.Balance{
+				Available: lovelace(fw.balance),
+				Reward:    lovelace(0),
+				Total:     lovelace(fw.balance),
+			},
+			Assets: cardanowallet.Assets{Available: fw.assets, Total: fw.assets},
+			State:  cardanowallet.SyncProgress{Status: cardanowallet.SyncReady},
+		})
+	case "statistics/utxos":
+		// The fake wallet holds its balance in a single UTxO.
+		writeJSON(rw, http.StatusOK, cardanowallet.UTxOStatistics{
+			Total:        lovelace(fw.balance),
+			Scale:        "log10",
+			Distribution: map[string]uint64{utxoBucket(fw.balance): 1},
+		})
+	case "transactions":
+		txs := append([]cardanowallet.Transaction{}, fw.txs...)
+		if r.URL.Query().Get("order") != cardanowallet.OrderAscending {
+			for i, j := 0, len(txs)-1; i < j; i, j = i+1, j-1 {
+				txs[i], txs[j] = txs[j], txs[i]
+			}
+		}
+		writeJSON(rw, http.StatusOK, txs)
+	default:
+		writeWalletError(rw, http.StatusNotFound, cardanowallet.CodeNotFound, "unsupported request: "+r.URL.Path)
+	}
+}
+
+func (w *Wallet) serveNetwork(rw http.ResponseWriter) {
+	var info cardanowallet.NetworkInformation
+	info.SyncProgress.Status = cardanowallet.SyncReady
+	info.NodeTip.Time = time.Now().UTC()
+	info.NodeEra = "babbage"
+	info.NetworkInfo.NetworkID = "testnet"
+	info.WalletMode = "node"
+	writeJSON(rw, http.StatusOK, info)
+}
+
+// utxoBucket returns the log10 distribution bucket of the given amount.
+func utxoBucket(amount int64) string {
+	bound := int64(10)
+	for bound < amount && bound < 1e18 {
+		bound *= 10
+	}
+	return fmt.Sprint(bound)
+}
+
+func lovelace(q int64) cardanowallet.Quantity {
+	return cardanowallet.Quantity{Quantity: q, Unit: cardanowallet.UnitLovelace}
+}
+
+// writeWalletError writes an error in the format of cardano-wallet.
+func writeWalletError(rw http.ResponseWriter, status int, code, msg string) {
+	writeJSON(rw, status, cardanowallet.Error{Code: code, Message: msg})
+}
+
+// writeJSON writes v as JSON response with the given status code.
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(v)
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts bounds the duration of the client's operations. A zero duration
+// disables the respective timeout.
+type Timeouts struct {
+	Open    time.Duration // Open bounds proposing or accepting and funding a channel.
+	Update  time.Duration // Update bounds sending a payment.
+	Settle  time.Duration // Settle bounds finalizing, concluding and withdrawing.
+	Handle  time.Duration // Handle bounds answering incoming updates.
+	Query   time.Duration // Query bounds a balance query.
+	Request time.Duration // Request bounds waiting for the payment of a payment request.
+}
+
+// DefaultTimeouts returns timeouts that leave room for the slow chain index of
+// a local devnet.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Open:    5 * time.Minute,
+		Update:  30 * time.Second,
+		Settle:  5 * time.Minute,
+		Handle:  30 * time.Second,
+		Query:   10 * time.Second,
+		Request: 5 * time.Minute,
+	}
+}
+
+// Option configures a PaymentClient during setup.
+type Option func(*PaymentClient)
+
+// WithTimeouts sets the operation timeouts of the client.
+func WithTimeouts(t Timeouts) Option {
+	return func(c *PaymentClient) {
+		c.timeouts = t
+	}
+}
+
+// opContext derives the context of an operation from ctx. It is canceled when
+// the timeout expires, ctx is done or the client shuts down.
+func (c *PaymentClient) opContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	chtest "perun.network/go-perun/channel/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestOpContext(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	c, _ := newTestClient(chtest.NewRandomAsset(rng))
+
+	ctx, cancel := c.opContext(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, ok := ctx.Deadline()
+	require.True(t, ok)
+	<-ctx.Done()
+	require.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+
+	// A zero timeout disables the deadline, but not the caller's.
+	ctx, cancel = c.opContext(context.Background(), 0)
+	defer cancel()
+	_, ok = ctx.Deadline()
+	require.False(t, ok)
+	callerCtx, callerCancel := context.WithTimeout(context.Background(), time.Hour)
+	defer callerCancel()
+	withCaller, cancel := c.opContext(callerCtx, 0)
+	defer cancel()
+	deadline, _ := callerCtx.Deadline()
+	opDeadline, ok := withCaller.Deadline()
+	require.True(t, ok)
+	require.Equal(t, deadline, opDeadline)
+
+	// Shutting down the client, which cancels its context, cancels all
+	// operations.
+	c.cancel()
+	for _, ctx := range []context.Context{ctx, withCaller} {
+		select {
+		case <-ctx.Done():
+			require.ErrorIs(t, ctx.Err(), context.Canceled)
+		case <-time.After(time.Second):
+			t.Fatal("operation not canceled on shutdown")
+		}
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/wire"
+)
+
+// Update is an incoming channel update as presented to an UpdatePolicy.
+type Update struct {
+	Channel  *PaymentChannel // Channel is the updated channel, nil if unknown.
+	Peer     wire.Address    // Peer proposed the update, nil if unknown.
+	Current  *channel.State
+	Next     *channel.State
+	ActorIdx channel.Index
+	// Amount is the amount we receive with the update in Lovelace.
+	Amount *big.Int
+	// PendingPayments is the number of our outgoing payments in flight in
+	// the channel.
+	PendingPayments int
+	Received        time.Time
+	// Invoice is the ID of the invoice the peer pays with the update, if any.
+	// The invoice was checked and is reserved for the update.
+	Invoice string
+	// Memo is the memo the peer sent with the update, if any.
+	Memo string
+}
+
+// UpdatePolicy decides whether to accept an incoming channel update.
+// CheckUpdate returns nil to accept the update. Rejections should be returned
+// as RejectionError so that the peer learns the reason.
+type UpdatePolicy interface {
+	CheckUpdate(ctx context.Context, u *Update) error
+}
+
+// UpdateAuditor is notified about the outcome of every incoming update. err
+// is nil if the update was accepted. Update policies that track accepted
+// updates implement it as well.
+type UpdateAuditor interface {
+	AuditUpdate(u *Update, err error)
+}
+
+// UpdatePolicyFunc adapts a function to the UpdatePolicy interface.
+type UpdatePolicyFunc func(ctx context.Context, u *Update) error
+
+// CheckUpdate calls f.
+func (f UpdatePolicyFunc) CheckUpdate(ctx context.Context, u *Update) error {
+	return f(ctx, u)
+}
+
+// UpdateAuditFunc adapts a function to the UpdateAuditor interface.
+type UpdateAuditFunc func(u *Update, err error)
+
+// AuditUpdate calls f.
+func (f UpdateAuditFunc) AuditUpdate(u *Update, err error) {
+	f(u, err)
+}
+
+// WithUpdatePolicy sets the policy for incoming channel updates. By default,
+// ConsistentUpdates is used. The handler always rejects updates that decrease
+// our balance, independent of the policy.
+func WithUpdatePolicy(p UpdatePolicy) Option {
+	return func(c *PaymentClient) {
+		c.updatePolicy = p
+	}
+}
+
+// WithUpdateAuditor adds an auditor that is notified about the outcome of
+// every incoming update.
+func WithUpdateAuditor(a UpdateAuditor) Option {
+	return func(c *PaymentClient) {
+		c.updateAuditors = append(c.updateAuditors, a)
+	}
+}
+
+// updateChain is an UpdatePolicy that accepts an update if all its policies
+// accept it.
+type updateChain []UpdatePolicy
+
+// AllUpdates chains policies. An update is accepted if all policies accept it.
+// The policies are checked in order and the first rejection is returned.
+// Outcomes are forwarded to the policies implementing UpdateAuditor.
+func AllUpdates(policies ...UpdatePolicy) UpdatePolicy {
+	return updateChain(policies)
+}
+
+// CheckUpdate implements UpdatePolicy.
+func (c updateChain) CheckUpdate(ctx context.Context, u *Update) error {
+	for _, p := range c {
+		if err := p.CheckUpdate(ctx, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AuditUpdate implements UpdateAuditor.
+func (c updateChain) AuditUpdate(u *Update, err error) {
+	for _, p := range c {
+		if a, ok := p.(UpdateAuditor); ok {
+			a.AuditUpdate(u, err)
+		}
+	}
+}
+
+// ConsistentUpdates rejects updates that change the channel, its app, assets
+// or participants, lock funds or skip versions. Payment channels only ever
+// move balances between the two parties.
+var ConsistentUpdates UpdatePolicy = UpdatePolicyFunc(func(_ context.Context, u *Update) error {
+	cur, next := u.Current, u.Next
+	switch {
+	case next.ID != cur.ID:
+		return Reject(ReasonChannelChanged, "channel ID changed")
+	case next.Version != cur.Version+1:
+		return Reject(ReasonChannelChanged, "version %d does not follow %d", next.Version, cur.Version)
+	case !channel.IsNoApp(next.App) || !channel.IsNoApp(cur.App):
+		return Reject(ReasonChannelChanged, "unexpected app")
+	case len(next.Balances) != len(cur.Balances) || len(next.Locked) != 0:
+		return Reject(ReasonChannelChanged, "allocation structure changed")
+	}
+	if err := channel.AssertAssetsEqual(cur.Assets, next.Assets); err != nil {
+		return Reject(ReasonChannelChanged, "assets changed: %v", err)
+	}
+	for i := range next.Balances {
+		if len(next.Balances[i]) != len(cur.Balances[i]) {
+			return Reject(ReasonChannelChanged, "number of participants changed")
+		}
+	}
+	return nil
+})
+
+// PaymentLimits bounds the amount of a single incoming payment in Lovelace.
+// Zero values are not checked. Updates that transfer nothing, like
+// finalization, are not affected.
+type PaymentLimits struct {
+	Min int64
+	Max int64
+}
+
+// CheckUpdate implements UpdatePolicy.
+func (l PaymentLimits) CheckUpdate(_ context.Context, u *Update) error {
+	if u.Amount.Sign() == 0 {
+		return nil
+	}
+	if l.Min != 0 && u.Amount.Cmp(big.NewInt(l.Min)) < 0 {
+		return Reject(ReasonPaymentLimit, "payment of %v below minimum %d Lovelace", u.Amount, l.Min)
+	}
+	if l.Max != 0 && u.Amount.Cmp(big.NewInt(l.Max)) > 0 {
+		return Reject(ReasonPaymentLimit, "payment of %v above maximum %d Lovelace", u.Amount, l.Max)
+	}
+	return nil
+}
+
+// PeriodLimit bounds the total amount received within a sliding time window
+// over all channels of the client. Amounts are reserved when an update is
+// checked, so that concurrent updates cannot exceed the limit together, and
+// released again if the update is not accepted.
+type PeriodLimit struct {
+	max    *big.Int
+	period time.Duration
+
+	mutex    sync.Mutex
+	received []receipt // received are the reserved and accepted payments within the window, by time.
+}
+
+type receipt struct {
+	at     time.Time
+	amount *big.Int
+	update *Update // update is the update that reserved the amount.
+}
+
+// NewPeriodLimit returns a policy that rejects payments if the total
+// received within period would exceed max Lovelace.
+func NewPeriodLimit(max int64, period time.Duration) *PeriodLimit {
+	return &PeriodLimit{max: big.NewInt(max), period: period}
+}
+
+// CheckUpdate implements UpdatePolicy. The amount of an accepted update is
+// reserved until AuditUpdate reports the outcome.
+func (l *PeriodLimit) CheckUpdate(_ context.Context, u *Update) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	total := new(big.Int).Set(u.Amount)
+	for _, r := range l.receipts(u.Received) {
+		total.Add(total, r.amount)
+	}
+	if total.Cmp(l.max) > 0 {
+		return Reject(ReasonPeriodLimit, "would receive %v Lovelace within %v, maximum is %v", total, l.period, l.max)
+	}
+	if u.Amount.Sign() == 0 {
+		return nil
+	}
+	i := len(l.received)
+	for i > 0 && l.received[i-1].at.After(u.Received) {
+		i--
+	}
+	l.received = append(l.received, receipt{})
+	copy(l.received[i+1:], l.received[i:])
+	l.received[i] = receipt{at: u.Received, amount: new(big.Int).Set(u.Amount), update: u}
+	return nil
+}
+
+// AuditUpdate implements UpdateAuditor. It releases the amount reserved by a
+// rejected or failed update and keeps it for accepted ones.
+func (l *PeriodLimit) AuditUpdate(u *Update, err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for i, r := range l.received {
+		if r.update != u {
+			continue
+		}
+		if err != nil {
+			l.received = append(l.received[:i], l.received[i+1:]...)
+		} else {
+			l.received[i].update = nil
+		}
+		return
+	}
+}
+
+// receipts drops and returns the receipts within the window ending at now.
+func (l *PeriodLimit) receipts(now time.Time) []receipt {
+	start := now.Add(-l.period)
+	i := 0
+	for i < len(l.received) && !l.received[i].at.After(start) {
+		i++
+	}
+	l.received = l.received[i:]
+	return l.received
+}
+
+// RefuseFinalizeWhilePending rejects finalization requests while we have
+// outgoing payments in flight in the channel.
+var RefuseFinalizeWhilePending UpdatePolicy = UpdatePolicyFunc(func(_ context.Context, u *Update) error {
+	if u.Next.IsFinal && u.PendingPayments > 0 {
+		return Reject(ReasonPaymentsPending, "%d payments pending", u.PendingPayments)
+	}
+	return nil
+})
@@ -0,0 +1,169 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/channel"
+	channel2 "perun.network/perun-cardano-backend/channel"
+	"perun.network/perun-cardano-demo/client"
+)
+
+// makeUpdate returns an update of a two-party channel in which the peer at
+// index 0 sends amount Lovelace to us.
+func makeUpdate(amount int64) *client.Update {
+	cur := &channel.State{
+		ID:      channel.ID{1},
+		Version: 3,
+		App:     channel.NoApp(),
+		Allocation: channel.Allocation{
+			Assets:   []channel.Asset{channel2.Asset},
+			Balances: channel.Balances{{big.NewInt(100_000_000), big.NewInt(100_000_000)}},
+		},
+		Data: channel.NoData(),
+	}
+	next := cur.Clone()
+	next.Version++
+	next.Allocation.TransferBalance(0, 1, channel2.Asset, big.NewInt(amount))
+	return &client.Update{
+		Current:  cur,
+		Next:     next,
+		ActorIdx: 0,
+		Amount:   big.NewInt(amount),
+		Received: time.Unix(1_700_000_000, 0),
+	}
+}
+
+func requireRejected(t *testing.T, reason client.RejectReason, err error) {
+	t.Helper()
+	var rej *client.RejectionError
+	require.True(t, errors.As(err, &rej), "expected RejectionError, got %v", err)
+	require.Equal(t, reason, rej.Reason)
+}
+
+func TestConsistentUpdates(t *testing.T) {
+	ctx := context.Background()
+	require.NoError(t, client.ConsistentUpdates.CheckUpdate(ctx, makeUpdate(1)))
+
+	u := makeUpdate(1)
+	u.Next.Version += 2
+	requireRejected(t, client.ReasonChannelChanged, client.ConsistentUpdates.CheckUpdate(ctx, u))
+
+	u = makeUpdate(1)
+	u.Next.ID = channel.ID{2}
+	requireRejected(t, client.ReasonChannelChanged, client.ConsistentUpdates.CheckUpdate(ctx, u))
+
+	u = makeUpdate(1)
+	u.Next.Locked = []channel.SubAlloc{*channel.NewSubAlloc(channel.ID{3}, []channel.Bal{big.NewInt(1)}, nil)}
+	requireRejected(t, client.ReasonChannelChanged, client.ConsistentUpdates.CheckUpdate(ctx, u))
+}
+
+func TestPaymentLimits(t *testing.T) {
+	ctx := context.Background()
+	limits := client.PaymentLimits{Min: 10, Max: 100}
+	require.NoError(t, limits.CheckUpdate(ctx, makeUpdate(10)))
+	require.NoError(t, limits.CheckUpdate(ctx, makeUpdate(100)))
+	require.NoError(t, limits.CheckUpdate(ctx, makeUpdate(0)), "finalization is not a payment")
+	requireRejected(t, client.ReasonPaymentLimit, limits.CheckUpdate(ctx, makeUpdate(9)))
+	requireRejected(t, client.ReasonPaymentLimit, limits.CheckUpdate(ctx, makeUpdate(101)))
+}
+
+func TestPeriodLimit(t *testing.T) {
+	ctx := context.Background()
+	limit := client.NewPeriodLimit(100, time.Minute)
+	policy := client.AllUpdates(client.ConsistentUpdates, limit)
+	auditor := policy.(client.UpdateAuditor)
+
+	accept := func(u *client.Update) {
+		require.NoError(t, policy.CheckUpdate(ctx, u))
+		auditor.AuditUpdate(u, nil)
+	}
+	u := makeUpdate(60)
+	accept(u)
+
+	// A rejected update is not counted.
+	rejected := makeUpdate(30)
+	rejected.Received = u.Received.Add(time.Second)
+	auditor.AuditUpdate(rejected, client.Reject(client.ReasonPaymentLimit, "test"))
+
+	next := makeUpdate(40)
+	next.Received = u.Received.Add(30 * time.Second)
+	accept(next)
+
+	over := makeUpdate(1)
+	over.Received = u.Received.Add(59 * time.Second)
+	requireRejected(t, client.ReasonPeriodLimit, policy.CheckUpdate(ctx, over))
+
+	// The first payment leaves the window.
+	later := makeUpdate(60)
+	later.Received = u.Received.Add(61 * time.Second)
+	accept(later)
+}
+
+func TestPeriodLimitConcurrent(t *testing.T) {
+	ctx := context.Background()
+	limit := client.NewPeriodLimit(100, time.Minute)
+
+	// Updates in different channels are checked before their outcome is
+	// known. The second one would exceed the limit together with the first.
+	first, second := makeUpdate(60), makeUpdate(60)
+	require.NoError(t, limit.CheckUpdate(ctx, first))
+	requireRejected(t, client.ReasonPeriodLimit, limit.CheckUpdate(ctx, second))
+	limit.AuditUpdate(second, client.Reject(client.ReasonPeriodLimit, "test"))
+
+	// The reservation is released if the update is rejected later on, e.g.
+	// by another policy, or fails.
+	limit.AuditUpdate(first, client.Reject(client.ReasonPaymentLimit, "test"))
+	require.NoError(t, limit.CheckUpdate(ctx, second))
+	limit.AuditUpdate(second, nil)
+	third := makeUpdate(50)
+	requireRejected(t, client.ReasonPeriodLimit, limit.CheckUpdate(ctx, third))
+
+	// Concurrent checks never accept more than the limit.
+	limit = client.NewPeriodLimit(100, time.Minute)
+	var wg sync.WaitGroup
+	var accepted int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u := makeUpdate(10)
+			err := limit.CheckUpdate(ctx, u)
+			if err == nil {
+				atomic.AddInt32(&accepted, 1)
+			}
+			limit.AuditUpdate(u, err)
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, 10, accepted)
+}
+
+func TestRefuseFinalizeWhilePending(t *testing.T) {
+	ctx := context.Background()
+	u := makeUpdate(0)
+	u.Next.IsFinal = true
+	require.NoError(t, client.RefuseFinalizeWhilePending.CheckUpdate(ctx, u))
+	u.PendingPayments = 1
+	requireRejected(t, client.ReasonPaymentsPending, client.RefuseFinalizeWhilePending.CheckUpdate(ctx, u))
+}
@@ -0,0 +1,728 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command perun-cardano controls the payment clients of a running daemon
+// (mode: daemon) through its HTTP API.
+//
+// Usage:
+//
+//	perun-cardano <command> [flags]
+//
+// Commands:
+//
+//	open         open a channel (-peer, -deposit, -peer-deposit, -challenge)
+//	pay          send a payment (-channel, -amount, -memo, -invoice)
+//	batch        send several transfers in one update (-channel, -transfer, -finalize, -expect-version, -expect-own, -expect-peer)
+//	stream       start, stop or show a payment stream (-channel, -rate, -interval, -cap, -stop)
+//	settle       settle a channel (-channel)
+//	force-close  close a channel on-chain without the peer (-channel)
+//	channels     list the open channels
+//	balance      show the on-chain balance
+//	history      list the recorded payments (-channel, -direction, -start, -end, -csv)
+//	transactions list the wallet transactions (-start, -end, -order)
+//	invoice      create an invoice to be paid by a peer (-amount, -description, -expiry)
+//	invoices     list the invoices, or show one (-id)
+//	request      request a payment from the peer and wait for it (-channel, -amount, -description)
+//	requests     list the payment requests of peers awaiting a decision
+//	answer       pay or decline a payment request (-id, -decline, -reason)
+//
+// Every command accepts -api, the URL of the daemon, -client, the name of the
+// client to act as, and -json to print the API responses as JSON instead of
+// human-readable text. If -channel is omitted, the most recently opened
+// channel is used. If -client is omitted, the first client of the daemon is
+// used.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"perun.network/perun-cardano-demo/api"
+	"perun.network/perun-cardano-demo/cardanowallet"
+	"perun.network/perun-cardano-demo/client"
+)
+
+// Environment variables that set the defaults of -api and -client.
+const (
+	envAPI    = "PERUN_CARDANO_API"
+	envClient = "PERUN_CARDANO_CLIENT"
+)
+
+const defaultAPI = "http://127.0.0.1:8080"
+
+// command is a subcommand of the CLI.
+type command struct {
+	name  string
+	usage string
+	// flags registers the flags of the command on fs and returns the function
+	// that runs it.
+	flags func(fs *flag.FlagSet) func(ctx context.Context, e *env) error
+}
+
+var commands = []command{
+	{"open", "open a channel with a peer", openCmd},
+	{"pay", "send a payment in a channel", payCmd},
+	{"batch", "send several transfers in one channel update", batchCmd},
+	{"stream", "start, stop or show a payment stream", streamCmd},
+	{"settle", "settle a channel", settleCmd},
+	{"force-close", "close a channel on-chain without the peer", forceCloseCmd},
+	{"channels", "list the open channels", channelsCmd},
+	{"balance", "show the on-chain balance", balanceCmd},
+	{"history", "list the recorded payments", historyCmd},
+	{"transactions", "list the wallet transactions", transactionsCmd},
+	{"invoice", "create an invoice to be paid by a peer", invoiceCmd},
+	{"invoices", "list the invoices", invoicesCmd},
+	{"request", "request a payment from the peer of a channel", requestCmd},
+	{"requests", "list the payment requests awaiting a decision", requestsCmd},
+	{"answer", "pay or decline a payment request", answerCmd},
+}
+
+// env is the environment a command runs in.
+type env struct {
+	api    *api.Client
+	client string // client is the name of the client to act as.
+	json   bool   // json selects JSON output.
+	out    io.Writer
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command given by args and returns the exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		usage(stderr)
+		return 2
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+		usage(stderr)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("perun-cardano "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	apiURL := fs.String("api", envOr(envAPI, defaultAPI), "URL of the daemon's HTTP API (env "+envAPI+")")
+	name := fs.String("client", os.Getenv(envClient), "name of the client to act as, the first one if empty (env "+envClient+")")
+	jsonOut := fs.Bool("json", false, "print JSON instead of human-readable text")
+	exec := cmd.flags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "unexpected arguments: %v\n", fs.Args())
+		return 2
+	}
+
+	c, err := api.NewClient(*apiURL)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	e := &env{api: c, client: *name, json: *jsonOut, out: stdout}
+	err = e.resolveClient(ctx)
+	if err == nil {
+		err = exec(ctx, e)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: perun-cardano <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "perun-cardano <command> -h" for the flags of a command.`)
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// resolveClient selects the first client of the daemon if none was given.
+func (e *env) resolveClient(ctx context.Context) error {
+	if e.client != "" {
+		return nil
+	}
+	clients, err := e.api.Clients(ctx)
+	if err != nil {
+		return err
+	}
+	if len(clients) == 0 {
+		return errors.New("the daemon hosts no clients")
+	}
+	e.client = clients[0].Name
+	return nil
+}
+
+// resolveChannel returns id or, if it is empty, the ID of the most recently
+// opened channel.
+func (e *env) resolveChannel(ctx context.Context, id string) (string, error) {
+	if id != "" {
+		return id, nil
+	}
+	chs, err := e.api.Channels(ctx, e.client)
+	if err != nil {
+		return "", err
+	}
+	if len(chs) == 0 {
+		return "", fmt.Errorf("%s has no open channel", e.client)
+	}
+	return chs[len(chs)-1].ID, nil
+}
+
+// print prints v as JSON if requested and calls text otherwise.
+func (e *env) print(v interface{}, text func(w io.Writer)) error {
+	if !e.json {
+		text(e.out)
+		return nil
+	}
+	enc := json.NewEncoder(e.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func openCmd(fs *flag.FlagSet) func(context.Context, *env) error {
+	peer := fs.String("peer", "", "name or hex-encoded public key of the peer")
+	deposit := amountFlag(fs, "deposit", "our deposit, e.g. 10 or \"5000000 lovelace\"")
+	peerDeposit := amountFlag(fs, "peer-deposit", "deposit of the peer, our deposit if omitted")
+	challenge := fs.Uint64("challenge", 0, "challenge duration in seconds, the daemon default if zero")
+	return func(ctx context.Context, e *env) error {
+		if *peer == "" || deposit.Amount == nil {
+			return errors.New("-peer and -deposit are required")
+		}
+		req := api.OpenChannelRequest{
+			Peer:              *peer,
+			Amount:            *deposit.Amount,
+			PeerAmount:        peerDeposit.Amount,
+			ChallengeDuration: *challenge,
+		}
+		ch, err := e.api.OpenChannel(ctx, e.client, req)
+		if err != nil {
+			return err
+		}
+		return e.print(ch, func(w io.Writer) {
+			fmt.Fprintln(w, "Opened channel", ch.ID)
+			printChannel(w, ch)
+		})
+	}
+}
+
+func payCmd(fs *flag.FlagSet) func(context.Context, *env) error {
+	id := fs.String("channel", "", "hex-encoded channel ID")
+	amount := amountFlag(fs, "amount", "amount to send, e.g. 1.5 or \"1000 lovelace\"")
+	memo := fs.String("memo", "", "note sent to the peer and recorded with the payment")
+	invoice := fs.String("invoice", "", "ID of the peer's invoice to pay")
+	return func(ctx context.Context, e *env) error {
+		if amount.Amount == nil {
+			return errors.New("-amount is required")
+		}
+		id, err := e.resolveChannel(ctx, *id)
+		if err != nil {
+			return err
+		}
+		ch, err := e.api.SendPayment(ctx, e.client, id, api.PaymentRequest{Amount: *amount.Amount, Memo: *memo, Invoice: *invoice})
+		if err != nil {
+			return err
+		}
+		return e.print(ch, func(w io.Writer) {
+			fmt.Fprintf(w, "Sent %s in channel %s\n", amount.Amount, ch.ID)
+			printChannel(w, ch)
+		})
+	}
+}
+
+func batchCmd(fs *flag.FlagSet) func(context.Context, *env) error {
+	id := fs.String("channel", "", "hex-encoded channel ID")
+	var transfers transferList
+	fs.Var(&transfers, "transfer", "transfer as amount[:memo], e.g. \"1.5:tea\", repeatable")
+	finalize := fs.Bool("finalize", false, "finalize the channel in the same update")
+	version := fs.Int64("expect-version", -1, "only send if the channel is at this version")
+	own := amountFlag(fs, "expect-own", "only send if our balance is this amount, requires -expect-version")
+	peer := amountFlag(fs, "expect-peer", "only send if the peer's balance is this amount, requires -expect-version")
+	return func(ctx context.Context, e *env) error {
+		req := api.BatchRequest{Transfers: transfers, Finalize: *finalize}
+		if len(req.Transfers) == 0 && !req.Finalize {
+			return errors.New("-transfer or -finalize is required")
+		}
+		switch {
+		case *version >= 0 && own.Amount != nil && peer.Amount != nil:
+			req.Expect = &api.ExpectationRequest{Version: uint64(*version), OwnBalance: *own.Amount, PeerBalance: *peer.Amount}
+		case *version >= 0 || own.Amount != nil || peer.Amount != nil:
+			return errors.New("-expect-version, -expect-own and -expect-peer must be given together")
+		}
+		id, err := e.resolveChannel(ctx, *id)
+		if err != nil {
+			return err
+		}
+		ch, err := e.api.SendBatch(ctx, e.client, id, req)
+		if err != nil {
+			return err
+		}
+		return e.print(ch, func(w io.Writer) {
+			fmt.Fprintf(w, "Sent %d transfer(s) in channel %s\n", len(req.Transfers), ch.ID)
+			printChannel(w, ch)
+		})
+	}
+}
+
+func streamCmd(fs *flag.FlagSet) func(context.Context, *env) error {
+	id := fs.String("channel", "", "hex-encoded channel ID")
+	rate := amountFlag(fs, "rate", "amount to pay per interval, starts a stream, e.g. 0.1 or \"1000 lovelace\"")
+	interval := fs.Duration("interval", time.Second, "interval between two payments")
+	limit := amountFlag(fs, "cap", "total amount of the stream, unlimited if omitted")
+	stop := fs.Bool("stop", false, "stop the stream")
+	return func(ctx context.Context, e *env) error {
+		id, err := e.resolveChannel(ctx, *id)
+		if err != nil {
+			return err
+		}
+		var st api.StreamInfo
+		switch {
+		case *stop:
+			st, err = e.api.StopStream(ctx, e.client, id)
+		case rate.Amount != nil:
+			req := api.StartStreamRequest{Rate: *rate.Amount, IntervalMS: uint64(*interval / time.Millisecond)}
+			if limit.Amount != nil {
+				req.Cap = *limit.Amount
+			}
+			st, err = e.api.StartStream(ctx, e.client, id, req)
+		default:
+			st, err = e.api.Stream(ctx, e.client, id)
+		}
+		if err != nil {
+			return err
+		}
+		return e.print(st, func(w io.Writer) {
+			fmt.Fprintf(w, "Stream in channel %s %s\n", st.ChannelID, strings.ReplaceAll(st.State, "_", " "))
+			fmt.Fprintf(w, "  Rate:       %s every %v\n", st.Rate, time.Duration(st.IntervalMS)*time.Millisecond)
+			if st.Cap != 0 {
+				fmt.Fprintf(w, "  Cap:        %s\n", st.Cap)
+			}
+			fmt.Fprintf(w, "  Paid:       %s in %d payment(s)\n", st.Paid, st.Payments)
+			fmt.Fprintf(w, "  Throughput: %s/s\n", st.Throughput)
+			if st.Error != "" {
+				fmt.Fprintf(w, "  Error:      %s\n", st.Error)
+			}
+		})
+	}
+}
+
+func settleCmd(fs *flag.FlagSet) func(context.Context, *env) error {
+	return closeCmd(fs, "Settled", (*api.Client).Settle)
+}
+
+func forceCloseCmd(fs *flag.FlagSet) func(context.Context, *env) error {
+	return closeCmd(fs, "Force-closed", (*api.Client).ForceClose)
+}
+
+// closeCmd returns a command that closes a channel with the given API call.
+func closeCmd(fs *flag.FlagSet, verb string, close func(*api.Client, context.Context, string, string) (api.ChannelInfo, error)) func(context.Context, *env) error {
+	id := fs.String("channel", "", "hex-encoded channel ID")
+	return func(ctx context.Context, e *env) error {
+		id, err := e.resolveChannel(ctx, *id)
+		if err != nil {
+			return err
+		}
+		ch, err := close(e.api, ctx, e.client, id)
+		if err != nil {
+			return err
+		}
+		return e.print(ch, func(w io.Writer) {
+			fmt.Fprintln(w, verb, "channel", ch.ID)
+			printChannel(w, ch)
+		})
+	}
+}
+
+func channelsCmd(*flag.FlagSet) func(context.Context, *env) error {
+	return func(ctx context.Context, e *env) error {
+		chs, err := e.api.Channels(ctx, e.client)
+		if err != nil {
+			return err
+		}
+		return e.print(chs, func(w io.Writer) {
+			if len(chs) == 0 {
+				fmt.Fprintln(w, "No open channels")
+				return
+			}
+			for i, ch := range chs {
+				if i > 0 {
+					fmt.Fprintln(w)
+				}
+				fmt.Fprintln(w, "Channel", ch.ID)
+				printChannel(w, ch)
+			}
+		})
+	}
+}
+
+func balanceCmd(*flag.FlagSet) func(context.Context, *env) error {
+	return func(ctx context.Context, e *env) error {
+		bal, err := e.api.Balance(ctx, e.client)
+		if err != nil {
+			return err
+		}
+		return e.print(bal, func(w io.Writer) {
+			fmt.Fprintf(w, "%s: %s ADA\n", e.client, bal.Ada)
+		})
+	}
+}
+
+func historyCmd(fs *flag.FlagSet) func(context.Context, *env) error {
+	id := fs.String("channel", "", "hex-encoded channel ID, all channels if empty")
+	direction := fs.String("direction", "", "sent or received, both if empty")
+	start := timeFlag(fs, "start", "earliest time of a payment (RFC 3339)")
+	end := timeFlag(fs, "end", "latest time of a payment (RFC 3339)")
+	csvOut := fs.Bool("csv", false, "print CSV for accounting")
+	return func(ctx context.Context, e *env) error {
+		f := client.PaymentFilter{
+			Direction: client.PaymentDirection(*direction),
+			Start:     start.Time,
+			End:       end.Time,
+		}
+		if *id != "" {
+			chID, err := client.ParseChannelID(*id)
+			if err != nil {
+				return err
+			}
+			f.ChannelID = chID
+		}
+		payments, err := e.api.Payments(ctx, e.client, f)
+		if err != nil {
+			return err
+		}
+		if *csvOut {
+			return client.WritePaymentsCSV(e.out, payments)
+		}
+		return e.print(payments, func(w io.Writer) {
+			if len(payments) == 0 {
+				fmt.Fprintln(w, "No payments")
+				return
+			}
+			for _, p := range payments {
+				fmt.Fprintf(w, "%s  %-8s %16s  channel %x  version %d",
+					p.Time.Local().Format(time.RFC3339),
+					p.Direction,
+					p.Amount,
+					p.ChannelID,
+					p.Version,
+				)
+				if p.Memo != "" {
+					fmt.Fprintf(w, "  %q", p.Memo)
+				}
+				if p.Invoice != "" {
+					fmt.Fprintf(w, "  invoice %s", p.Invoice)
+				}
+				fmt.Fprintln(w)
+			}
+		})
+	}
+}
+
+func transactionsCmd(fs *flag.FlagSet) func(context.Context, *env) error {
+	start := timeFlag(fs, "start", "earliest time of a transaction (RFC 3339)")
+	end := timeFlag(fs, "end", "latest time of a transaction (RFC 3339)")
+	order := fs.String("order", cardanowallet.OrderDescending, "ascending or descending")
+	return func(ctx context.Context, e *env) error {
+		q := cardanowallet.TransactionQuery{Start: start.Time, End: end.Time, Order: *order}
+		txs, err := e.api.Transactions(ctx, e.client, q)
+		if err != nil {
+			return err
+		}
+		return e.print(txs, func(w io.Writer) {
+			if len(txs) == 0 {
+				fmt.Fprintln(w, "No transactions")
+				return
+			}
+			for _, tx := range txs {
+				fmt.Fprintf(w, "%s  %-8s %16s ADA  fee %s ADA  %-9s %s\n",
+					tx.Time().Local().Format(time.RFC3339),
+					tx.Direction,
+					client.FormatBalance(client.Amount(tx.Amount.Quantity)),
+					client.FormatBalance(client.Amount(tx.Fee.Quantity)),
+					tx.Status,
+					tx.ID,
+				)
+			}
+		})
+	}
+}
+
+func invoiceCmd(fs *flag.FlagSet) func(context.Context, *env) error {
+	amount := amountFlag(fs, "amount", "amount to be paid, e.g. 1.5 or \"1000 lovelace\"")
+	description := fs.String("description", "", "description of the invoice, e.g. the order number")
+	expiry := fs.Duration("expiry", 0, "time after which the invoice expires, never if zero")
+	return func(ctx context.Context, e *env) error {
+		if amount.Amount == nil {
+			return errors.New("-amount is required")
+		}
+		req := api.CreateInvoiceRequest{
+			Amount:      *amount.Amount,
+			Description: *description,
+			Expiry:      uint64(expiry.Seconds()),
+		}
+		inv, err := e.api.CreateInvoice(ctx, e.client, req)
+		if err != nil {
+			return err
+		}
+		return e.print(inv, func(w io.Writer) {
+			fmt.Fprintln(w, "Created invoice", inv.ID)
+			printInvoice(w, inv)
+		})
+	}
+}
+
+func invoicesCmd(fs *flag.FlagSet) func(context.Context, *env) error {
+	id := fs.String("id", "", "ID of the invoice to show, all invoices if empty")
+	return func(ctx context.Context, e *env) error {
+		if *id != "" {
+			inv, err := e.api.Invoice(ctx, e.client, *id)
+			if err != nil {
+				return err
+			}
+			return e.print(inv, func(w io.Writer) {
+				fmt.Fprintln(w, "Invoice", inv.ID)
+				printInvoice(w, inv)
+			})
+		}
+		invs, err := e.api.Invoices(ctx, e.client)
+		if err != nil {
+			return err
+		}
+		return e.print(invs, func(w io.Writer) {
+			if len(invs) == 0 {
+				fmt.Fprintln(w, "No invoices")
+				return
+			}
+			for _, inv := range invs {
+				fmt.Fprintf(w, "%s  %-7s %16s  %s\n", inv.ID, inv.Status, inv.Amount, inv.Description)
+			}
+		})
+	}
+}
+
+func requestCmd(fs *flag.FlagSet) func(context.Context, *env) error {
+	id := fs.String("channel", "", "hex-encoded channel ID")
+	amount := amountFlag(fs, "amount", "amount to request, e.g. 1.5 or \"1000 lovelace\"")
+	description := fs.String("description", "", "description of the request, recorded as memo of the payment")
+	return func(ctx context.Context, e *env) error {
+		if amount.Amount == nil {
+			return errors.New("-amount is required")
+		}
+		id, err := e.resolveChannel(ctx, *id)
+		if err != nil {
+			return err
+		}
+		inv, err := e.api.RequestPayment(ctx, e.client, id, api.RequestPaymentRequest{Amount: *amount.Amount, Description: *description})
+		if err != nil {
+			return err
+		}
+		return e.print(inv, func(w io.Writer) {
+			fmt.Fprintf(w, "Received %s for invoice %s\n", inv.Amount, inv.ID)
+			printInvoice(w, inv)
+		})
+	}
+}
+
+func requestsCmd(*flag.FlagSet) func(context.Context, *env) error {
+	return func(ctx context.Context, e *env) error {
+		reqs, err := e.api.PendingRequests(ctx, e.client)
+		if err != nil {
+			return err
+		}
+		return e.print(reqs, func(w io.Writer) {
+			if len(reqs) == 0 {
+				fmt.Fprintln(w, "No pending requests")
+				return
+			}
+			for _, r := range reqs {
+				fmt.Fprintf(w, "%s  %16s  channel %s  %s\n", r.ID, r.Amount, r.ChannelID, r.Description)
+			}
+		})
+	}
+}
+
+func answerCmd(fs *flag.FlagSet) func(context.Context, *env) error {
+	id := fs.String("id", "", "ID of the payment request")
+	decline := fs.Bool("decline", false, "decline the request instead of paying it")
+	reason := fs.String("reason", "", "reason sent to the peer if the request is declined")
+	return func(ctx context.Context, e *env) error {
+		if *id == "" {
+			return errors.New("-id is required")
+		}
+		if err := e.api.DecideRequest(ctx, e.client, *id, api.DecisionRequest{Accept: !*decline, Reason: *reason}); err != nil {
+			return err
+		}
+		verb := "Paid"
+		if *decline {
+			verb = "Declined"
+		}
+		return e.print(struct {
+			ID   string `json:"id"`
+			Paid bool   `json:"paid"`
+		}{*id, !*decline}, func(w io.Writer) {
+			fmt.Fprintln(w, verb, "request", *id)
+		})
+	}
+}
+
+// printInvoice prints the details of inv.
+func printInvoice(w io.Writer, inv api.InvoiceInfo) {
+	fmt.Fprintf(w, "  Amount:      %s\n", inv.Amount)
+	if inv.Description != "" {
+		fmt.Fprintf(w, "  Description: %s\n", inv.Description)
+	}
+	fmt.Fprintf(w, "  Status:      %s\n", inv.Status)
+	if inv.Expires != nil {
+		fmt.Fprintf(w, "  Expires:     %s\n", inv.Expires.Local().Format(time.RFC3339))
+	}
+	if inv.Paid != nil {
+		fmt.Fprintf(w, "  Paid:        %s in channel %s, version %d\n", inv.Paid.Local().Format(time.RFC3339), inv.ChannelID, inv.Version)
+	}
+}
+
+// printChannel prints the balances, version and phase of ch.
+func printChannel(w io.Writer, ch api.ChannelInfo) {
+	for i, p := range ch.Parties {
+		who := "peer"
+		if i == ch.Idx {
+			who = "own "
+		}
+		bal := ch.Balances[i]
+		if a, err := client.ParseAmount(bal + " lovelace"); err == nil {
+			bal = a.String()
+		}
+		fmt.Fprintf(w, "  %s %s: %s\n", who, p, bal)
+	}
+	fmt.Fprintf(w, "  version %d, %s", ch.Version, ch.Phase)
+	if ch.IsFinal {
+		fmt.Fprint(w, ", final")
+	}
+	fmt.Fprintln(w)
+}
+
+// amountValue is a flag.Value for amounts accepted by client.ParseAmount. It
+// is nil until the flag is set.
+type amountValue struct {
+	Amount *client.Amount
+}
+
+func amountFlag(fs *flag.FlagSet, name, usage string) *amountValue {
+	v := new(amountValue)
+	fs.Var(v, name, usage)
+	return v
+}
+
+func (v *amountValue) String() string {
+	if v == nil || v.Amount == nil {
+		return ""
+	}
+	return v.Amount.String()
+}
+
+func (v *amountValue) Set(s string) error {
+	a, err := client.ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	v.Amount = &a
+	return nil
+}
+
+// transferList is a repeatable flag.Value for transfers given as
+// amount[:memo].
+type transferList []api.TransferRequest
+
+func (l *transferList) String() string {
+	if l == nil {
+		return ""
+	}
+	ts := make([]string, len(*l))
+	for i, t := range *l {
+		ts[i] = t.Amount.String()
+		if t.Memo != "" {
+			ts[i] += ":" + t.Memo
+		}
+	}
+	return strings.Join(ts, ", ")
+}
+
+func (l *transferList) Set(s string) error {
+	amount, memo := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		amount, memo = s[:i], s[i+1:]
+	}
+	a, err := client.ParseAmount(amount)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, api.TransferRequest{Amount: a, Memo: memo})
+	return nil
+}
+
+// timeValue is a flag.Value for RFC 3339 times.
+type timeValue struct {
+	time.Time
+}
+
+func timeFlag(fs *flag.FlagSet, name, usage string) *timeValue {
+	v := new(timeValue)
+	fs.Var(v, name, usage)
+	return v
+}
+
+func (v *timeValue) String() string {
+	if v == nil || v.IsZero() {
+		return ""
+	}
+	return v.Format(time.RFC3339)
+}
+
+func (v *timeValue) Set(s string) error {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return err
+	}
+	v.Time = t
+	return nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/go-perun/wire"
+	"perun.network/perun-cardano-demo/api"
+	"perun.network/perun-cardano-demo/client"
+	"perun.network/perun-cardano-demo/client/test"
+	pkgtest "polycry.pt/poly-go/test"
+)
+
+func TestRun(t *testing.T) {
+	rng := pkgtest.Prng(t)
+	s := test.NewSetup(t, rng, test.Alice, test.Bob)
+	bus := wire.NewLocalBus()
+	alice := s.NewClient(t, test.Alice, bus, client.WithRequestPolicy(client.AskUserRequests(0)))
+	// Bob accepts unequal deposits of up to 10 Ada.
+	bob := s.NewClient(t, test.Bob, bus, client.WithProposalPolicy(client.FundingLimits{MaxOwnDeposit: (10 * client.Ada).Lovelace()}))
+	srv := httptest.NewServer(api.NewServer([]*client.PaymentClient{alice, bob}, nil))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	exec := func(args ...string) (string, int) {
+		var stdout, stderr bytes.Buffer
+		code := run(ctx, append(args, "-api", srv.URL), &stdout, &stderr)
+		return stdout.String() + stderr.String(), code
+	}
+
+	// The first client is used by default.
+	out, code := exec("open", "-peer", test.Bob.Name, "-deposit", "10", "-peer-deposit", "5000000 lovelace")
+	require.Zero(t, code, out)
+	require.Contains(t, out, "Opened channel")
+	require.Contains(t, out, "own  "+alice.DisplayAddress()+": 10 ADA")
+	require.Contains(t, out, "peer "+bob.DisplayAddress()+": 5 ADA")
+
+	// The latest channel is used by default.
+	out, code = exec("pay", "-amount", "2.5", "-json")
+	require.Zero(t, code, out)
+	var ch api.ChannelInfo
+	require.NoError(t, json.Unmarshal([]byte(out), &ch))
+	require.EqualValues(t, 1, ch.Version)
+	require.Equal(t, []string{"7500000", "7500000"}, ch.Balances)
+
+	out, code = exec("history", "-csv")
+	require.Zero(t, code, out)
+	require.Contains(t, out, ",1,sent,2.5,2500000,"+alice.DisplayAddress()+",,\n")
+
+	out, code = exec("channels", "-client", test.Bob.Name)
+	require.Zero(t, code, out)
+	require.Contains(t, out, "Channel "+ch.ID)
+	require.Contains(t, out, "version 1, open")
+
+	// Bob invoices Alice, who pays the invoice.
+	out, code = exec("invoice", "-client", test.Bob.Name, "-amount", "1", "-description", "order 42", "-expiry", "1h", "-json")
+	require.Zero(t, code, out)
+	var inv api.InvoiceInfo
+	require.NoError(t, json.Unmarshal([]byte(out), &inv))
+	require.Equal(t, "open", inv.Status)
+	out, code = exec("pay", "-amount", "1", "-invoice", inv.ID)
+	require.Zero(t, code, out)
+	require.Eventually(t, func() bool {
+		out, code := exec("invoices", "-client", test.Bob.Name, "-id", inv.ID)
+		return code == 0 && bytes.Contains([]byte(out), []byte("Status:      paid"))
+	}, 5*time.Second, 10*time.Millisecond)
+	out, code = exec("invoices", "-client", test.Bob.Name)
+	require.Zero(t, code, out)
+	require.Contains(t, out, inv.ID+"  paid")
+
+	// Bob requests a payment, which Alice declines.
+	requested := make(chan string, 1)
+	go func() {
+		out, code := exec("request", "-client", test.Bob.Name, "-amount", "3", "-description", "minutes 1-3")
+		requested <- fmt.Sprint(code, " ", out)
+	}()
+	var reqs []api.PendingRequestInfo
+	require.Eventually(t, func() bool {
+		out, code := exec("requests", "-json")
+		return code == 0 && json.Unmarshal([]byte(out), &reqs) == nil && len(reqs) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	out, code = exec("requests")
+	require.Zero(t, code, out)
+	require.Contains(t, out, reqs[0].ID+"  ")
+	require.Contains(t, out, "minutes 1-3")
+	out, code = exec("answer", "-id", reqs[0].ID, "-decline", "-reason", "not now")
+	require.Zero(t, code, out)
+	require.Equal(t, "Declined request "+reqs[0].ID+"\n", out)
+	out = <-requested
+	require.True(t, strings.HasPrefix(out, "1 "), out)
+	require.Contains(t, out, "user_declined")
+	_, code = exec("answer")
+	require.Equal(t, 1, code) // -id is required.
+
+	// Alice streams two payments to Bob.
+	out, code = exec("stream", "-rate", "0.1", "-interval", "100ms", "-cap", "0.2")
+	require.Zero(t, code, out)
+	require.Contains(t, out, "Rate:       0.1 ADA every 100ms")
+	require.Eventually(t, func() bool {
+		out, code := exec("stream")
+		return code == 0 && strings.Contains(out, " cap reached\n")
+	}, 5*time.Second, 10*time.Millisecond)
+	out, code = exec("stream", "-stop")
+	require.Zero(t, code, out)
+	require.Contains(t, out, "Paid:       0.2 ADA in 2 payment(s)")
+
+	// Alice sends two transfers in a single update, then a conditional
+	// batch against a stale version conflicts.
+	out, code = exec("batch", "-transfer", "0.5:tea", "-transfer", "0.5")
+	require.Zero(t, code, out)
+	require.Contains(t, out, "Sent 2 transfer(s) in channel "+ch.ID)
+	out, code = exec("batch", "-transfer", "0.5", "-expect-version", "0", "-expect-own", "1", "-expect-peer", "1")
+	require.Equal(t, 1, code)
+	require.Contains(t, out, "expected version 0")
+	_, code = exec("batch", "-transfer", "0.5", "-expect-version", "0")
+	require.Equal(t, 1, code) // all expectations are required.
+
+	out, code = exec("pay", "-amount", "100")
+	require.Equal(t, 1, code)
+	require.Contains(t, out, "Error:")
+
+	out, code = exec("settle", "-channel", ch.ID)
+	require.Zero(t, code, out)
+	require.Contains(t, out, "Settled channel "+ch.ID)
+	require.Contains(t, out, "final")
+
+	out, code = exec("channels")
+	require.Zero(t, code, out)
+	require.Equal(t, "No open channels\n", out)
+
+	out, code = exec("balance")
+	require.Zero(t, code, out)
+	require.Contains(t, out, "Alice: ")
+
+	_, code = exec("pay")
+	require.Equal(t, 1, code) // -amount is required.
+	_, code = exec("teleport")
+	require.Equal(t, 2, code)
+}
@@ -0,0 +1,292 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config describes the endpoints and parties of a payment channel
+// demo setup. A Config is assembled from defaults, an optional YAML file,
+// environment variables and command-line flags (in increasing precedence) and
+// is validated before any client is set up.
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete configuration of a demo run.
+type Config struct {
+	// PABHost is the host:port of the Plutus Application Backend.
+	PABHost string `yaml:"pab_host"`
+	// WalletServerURL is the base URL of the cardano-wallet v2 API.
+	WalletServerURL string `yaml:"wallet_server_url"`
+	// RemoteWalletURL is the URL of the perun-cardano-wallet signing server.
+	RemoteWalletURL string `yaml:"remote_wallet_url"`
+	// LogFile is the file the demo writes its log to. LogStderr writes the
+	// log to stderr instead, which is only allowed in daemon mode.
+	LogFile string `yaml:"log_file"`
+	// Log configures the level, format and rotation of the log.
+	Log Log `yaml:"log"`
+	// DataDir is the directory the parties persist their channels and
+	// payment ledgers in, one database and ledger per party. Persistence is
+	// disabled if it is empty.
+	DataDir string `yaml:"data_dir"`
+	// Mode selects the front-end, either ModeTUI or ModeDaemon.
+	Mode string `yaml:"mode"`
+	// API configures the HTTP API served in daemon mode.
+	API API `yaml:"api"`
+	// Parties are the payment clients set up by the demo.
+	Parties []Party `yaml:"parties"`
+	// Network configures the off-chain communication between parties.
+	Network Network `yaml:"network"`
+	// Timeouts bounds the duration of channel operations.
+	Timeouts Timeouts `yaml:"timeouts"`
+	// Balance configures how the parties' on-chain balances are watched.
+	Balance Balance `yaml:"balance"`
+	// ChallengeDuration is the challenge duration in seconds of the channels
+	// the parties propose. Zero selects the client default.
+	ChallengeDuration uint64 `yaml:"challenge_duration"`
+	// Peers is the address book of remote parties in tcp mode.
+	Peers []Peer `yaml:"peers"`
+	// ProposalPolicy restricts the channel proposals the parties accept.
+	ProposalPolicy ProposalPolicy `yaml:"proposal_policy"`
+	// UpdatePolicy restricts the channel updates the parties accept.
+	UpdatePolicy UpdatePolicy `yaml:"update_policy"`
+	// RequestPolicy decides which payment requests the parties pay.
+	RequestPolicy RequestPolicy `yaml:"request_policy"`
+	// Shutdown configures how the parties shut down when the demo is stopped.
+	Shutdown Shutdown `yaml:"shutdown"`
+}
+
+const (
+	// ModeTUI runs the interactive terminal UI.
+	ModeTUI = "tui"
+	// ModeDaemon runs headless and serves the HTTP API.
+	ModeDaemon = "daemon"
+)
+
+// API configures the HTTP API.
+type API struct {
+	// Listen is the host:port the API is served on. The API is not
+	// authenticated, so the host must be a loopback address.
+	Listen string `yaml:"listen"`
+}
+
+const (
+	// NetworkLocal runs all parties in this process on a shared local bus.
+	NetworkLocal = "local"
+	// NetworkTCP runs a single party that talks to its peers over TCP.
+	NetworkTCP = "tcp"
+)
+
+// Network configures the off-chain communication.
+type Network struct {
+	// Mode is either NetworkLocal or NetworkTCP.
+	Mode string `yaml:"mode"`
+	// Party is the name of the party this process runs in tcp mode. It may be
+	// omitted if only one party is configured.
+	Party string `yaml:"party"`
+	// Listen is the host:port this process accepts peer connections on.
+	Listen string `yaml:"listen"`
+	// DialTimeout bounds the time spent connecting to a peer.
+	DialTimeout time.Duration `yaml:"dial_timeout"`
+}
+
+// Party describes a single payment client.
+type Party struct {
+	Name string `yaml:"name"`
+	// PublicKey is the hex-encoded ed25519 public key of the party.
+	PublicKey string `yaml:"public_key"`
+	// PaymentIdentifier is the hex-encoded payment public key hash.
+	PaymentIdentifier string `yaml:"payment_identifier"`
+	// WalletID is the ID of the party's wallet in the cardano-wallet server.
+	WalletID string `yaml:"wallet_id"`
+	// PABHost optionally overrides Config.PABHost for this party.
+	PABHost string `yaml:"pab_host,omitempty"`
+	// WalletServerURL optionally overrides Config.WalletServerURL for this
+	// party.
+	WalletServerURL string `yaml:"wallet_server_url,omitempty"`
+}
+
+// Timeouts bounds the duration of the clients' operations. Zero durations
+// select the client defaults, negative durations such as -1s disable the
+// respective timeout.
+type Timeouts struct {
+	Open    time.Duration `yaml:"open"`
+	Update  time.Duration `yaml:"update"`
+	Settle  time.Duration `yaml:"settle"`
+	Handle  time.Duration `yaml:"handle"`
+	Query   time.Duration `yaml:"query"`
+	Request time.Duration `yaml:"request"`
+}
+
+// LogStderr is the LogFile that selects stderr.
+const LogStderr = "-"
+
+// Log configures the log. The log file is rotated once it reaches MaxSize.
+type Log struct {
+	// Level is the minimum level of logged entries: "trace", "debug",
+	// "info", "warn", "error", "fatal" or "panic".
+	Level string `yaml:"level"`
+	// Format is either LogFormatText or LogFormatJSON.
+	Format string `yaml:"format"`
+	// MaxSize is the size in megabytes at which the log file is rotated.
+	// Zero disables rotation.
+	MaxSize int `yaml:"max_size"`
+	// MaxBackups is the number of rotated files to keep. Zero keeps all.
+	MaxBackups int `yaml:"max_backups"`
+	// MaxAge is the number of days to keep rotated files. Zero keeps them
+	// regardless of their age.
+	MaxAge int `yaml:"max_age"`
+	// Compress compresses rotated files with gzip.
+	Compress bool `yaml:"compress"`
+}
+
+const (
+	// LogFormatText logs human-readable key=value lines.
+	LogFormatText = "text"
+	// LogFormatJSON logs one JSON object per line.
+	LogFormatJSON = "json"
+)
+
+// Shutdown configures the graceful shutdown on SIGINT or SIGTERM.
+type Shutdown struct {
+	// Policy is either ShutdownSettle or ShutdownLeaveOpen.
+	Policy string `yaml:"policy"`
+	// Timeout bounds waiting for in-flight operations and settling the
+	// channels of each party.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+const (
+	// ShutdownSettle settles all open channels.
+	ShutdownSettle = "settle"
+	// ShutdownLeaveOpen leaves the channels open, to be restored from
+	// DataDir on the next start.
+	ShutdownLeaveOpen = "leave_open"
+)
+
+// Balance configures how on-chain balances are watched. Zero durations select
+// the client defaults.
+type Balance struct {
+	// Interval is the time between two queries of a wallet.
+	Interval time.Duration `yaml:"interval"`
+	// MaxBackoff bounds the interval after failed queries.
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	// RefreshOnEvents additionally queries the balances when a channel is
+	// funded, settled or changed on-chain.
+	RefreshOnEvents bool `yaml:"refresh_on_events"`
+}
+
+// Peer is an address book entry for a remote party.
+type Peer struct {
+	Name string `yaml:"name"`
+	// PublicKey is the hex-encoded ed25519 public key of the peer. It
+	// determines the peer's off-chain identity.
+	PublicKey string `yaml:"public_key"`
+	// PaymentIdentifier is the hex-encoded payment public key hash of the
+	// peer. It is only used for display purposes.
+	PaymentIdentifier string `yaml:"payment_identifier"`
+	// Address is the host:port the peer listens on.
+	Address string `yaml:"address"`
+}
+
+// Default returns the configuration of the local two-party devnet the demo
+// was originally written against.
+func Default() Config {
+	return Config{
+		PABHost:         "localhost:9080",
+		WalletServerURL: "http://localhost:8090/v2",
+		RemoteWalletURL: "http://localhost:8888",
+		LogFile:         "payment-client.log",
+		Log:             Log{Level: "info", Format: LogFormatText},
+		Mode:            ModeTUI,
+		API:             API{Listen: "127.0.0.1:8080"},
+		Shutdown:        Shutdown{Policy: ShutdownLeaveOpen, Timeout: 5 * time.Minute},
+		ProposalPolicy:  ProposalPolicy{RequireEqualFunding: true},
+		Network: Network{
+			Mode:        NetworkLocal,
+			Listen:      "0.0.0.0:5750",
+			DialTimeout: 10 * time.Second,
+		},
+		Parties: []Party{
+			{
+				Name:              "Alice",
+				PublicKey:         "5a3aeed83ffe0e41408a41de4cf9e1f1e39416643ea21231a2d00be46f5446a9",
+				PaymentIdentifier: "9706069d2e482d1612cdf062d0d2f9bb3db01ab074f7c3eeb741bcd4",
+				WalletID:          "c35896086738b89c00f3ff41f2beced7449fc6e6",
+			},
+			{
+				Name:              "Bob",
+				PublicKey:         "04960fbc5fe4f1ae939fdfed8a13569384474db2a38ce7b65b328d1cd578fded",
+				PaymentIdentifier: "b50a436ae002343d30c9ddd48608a13e0e38b6785a47121c80cf45ff",
+				WalletID:          "34dd5c2bc7ec25850765242b83a31053ac3d3fb5",
+			},
+		},
+	}
+}
+
+// LoadFile reads the YAML file at path on top of cfg. Fields that are present
+// in the file overwrite the current value, including false and zero values.
+// Fields that are not present keep their current value. Lists, such as the
+// party list, are replaced as a whole.
+func LoadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	// Decode into a copy so that cfg is left untouched on errors.
+	file := *cfg
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	*cfg = file
+	return nil
+}
+
+// PABHostOf returns the PAB host the given party should use.
+func (c Config) PABHostOf(p Party) string {
+	if p.PABHost != "" {
+		return p.PABHost
+	}
+	return c.PABHost
+}
+
+// WalletServerURLOf returns the cardano-wallet URL the given party should use.
+func (c Config) WalletServerURLOf(p Party) string {
+	if p.WalletServerURL != "" {
+		return p.WalletServerURL
+	}
+	return c.WalletServerURL
+}
+
+// LocalParties returns the parties that are run by this process.
+func (c Config) LocalParties() []Party {
+	if c.Network.Mode != NetworkTCP || c.Network.Party == "" {
+		return c.Parties
+	}
+	for _, p := range c.Parties {
+		if p.Name == c.Network.Party {
+			return []Party{p}
+		}
+	}
+	return nil
+}
+
+func setIfNotEmpty(dst *string, val string) {
+	if val != "" {
+		*dst = val
+	}
+}
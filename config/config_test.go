@@ -0,0 +1,230 @@
+package config_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"perun.network/perun-cardano-demo/config"
+)
+
+const testConfig = `
+pab_host: devnet:9080
+timeouts:
+  update: 1m
+balance:
+  interval: 30s
+challenge_duration: 60
+proposal_policy:
+  require_equal_funding: true
+shutdown:
+  policy: settle
+log:
+  format: json
+  max_size: 10
+parties:
+  - name: Merchant
+    public_key: 5a3aeed83ffe0e41408a41de4cf9e1f1e39416643ea21231a2d00be46f5446a9
+    payment_identifier: 9706069d2e482d1612cdf062d0d2f9bb3db01ab074f7c3eeb741bcd4
+    wallet_id: c35896086738b89c00f3ff41f2beced7449fc6e6
+    pab_host: devnet:9081
+`
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testConfig), 0600))
+	t.Setenv("PERUN_CARDANO_WALLET_SERVER_URL", "http://env:8090/v2")
+	t.Setenv("PERUN_CARDANO_LOG_FILE", "env.log")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, err := config.Load(fs, []string{"-config", path, "-log-file", "flag.log", "-log-level", "debug"})
+	require.NoError(t, err)
+
+	require.Equal(t, "devnet:9080", cfg.PABHost)                   // From file.
+	require.Equal(t, "http://env:8090/v2", cfg.WalletServerURL)    // From env.
+	require.Equal(t, "http://localhost:8888", cfg.RemoteWalletURL) // Default.
+	require.Equal(t, "flag.log", cfg.LogFile)                      // Flag beats env.
+	require.Equal(t, time.Minute, cfg.Timeouts.Update)
+	require.Equal(t, 30*time.Second, cfg.Balance.Interval)
+	require.Equal(t, uint64(60), cfg.ChallengeDuration)
+	require.True(t, cfg.ProposalPolicy.RequireEqualFunding)
+	require.Equal(t, config.ShutdownSettle, cfg.Shutdown.Policy)
+	require.Equal(t, 5*time.Minute, cfg.Shutdown.Timeout) // Default.
+	require.Equal(t, config.Log{Level: "debug", Format: config.LogFormatJSON, MaxSize: 10}, cfg.Log)
+	require.Len(t, cfg.Parties, 1)
+	require.Equal(t, "devnet:9081", cfg.PABHostOf(cfg.Parties[0]))
+	require.Equal(t, "http://env:8090/v2", cfg.WalletServerURLOf(cfg.Parties[0]))
+}
+
+func TestLoadBools(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+proposal_policy:
+  require_equal_funding: true
+  max_own_deposit: 100000000
+update_policy:
+  audit: true
+`), 0600))
+
+	// A file can turn off a setting that is on.
+	cfg := config.Default()
+	cfg.ProposalPolicy.RequireEqualFunding = true
+	cfg.Balance.RefreshOnEvents = true
+	require.NoError(t, os.WriteFile(path+".off", []byte("proposal_policy:\n  require_equal_funding: false\n"), 0600))
+	require.NoError(t, config.LoadFile(&cfg, path+".off"))
+	require.False(t, cfg.ProposalPolicy.RequireEqualFunding)
+	require.True(t, cfg.Balance.RefreshOnEvents) // Not in the file.
+	require.Len(t, cfg.Parties, 2)
+
+	// Environment variables and flags can turn off settings of the file.
+	t.Setenv("PERUN_CARDANO_REQUIRE_EQUAL_FUNDING", "false")
+	t.Setenv("PERUN_CARDANO_AUDIT_UPDATES", "false")
+	t.Setenv("PERUN_CARDANO_REFRESH_ON_EVENTS", "true")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, err := config.Load(fs, []string{"-config", path, "-audit-updates", "-refresh-on-events=false"})
+	require.NoError(t, err)
+	require.False(t, cfg.ProposalPolicy.RequireEqualFunding) // Env beats file.
+	require.True(t, cfg.UpdatePolicy.Audit)                  // Flag beats env.
+	require.False(t, cfg.Balance.RefreshOnEvents)            // Flag beats env.
+
+	t.Setenv("PERUN_CARDANO_AUDIT_UPDATES", "maybe")
+	_, err = config.Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", path})
+	require.Error(t, err)
+}
+
+func TestLoadDisabledTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("timeouts:\n  update: -1s\n  settle: 2m\n"), 0600))
+	cfg, err := config.Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", path})
+	require.NoError(t, err)
+	require.Equal(t, config.Timeouts{Update: -time.Second, Settle: 2 * time.Minute}, cfg.Timeouts)
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, config.Default().Validate())
+
+	cfg := config.Default()
+	cfg.PABHost = "localhost"
+	cfg.Parties[1].Name = cfg.Parties[0].Name
+	cfg.Parties[1].WalletID = "34dd"
+	cfg.Shutdown.Policy = "close"
+	cfg.LogFile = config.LogStderr // Not allowed in tui mode.
+	cfg.Log = config.Log{Level: "verbose", Format: "xml", MaxAge: -1}
+	err := cfg.Validate()
+	require.Error(t, err)
+
+	verr, ok := err.(config.ValidationError)
+	require.True(t, ok)
+	fields := make([]string, len(verr))
+	for i, fe := range verr {
+		fields[i] = fe.Field
+	}
+	require.ElementsMatch(t, []string{"pab_host", "parties[1].name", "parties[1].wallet_id", "shutdown.policy",
+		"log_file", "log.level", "log.format", "log.max_age"}, fields)
+}
+
+func TestDefaultRequiresEqualFunding(t *testing.T) {
+	cfg := config.Default()
+	require.True(t, cfg.ProposalPolicy.RequireEqualFunding)
+
+	// Unequal funding is opt-in and requires a bound on our deposit.
+	cfg.ProposalPolicy.RequireEqualFunding = false
+	require.Error(t, cfg.Validate())
+	cfg.ProposalPolicy.MaxOwnDeposit = 100_000_000
+	require.NoError(t, cfg.Validate())
+}
+
+func TestValidateAPIListen(t *testing.T) {
+	cfg := config.Default()
+	cfg.Mode = config.ModeDaemon
+	for _, addr := range []string{"127.0.0.1:8080", "[::1]:8080", "localhost:8080"} {
+		cfg.API.Listen = addr
+		require.NoError(t, cfg.Validate(), addr)
+	}
+	for _, addr := range []string{"0.0.0.0:8080", "192.168.1.10:8080", ":8080", "example.com:8080"} {
+		cfg.API.Listen = addr
+		require.Error(t, cfg.Validate(), addr)
+	}
+}
+
+func TestValidateTCP(t *testing.T) {
+	cfg := config.Default()
+	cfg.Network.Mode = config.NetworkTCP
+	err := cfg.Validate()
+	require.Error(t, err, "party must be selected if several are configured")
+
+	cfg.Network.Party = "Bob"
+	cfg.Peers = []config.Peer{{
+		Name:      "Alice",
+		PublicKey: cfg.Parties[0].PublicKey,
+		Address:   "127.0.0.1:5750",
+	}}
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, []config.Party{cfg.Parties[1]}, cfg.LocalParties())
+
+	cfg.Peers[0].Address = "nohost"
+	require.Error(t, cfg.Validate())
+}
+
+func TestValidateProposalPolicy(t *testing.T) {
+	cfg := config.Default()
+	cfg.ProposalPolicy = config.ProposalPolicy{
+		AllowPeers:          []string{"Bob", cfg.Parties[0].PublicKey},
+		MinPeerDeposit:      10,
+		MaxPeerDeposit:      100,
+		RequireEqualFunding: true,
+	}
+	require.NoError(t, cfg.Validate())
+
+	cfg.ProposalPolicy.DenyPeers = []string{"Mallory"}
+	cfg.ProposalPolicy.MaxPeerDeposit = 5
+	cfg.ProposalPolicy.AskUser = true
+	cfg.ProposalPolicy.RequireEqualFunding = false // Requires max_own_deposit.
+	err := cfg.Validate()
+	require.Error(t, err)
+
+	verr, ok := err.(config.ValidationError)
+	require.True(t, ok)
+	fields := make([]string, len(verr))
+	for i, fe := range verr {
+		fields[i] = fe.Field
+	}
+	require.ElementsMatch(t, []string{
+		"proposal_policy.deny_peers[0]",
+		"proposal_policy.max_peer_deposit",
+		"proposal_policy.ask_user",
+		"proposal_policy.max_own_deposit",
+	}, fields)
+	require.Contains(t, err.Error(), "terminal UI cannot show or answer pending proposals")
+}
+
+func TestValidateRequestPolicy(t *testing.T) {
+	cfg := config.Default()
+	cfg.RequestPolicy = config.RequestPolicy{
+		AllowPeers:  []string{"Bob"},
+		ApproveUpTo: 1_000_000,
+	}
+	require.NoError(t, cfg.Validate())
+
+	cfg.RequestPolicy.AllowPeers = []string{"Mallory"}
+	cfg.RequestPolicy.ApproveUpTo = -1
+	cfg.RequestPolicy.AskUser = true
+	err := cfg.Validate()
+	require.Error(t, err)
+
+	verr, ok := err.(config.ValidationError)
+	require.True(t, ok)
+	fields := make([]string, len(verr))
+	for i, fe := range verr {
+		fields[i] = fe.Field
+	}
+	require.ElementsMatch(t, []string{
+		"request_policy.allow_peers[0]",
+		"request_policy.approve_up_to",
+		"request_policy.ask_user",
+	}, fields)
+	require.Contains(t, err.Error(), "terminal UI cannot show or answer pending payment requests")
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// EnvConfigFile is the environment variable that may point to a config file
+// if the -config flag is not given.
+const EnvConfigFile = "PERUN_CARDANO_CONFIG"
+
+// override is a top-level setting that can be set by flag and environment
+// variable.
+type override struct {
+	flag  string
+	env   string
+	usage string
+	field func(*Config) *string
+}
+
+var overrides = []override{
+	{"pab-host", "PERUN_CARDANO_PAB_HOST", "host:port of the PAB", func(c *Config) *string { return &c.PABHost }},
+	{"wallet-server-url", "PERUN_CARDANO_WALLET_SERVER_URL", "cardano-wallet v2 API url", func(c *Config) *string { return &c.WalletServerURL }},
+	{"remote-wallet-url", "PERUN_CARDANO_REMOTE_WALLET_URL", "perun-cardano-wallet url", func(c *Config) *string { return &c.RemoteWalletURL }},
+	{"log-file", "PERUN_CARDANO_LOG_FILE", "path of the log file, - for stderr in daemon mode", func(c *Config) *string { return &c.LogFile }},
+	{"log-level", "PERUN_CARDANO_LOG_LEVEL", "minimum log level, e.g. debug, info or warn", func(c *Config) *string { return &c.Log.Level }},
+	{"log-format", "PERUN_CARDANO_LOG_FORMAT", "log format, text or json", func(c *Config) *string { return &c.Log.Format }},
+	{"data-dir", "PERUN_CARDANO_DATA_DIR", "directory to persist channels in, empty disables persistence", func(c *Config) *string { return &c.DataDir }},
+	{"mode", "PERUN_CARDANO_MODE", "front-end, tui or daemon", func(c *Config) *string { return &c.Mode }},
+	{"api-listen", "PERUN_CARDANO_API_LISTEN", "host:port the daemon serves the HTTP API on", func(c *Config) *string { return &c.API.Listen }},
+	{"network", "PERUN_CARDANO_NETWORK", "network mode, local or tcp", func(c *Config) *string { return &c.Network.Mode }},
+	{"party", "PERUN_CARDANO_PARTY", "name of the party to run in tcp mode", func(c *Config) *string { return &c.Network.Party }},
+	{"shutdown", "PERUN_CARDANO_SHUTDOWN", "what to do with open channels on shutdown, settle or leave_open", func(c *Config) *string { return &c.Shutdown.Policy }},
+	{"listen", "PERUN_CARDANO_LISTEN", "host:port to accept peer connections on in tcp mode", func(c *Config) *string { return &c.Network.Listen }},
+}
+
+// boolOverride is a boolean setting that can be set by flag and environment
+// variable. Both can turn the setting on and off, e.g. -audit-updates=false.
+type boolOverride struct {
+	flag  string
+	env   string
+	usage string
+	field func(*Config) *bool
+}
+
+var boolOverrides = []boolOverride{
+	{"log-compress", "PERUN_CARDANO_LOG_COMPRESS", "compress rotated log files", func(c *Config) *bool { return &c.Log.Compress }},
+	{"refresh-on-events", "PERUN_CARDANO_REFRESH_ON_EVENTS", "query balances on channel events", func(c *Config) *bool { return &c.Balance.RefreshOnEvents }},
+	{"require-equal-funding", "PERUN_CARDANO_REQUIRE_EQUAL_FUNDING", "only accept proposals with equal deposits", func(c *Config) *bool { return &c.ProposalPolicy.RequireEqualFunding }},
+	{"ask-user-proposals", "PERUN_CARDANO_ASK_USER_PROPOSALS", "let the user decide channel proposals", func(c *Config) *bool { return &c.ProposalPolicy.AskUser }},
+	{"ask-user-requests", "PERUN_CARDANO_ASK_USER_REQUESTS", "let the user decide payment requests", func(c *Config) *bool { return &c.RequestPolicy.AskUser }},
+	{"audit-updates", "PERUN_CARDANO_AUDIT_UPDATES", "log every accepted and rejected update", func(c *Config) *bool { return &c.UpdatePolicy.Audit }},
+}
+
+// Load registers the config flags on fs, parses args and assembles the
+// configuration from defaults, the config file, environment variables and
+// flags, in increasing order of precedence. The returned configuration is
+// validated.
+func Load(fs *flag.FlagSet, args []string) (Config, error) {
+	path := fs.String("config", "", "path to a YAML config file (env "+EnvConfigFile+")")
+	for _, o := range overrides {
+		fs.String(o.flag, "", o.usage+" (env "+o.env+")")
+	}
+	for _, o := range boolOverrides {
+		fs.Bool(o.flag, false, o.usage+" (env "+o.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := Default()
+	if *path == "" {
+		*path = os.Getenv(EnvConfigFile)
+	}
+	if *path != "" {
+		if err := LoadFile(&cfg, *path); err != nil {
+			return Config{}, err
+		}
+	}
+	for _, o := range overrides {
+		setIfNotEmpty(o.field(&cfg), os.Getenv(o.env))
+	}
+	for _, o := range boolOverrides {
+		v, ok := os.LookupEnv(o.env)
+		if !ok || v == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("parsing %s: %w", o.env, err)
+		}
+		*o.field(&cfg) = b
+	}
+	fs.Visit(func(f *flag.Flag) {
+		for _, o := range overrides {
+			if o.flag == f.Name {
+				*o.field(&cfg) = f.Value.String()
+			}
+		}
+		for _, o := range boolOverrides {
+			if o.flag == f.Name {
+				*o.field(&cfg) = f.Value.(flag.Getter).Get().(bool)
+			}
+		}
+	})
+
+	return cfg, cfg.Validate()
+}
@@ -0,0 +1,189 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProposalPolicy restricts the channel proposals the parties accept. Zero
+// values are not checked, so the zero policy accepts every valid proposal.
+type ProposalPolicy struct {
+	// AllowPeers only accepts proposals from these peers if not empty. Peers
+	// are given by party or peer name, or by hex-encoded public key.
+	AllowPeers []string `yaml:"allow_peers"`
+	// DenyPeers rejects proposals from these peers.
+	DenyPeers []string `yaml:"deny_peers"`
+	// MinPeerDeposit is the minimum deposit of the proposer in Lovelace.
+	MinPeerDeposit int64 `yaml:"min_peer_deposit"`
+	// MaxPeerDeposit is the maximum deposit of the proposer in Lovelace.
+	MaxPeerDeposit int64 `yaml:"max_peer_deposit"`
+	// MaxOwnDeposit is the maximum deposit we accept to make in Lovelace.
+	MaxOwnDeposit int64 `yaml:"max_own_deposit"`
+	// RequireEqualFunding rejects proposals in which we are asked to deposit
+	// a different amount than the proposer. It is on by default. Turning it
+	// off accepts any deposits within the limits, including a zero deposit of
+	// the proposer, and requires MaxOwnDeposit to bound our deposit.
+	RequireEqualFunding bool `yaml:"require_equal_funding"`
+	// MinChallengeDuration is the minimum challenge duration in seconds.
+	MinChallengeDuration uint64 `yaml:"min_challenge_duration"`
+	// MaxChallengeDuration is the maximum challenge duration in seconds.
+	MaxChallengeDuration uint64 `yaml:"max_challenge_duration"`
+	// MaxChannels is the maximum number of concurrent channels per party.
+	MaxChannels int `yaml:"max_channels"`
+	// AskUser holds proposals that pass all other checks until they are
+	// accepted or rejected via the HTTP API. Requires daemon mode, as the
+	// terminal UI cannot show or answer pending proposals.
+	AskUser bool `yaml:"ask_user"`
+	// AskTimeout rejects proposals that are not decided in time. If zero,
+	// timeouts.open applies.
+	AskTimeout time.Duration `yaml:"ask_timeout"`
+}
+
+// UpdatePolicy restricts the channel updates the parties accept. Updates that
+// change anything but the balances are always rejected. Zero values are not
+// checked.
+type UpdatePolicy struct {
+	// MinPayment is the minimum amount of an incoming payment in Lovelace.
+	MinPayment int64 `yaml:"min_payment"`
+	// MaxPayment is the maximum amount of an incoming payment in Lovelace.
+	MaxPayment int64 `yaml:"max_payment"`
+	// MaxPerPeriod is the maximum amount received per party within Period in
+	// Lovelace.
+	MaxPerPeriod int64 `yaml:"max_per_period"`
+	// Period is the sliding window of MaxPerPeriod.
+	Period time.Duration `yaml:"period"`
+	// RefuseFinalizeWhilePending rejects the peer's request to finalize a
+	// channel while we are sending a payment in it.
+	RefuseFinalizeWhilePending bool `yaml:"refuse_finalize_while_pending"`
+	// Audit logs every accepted and rejected update.
+	Audit bool `yaml:"audit"`
+}
+
+// RequestPolicy decides which payment requests of peers the parties pay. By
+// default, all requests are declined.
+type RequestPolicy struct {
+	// AllowPeers only pays requests of these peers if not empty. Peers are
+	// given by party or peer name, or by hex-encoded public key.
+	AllowPeers []string `yaml:"allow_peers"`
+	// ApproveUpTo pays requests of up to this amount in Lovelace
+	// automatically.
+	ApproveUpTo int64 `yaml:"approve_up_to"`
+	// AskUser holds larger requests until they are paid or declined via the
+	// HTTP API. Otherwise, they are declined. Requires daemon mode, as the
+	// terminal UI cannot show or answer pending requests.
+	AskUser bool `yaml:"ask_user"`
+	// AskTimeout declines requests that are not decided in time. If zero,
+	// timeouts.request applies.
+	AskTimeout time.Duration `yaml:"ask_timeout"`
+}
+
+// PublicKeyOf resolves a party or peer name to its public key. Other values
+// are returned unchanged if they are a valid public key.
+func (c Config) PublicKeyOf(peer string) (string, error) {
+	for _, p := range c.Parties {
+		if p.Name == peer {
+			return p.PublicKey, nil
+		}
+	}
+	for _, p := range c.Peers {
+		if p.Name == peer {
+			return p.PublicKey, nil
+		}
+	}
+	if err := checkHex(peer, pubKeyLen); err != nil {
+		return "", fmt.Errorf("neither a known party or peer nor a public key: %v", err)
+	}
+	return peer, nil
+}
+
+// validateProposalPolicy checks the proposal policy.
+func (c Config) validateProposalPolicy(add func(field, format string, args ...interface{})) {
+	p := c.ProposalPolicy
+	checkPeers := func(list string, peers []string) {
+		for i, peer := range peers {
+			if _, err := c.PublicKeyOf(peer); err != nil {
+				add(fmt.Sprintf("proposal_policy.%s[%d]", list, i), "%q: %v", peer, err)
+			}
+		}
+	}
+	checkPeers("allow_peers", p.AllowPeers)
+	checkPeers("deny_peers", p.DenyPeers)
+	for name, v := range map[string]int64{
+		"min_peer_deposit": p.MinPeerDeposit,
+		"max_peer_deposit": p.MaxPeerDeposit,
+		"max_own_deposit":  p.MaxOwnDeposit,
+	} {
+		if v < 0 {
+			add("proposal_policy."+name, "must not be negative")
+		}
+	}
+	if !p.RequireEqualFunding && p.MaxOwnDeposit == 0 {
+		add("proposal_policy.max_own_deposit", "must be set if require_equal_funding is off, otherwise peers can make us deposit any amount")
+	}
+	if p.MaxPeerDeposit != 0 && p.MinPeerDeposit > p.MaxPeerDeposit {
+		add("proposal_policy.max_peer_deposit", "must not be less than min_peer_deposit")
+	}
+	if p.MaxChallengeDuration != 0 && p.MinChallengeDuration > p.MaxChallengeDuration {
+		add("proposal_policy.max_challenge_duration", "must not be less than min_challenge_duration")
+	}
+	if p.MaxChannels < 0 {
+		add("proposal_policy.max_channels", "must not be negative")
+	}
+	if p.AskUser && c.Mode != ModeDaemon {
+		add("proposal_policy.ask_user", "requires mode %q: the terminal UI cannot show or answer pending proposals, decide them via the HTTP API instead", ModeDaemon)
+	}
+	if p.AskTimeout < 0 {
+		add("proposal_policy.ask_timeout", "must not be negative")
+	}
+}
+
+// validateUpdatePolicy checks the update policy.
+func (c Config) validateUpdatePolicy(add func(field, format string, args ...interface{})) {
+	p := c.UpdatePolicy
+	if p.MinPayment < 0 {
+		add("update_policy.min_payment", "must not be negative")
+	}
+	if p.MaxPayment < 0 {
+		add("update_policy.max_payment", "must not be negative")
+	} else if p.MaxPayment != 0 && p.MinPayment > p.MaxPayment {
+		add("update_policy.max_payment", "must not be less than min_payment")
+	}
+	if p.MaxPerPeriod < 0 {
+		add("update_policy.max_per_period", "must not be negative")
+	} else if p.MaxPerPeriod != 0 && p.Period <= 0 {
+		add("update_policy.period", "must be positive if max_per_period is set")
+	}
+}
+
+// validateRequestPolicy checks the request policy.
+func (c Config) validateRequestPolicy(add func(field, format string, args ...interface{})) {
+	p := c.RequestPolicy
+	for i, peer := range p.AllowPeers {
+		if _, err := c.PublicKeyOf(peer); err != nil {
+			add(fmt.Sprintf("request_policy.allow_peers[%d]", i), "%q: %v", peer, err)
+		}
+	}
+	if p.ApproveUpTo < 0 {
+		add("request_policy.approve_up_to", "must not be negative")
+	}
+	if p.AskUser && c.Mode != ModeDaemon {
+		add("request_policy.ask_user", "requires mode %q: the terminal UI cannot show or answer pending payment requests, decide them via the HTTP API instead", ModeDaemon)
+	}
+	if p.AskTimeout < 0 {
+		add("request_policy.ask_timeout", "must not be negative")
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2022 PolyCrypt GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	pubKeyLen            = 32 // ed25519 public key.
+	paymentIdentifierLen = 28 // blake2b-224 hash of the payment public key.
+	walletIDLen          = 20 // cardano-wallet wallet id.
+)
+
+// FieldError describes a single invalid configuration field.
+type FieldError struct {
+	Field string // Field is the path of the field, e.g. "parties[1].wallet_id".
+	Msg   string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Msg
+}
+
+// ValidationError is returned by Validate and lists every invalid field.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return "invalid configuration:\n  " + strings.Join(msgs, "\n  ")
+}
+
+// Validate checks the configuration and returns a ValidationError describing
+// all invalid fields, or nil.
+func (c Config) Validate() error {
+	var errs ValidationError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if err := checkHostPort(c.PABHost); err != nil {
+		add("pab_host", "%v", err)
+	}
+	if err := checkHTTPURL(c.WalletServerURL); err != nil {
+		add("wallet_server_url", "%v", err)
+	}
+	if err := checkHTTPURL(c.RemoteWalletURL); err != nil {
+		add("remote_wallet_url", "%v", err)
+	}
+	if c.LogFile == "" {
+		add("log_file", "must not be empty")
+	}
+	if c.LogFile == LogStderr && c.Mode != ModeDaemon {
+		add("log_file", "stderr is only allowed in %s mode", ModeDaemon)
+	}
+	c.validateLog(add)
+
+	if len(c.Parties) == 0 {
+		add("parties", "at least one party must be configured")
+	}
+	names := make(map[string]int)
+	keys := make(map[string]int)
+	for i, p := range c.Parties {
+		field := func(name string) string { return fmt.Sprintf("parties[%d].%s", i, name) }
+
+		if p.Name == "" {
+			add(field("name"), "must not be empty")
+		} else if j, ok := names[p.Name]; ok {
+			add(field("name"), "%q is already used by parties[%d]", p.Name, j)
+		} else {
+			names[p.Name] = i
+		}
+
+		if err := checkHex(p.PublicKey, pubKeyLen); err != nil {
+			add(field("public_key"), "%v", err)
+		} else if j, ok := keys[strings.ToLower(p.PublicKey)]; ok {
+			add(field("public_key"), "already used by parties[%d]", j)
+		} else {
+			keys[strings.ToLower(p.PublicKey)] = i
+		}
+		if err := checkHex(p.PaymentIdentifier, paymentIdentifierLen); err != nil {
+			add(field("payment_identifier"), "%v", err)
+		}
+		if err := checkHex(p.WalletID, walletIDLen); err != nil {
+			add(field("wallet_id"), "%v", err)
+		}
+
+		if p.PABHost != "" {
+			if err := checkHostPort(p.PABHost); err != nil {
+				add(field("pab_host"), "%v", err)
+			}
+		}
+		if p.WalletServerURL != "" {
+			if err := checkHTTPURL(p.WalletServerURL); err != nil {
+				add(field("wallet_server_url"), "%v", err)
+			}
+		}
+	}
+
+	if c.Balance.Interval < 0 {
+		add("balance.interval", "must not be negative")
+	}
+	if c.Balance.MaxBackoff < 0 {
+		add("balance.max_backoff", "must not be negative")
+	} else if c.Balance.MaxBackoff != 0 && c.Balance.MaxBackoff < c.Balance.Interval {
+		add("balance.max_backoff", "must not be less than balance.interval")
+	}
+
+	switch c.Mode {
+	case ModeTUI:
+	case ModeDaemon:
+		if err := checkHostPort(c.API.Listen); err != nil {
+			add("api.listen", "%v", err)
+		} else if err := CheckLoopback(c.API.Listen); err != nil {
+			add("api.listen", "%v", err)
+		}
+	default:
+		add("mode", "expected %q or %q, got %q", ModeTUI, ModeDaemon, c.Mode)
+	}
+
+	switch c.Shutdown.Policy {
+	case ShutdownSettle, ShutdownLeaveOpen:
+	default:
+		add("shutdown.policy", "expected %q or %q, got %q", ShutdownSettle, ShutdownLeaveOpen, c.Shutdown.Policy)
+	}
+	if c.Shutdown.Timeout < 0 {
+		add("shutdown.timeout", "must not be negative")
+	}
+
+	switch c.Network.Mode {
+	case NetworkLocal:
+	case NetworkTCP:
+		c.validateTCP(add, names)
+	default:
+		add("network.mode", "expected %q or %q, got %q", NetworkLocal, NetworkTCP, c.Network.Mode)
+	}
+
+	c.validateProposalPolicy(add)
+	c.validateUpdatePolicy(add)
+	c.validateRequestPolicy(add)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateTCP checks the settings that are only relevant in tcp mode. names
+// maps the party names to their index.
+func (c Config) validateTCP(add func(field, format string, args ...interface{}), names map[string]int) {
+	if c.Network.Party == "" && len(c.Parties) > 1 {
+		add("network.party", "must be set in tcp mode if more than one party is configured")
+	} else if _, ok := names[c.Network.Party]; c.Network.Party != "" && !ok {
+		add("network.party", "unknown party %q", c.Network.Party)
+	}
+	if err := checkHostPort(c.Network.Listen); err != nil {
+		add("network.listen", "%v", err)
+	}
+	if c.Network.DialTimeout < 0 {
+		add("network.dial_timeout", "must not be negative")
+	}
+
+	peerNames := make(map[string]int)
+	for i, p := range c.Peers {
+		field := func(name string) string { return fmt.Sprintf("peers[%d].%s", i, name) }
+
+		if p.Name == "" {
+			add(field("name"), "must not be empty")
+		} else if j, ok := peerNames[p.Name]; ok {
+			add(field("name"), "%q is already used by peers[%d]", p.Name, j)
+		} else {
+			peerNames[p.Name] = i
+		}
+		if err := checkHex(p.PublicKey, pubKeyLen); err != nil {
+			add(field("public_key"), "%v", err)
+		}
+		if p.PaymentIdentifier != "" {
+			if err := checkHex(p.PaymentIdentifier, paymentIdentifierLen); err != nil {
+				add(field("payment_identifier"), "%v", err)
+			}
+		}
+		if err := checkHostPort(p.Address); err != nil {
+			add(field("address"), "%v", err)
+		}
+	}
+}
+
+func checkHostPort(s string) error {
+	if s == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return fmt.Errorf("expected host:port, got %q", s)
+	}
+	if host == "" || port == "" {
+		return fmt.Errorf("expected host:port, got %q", s)
+	}
+	return nil
+}
+
+// CheckLoopback checks that the host of the host:port s is a loopback
+// address. Host names other than localhost are refused as they may resolve
+// to any address. The API server uses it to refuse other listen addresses.
+func CheckLoopback(s string) error {
+	host, _, err := net.SplitHostPort(s)
+	if err != nil {
+		return fmt.Errorf("expected host:port, got %q", s)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("must be a loopback address, the API is not authenticated, got %q", host)
+	}
+	return nil
+}
+
+func checkHTTPURL(s string) error {
+	if s == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %v", s, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("expected http or https url, got %q", s)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host in url %q", s)
+	}
+	return nil
+}
+
+func checkHex(s string, n int) error {
+	if s == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("invalid hex string %q: %v", s, err)
+	}
+	if len(b) != n {
+		return fmt.Errorf("expected %d bytes, got %d", n, len(b))
+	}
+	return nil
+}
+
+func (c Config) validateLog(add func(field, format string, args ...interface{})) {
+	if _, err := logrus.ParseLevel(c.Log.Level); err != nil {
+		add("log.level", "%v", err)
+	}
+	switch c.Log.Format {
+	case LogFormatText, LogFormatJSON:
+	default:
+		add("log.format", "expected %q or %q, got %q", LogFormatText, LogFormatJSON, c.Log.Format)
+	}
+	for _, f := range []struct {
+		name string
+		val  int
+	}{{"log.max_size", c.Log.MaxSize}, {"log.max_backups", c.Log.MaxBackups}, {"log.max_age", c.Log.MaxAge}} {
+		if f.val < 0 {
+			add(f.name, "must not be negative")
+		}
+	}
+}
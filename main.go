@@ -15,53 +15,434 @@
 package main
 
 import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 	gpchannel "perun.network/go-perun/channel"
+	plog "perun.network/go-perun/log"
+	plogrus "perun.network/go-perun/log/logrus"
 	gpwallet "perun.network/go-perun/wallet"
 	"perun.network/go-perun/wire"
 	"perun.network/perun-cardano-backend/channel"
 	"perun.network/perun-cardano-backend/wallet"
+	"perun.network/perun-cardano-demo/api"
 	"perun.network/perun-cardano-demo/client"
+	"perun.network/perun-cardano-demo/config"
 	vc "perun.network/perun-demo-tui/client"
 	"perun.network/perun-demo-tui/view"
+	"syscall"
+	"time"
 )
 
-const (
-	pabHost                = "localhost:9080"
-	cardanoWalletServerURL = "http://localhost:8090/v2"
+// setupLogging configures the standard logrus logger, which the clients
+// use by default, and routes the logs of go-perun and the standard library
+// into it.
+func setupLogging(cfg config.Config) error {
+	level, err := logrus.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return err
+	}
+	logger := logrus.StandardLogger()
+	logger.SetLevel(level)
+	switch cfg.Log.Format {
+	case config.LogFormatJSON:
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true, DisableColors: true})
+	}
 
-	pubKeyAlice            = "5a3aeed83ffe0e41408a41de4cf9e1f1e39416643ea21231a2d00be46f5446a9"
-	pubKeyBob              = "04960fbc5fe4f1ae939fdfed8a13569384474db2a38ce7b65b328d1cd578fded"
-	alicePaymentIdentifier = "9706069d2e482d1612cdf062d0d2f9bb3db01ab074f7c3eeb741bcd4"
-	bobPaymentIdentifier   = "b50a436ae002343d30c9ddd48608a13e0e38b6785a47121c80cf45ff"
+	switch {
+	case cfg.LogFile == config.LogStderr:
+		logger.SetOutput(os.Stderr)
+	case cfg.Log.MaxSize > 0:
+		logger.SetOutput(&lumberjack.Logger{
+			Filename:   cfg.LogFile,
+			MaxSize:    cfg.Log.MaxSize,
+			MaxBackups: cfg.Log.MaxBackups,
+			MaxAge:     cfg.Log.MaxAge,
+			Compress:   cfg.Log.Compress,
+		})
+	default:
+		logFile, err := os.OpenFile(cfg.LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return fmt.Errorf("opening log file: %w", err)
+		}
+		logger.SetOutput(logFile)
+	}
 
-	walletIDAlice = "c35896086738b89c00f3ff41f2beced7449fc6e6"
-	walletIDBob   = "34dd5c2bc7ec25850765242b83a31053ac3d3fb5"
-)
+	plog.Set(&plogrus.Logger{Entry: logger.WithField("component", "go-perun")})
+	log.SetFlags(0)
+	log.SetOutput(logger.WriterLevel(logrus.InfoLevel))
+	return nil
+}
 
-func SetLogFile(path string) {
-	logFile, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+func main() {
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
 	if err != nil {
-		log.Fatalf("error opening file: %v", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-	log.SetOutput(logFile)
-}
 
-func main() {
-	SetLogFile("payment-client.log")
-	r := wallet.NewPerunCardanoWallet("http://localhost:8888")
+	if err := setupLogging(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	r := wallet.NewPerunCardanoWallet(cfg.RemoteWalletURL)
 	wb := wallet.MakeRemoteBackend(r)
 
 	gpwallet.SetBackend(wb)
 	channel.SetWalletBackend(wb)
 	gpchannel.SetBackend(channel.Backend)
 
+	// Watch the balances of all parties together, so that shared wallets are
+	// queried only once.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bw := client.NewBalanceWatcher(ctx, client.BalanceConfig{
+		Interval:        cfg.Balance.Interval,
+		MaxBackoff:      cfg.Balance.MaxBackoff,
+		RefreshOnEvents: cfg.Balance.RefreshOnEvents,
+	})
+
 	// Setup clients.
-	log.Println("Setting up clients.")
+	logrus.Info("Setting up clients")
+	var clients []*client.PaymentClient
+	var peers []*client.RemotePeer
+	switch cfg.Network.Mode {
+	case config.NetworkTCP:
+		clients, peers, err = setupTCPClients(cfg, r, bw)
+	default:
+		clients, err = setupLocalClients(cfg, r, bw)
+	}
+	if err != nil {
+		logrus.WithError(err).Fatal("Setting up clients failed")
+	}
+
+	switch cfg.Mode {
+	case config.ModeDaemon:
+		runDaemon(cfg, clients, peers)
+	default:
+		runTUI(clients, peers)
+	}
+	shutdownClients(cfg.Shutdown, clients)
+}
+
+// shutdownClients shuts the clients down gracefully according to the
+// configured policy and prints the summaries. The clients are shut down one
+// after another, so that local peers still answer while channels are settled.
+// A signal during the shutdown aborts it: the operations in flight are
+// canceled and the remaining channels are left open.
+func shutdownClients(cfg config.Shutdown, clients []*client.PaymentClient) {
+	abort, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for _, c := range clients {
+		var ctx context.Context
+		var cancel context.CancelFunc
+		if cfg.Timeout > 0 {
+			ctx, cancel = context.WithTimeout(abort, cfg.Timeout)
+		} else {
+			ctx, cancel = context.WithCancel(abort)
+		}
+		s := c.GracefulShutdown(ctx, client.ShutdownPolicy(cfg.Policy))
+		cancel()
+		fmt.Fprintln(os.Stderr, s)
+	}
+}
+
+// runTUI runs the interactive demo UI until the user quits or the process is
+// interrupted. Remote peers are listed so that they can be selected as
+// channel peers.
+func runTUI(clients []*client.PaymentClient, peers []*client.RemotePeer) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-sigs:
+			if view.App != nil {
+				view.App.TUI.Stop()
+			}
+		case <-done:
+		}
+	}()
+
+	var demoClients []vc.DemoClient
+	for _, c := range clients {
+		demoClients = append(demoClients, client.NewDemoAdapter(c))
+	}
+	for _, p := range peers {
+		demoClients = append(demoClients, p)
+	}
+	_ = view.RunDemo("Cardano Payment Channel Demo", demoClients)
+}
+
+// runDaemon serves the HTTP API until the process is interrupted by SIGINT or
+// SIGTERM.
+func runDaemon(cfg config.Config, clients []*client.PaymentClient, peers []*client.RemotePeer) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	peerAddrs := make(map[string]wire.Address, len(peers))
+	for _, p := range peers {
+		peerAddrs[p.Name] = p.Address
+	}
+	logrus.WithField("listen", cfg.API.Listen).Info("Serving API")
+	if err := api.NewServer(clients, peerAddrs).ListenAndServe(ctx, cfg.API.Listen); err != nil {
+		logrus.WithError(err).Error("Serving API failed")
+	}
+}
+
+// setupLocalClients sets up all configured parties on a shared local bus.
+func setupLocalClients(cfg config.Config, r wallet.Remote, bw *client.BalanceWatcher) ([]*client.PaymentClient, error) {
 	bus := wire.NewLocalBus() // Message bus used for off-chain communication.
-	alice := client.SetupPaymentClient("Alice", bus, pabHost, pubKeyAlice, alicePaymentIdentifier, walletIDAlice, r, cardanoWalletServerURL)
-	bob := client.SetupPaymentClient("Bob", bus, pabHost, pubKeyBob, bobPaymentIdentifier, walletIDBob, r, cardanoWalletServerURL)
-	clients := []vc.DemoClient{alice, bob}
-	_ = view.RunDemo("Cardano Payment Channel Demo", clients)
+	clients := make([]*client.PaymentClient, len(cfg.Parties))
+	for i, p := range cfg.Parties {
+		c, err := setupPaymentClient(cfg, p, bus, r, bw)
+		if err != nil {
+			return nil, err
+		}
+		clients[i] = c
+	}
+	return clients, nil
+}
+
+// setupTCPClients sets up the local party on a TCP bus and returns the peers
+// from the address book.
+func setupTCPClients(cfg config.Config, r wallet.Remote, bw *client.BalanceWatcher) ([]*client.PaymentClient, []*client.RemotePeer, error) {
+	party := cfg.LocalParties()[0]
+	addr, err := client.WireAddressFromPubKey(party.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	peers := make([]*client.RemotePeer, len(cfg.Peers))
+	peerAddrs := make([]client.PeerAddress, len(cfg.Peers))
+	for i, p := range cfg.Peers {
+		peerAddr, err := client.WireAddressFromPubKey(p.PublicKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("peer %s: %w", p.Name, err)
+		}
+		peerAddrs[i] = client.PeerAddress{WireAddress: peerAddr, Host: p.Address}
+		peers[i] = &client.RemotePeer{
+			Name:              p.Name,
+			PaymentIdentifier: p.PaymentIdentifier,
+			Address:           peerAddr,
+		}
+	}
+
+	bus, err := client.NewTCPBus(addr, cfg.Network.Listen, peerAddrs, cfg.Network.DialTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	logrus.WithField("listen", cfg.Network.Listen).Info("Listening for peers")
+	c, err := setupPaymentClient(cfg, party, bus, r, bw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []*client.PaymentClient{c}, peers, nil
+}
+
+func setupPaymentClient(cfg config.Config, p config.Party, bus wire.Bus, r wallet.Remote, bw *client.BalanceWatcher) (*client.PaymentClient, error) {
+	policy, err := proposalPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	requests, err := requestPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts := []client.Option{
+		client.WithTimeouts(clientTimeouts(cfg.Timeouts)),
+		client.WithProposalPolicy(policy),
+		client.WithUpdatePolicy(updatePolicy(cfg.UpdatePolicy)),
+		client.WithRequestPolicy(requests),
+		client.WithBalanceWatcher(bw),
+		client.WithLogger(logrus.StandardLogger()),
+	}
+	if cfg.ChallengeDuration != 0 {
+		opts = append(opts, client.WithDefaultChallengeDuration(cfg.ChallengeDuration))
+	}
+	if cfg.UpdatePolicy.Audit {
+		opts = append(opts, client.WithUpdateAuditor(client.UpdateAuditFunc(auditUpdate(p.Name))))
+	}
+	if cfg.DataDir != "" {
+		pr, err := client.NewLevelDBPersistRestorer(filepath.Join(cfg.DataDir, p.Name))
+		if err != nil {
+			return nil, fmt.Errorf("setting up %s: %w", p.Name, err)
+		}
+		opts = append(opts, client.WithPersistence(pr))
+		ledger, err := client.OpenLedger(filepath.Join(cfg.DataDir, p.Name+"-payments.jsonl"))
+		if err != nil {
+			return nil, fmt.Errorf("setting up %s: %w", p.Name, err)
+		}
+		opts = append(opts, client.WithLedger(ledger))
+	}
+	c, err := client.SetupPaymentClient(
+		p.Name,
+		bus,
+		cfg.PABHostOf(p),
+		p.PublicKey,
+		p.PaymentIdentifier,
+		p.WalletID,
+		r,
+		cfg.WalletServerURLOf(p),
+		opts...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("setting up %s: %w", p.Name, err)
+	}
+	return c, nil
+}
+
+// clientTimeouts overrides the client's default timeouts with the configured
+// ones. Negative timeouts are disabled, which the client denotes by zero.
+func clientTimeouts(t config.Timeouts) client.Timeouts {
+	ct := client.DefaultTimeouts()
+	for _, d := range []struct {
+		dst *time.Duration
+		val time.Duration
+	}{
+		{&ct.Open, t.Open},
+		{&ct.Update, t.Update},
+		{&ct.Settle, t.Settle},
+		{&ct.Handle, t.Handle},
+		{&ct.Query, t.Query},
+		{&ct.Request, t.Request},
+	} {
+		switch {
+		case d.val < 0:
+			*d.dst = 0
+		case d.val > 0:
+			*d.dst = d.val
+		}
+	}
+	return ct
+}
+
+// proposalPolicy builds the client proposal policy from the configured one.
+func proposalPolicy(cfg config.Config) (client.ProposalPolicy, error) {
+	p := cfg.ProposalPolicy
+	peers := func(names []string) ([]wire.Address, error) {
+		return policyPeers(cfg, "proposal", names)
+	}
+
+	var policies []client.ProposalPolicy
+	if len(p.AllowPeers) > 0 {
+		allowed, err := peers(p.AllowPeers)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, client.AllowPeers(allowed...))
+	}
+	if len(p.DenyPeers) > 0 {
+		denied, err := peers(p.DenyPeers)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, client.DenyPeers(denied...))
+	}
+	if p.RequireEqualFunding {
+		policies = append(policies, client.EqualFunding)
+	}
+	policies = append(policies,
+		client.FundingLimits{
+			MinPeerDeposit: p.MinPeerDeposit,
+			MaxPeerDeposit: p.MaxPeerDeposit,
+			MaxOwnDeposit:  p.MaxOwnDeposit,
+		},
+		client.ChallengeDurationRange(p.MinChallengeDuration, p.MaxChallengeDuration),
+	)
+	if p.MaxChannels > 0 {
+		policies = append(policies, client.MaxChannels(p.MaxChannels))
+	}
+	if p.AskUser {
+		policies = append(policies, client.AskUser(p.AskTimeout))
+	}
+	return client.AllProposals(policies...), nil
+}
+
+// requestPolicy builds the client request policy from the configured one.
+func requestPolicy(cfg config.Config) (client.RequestPolicy, error) {
+	p := cfg.RequestPolicy
+	var policies []client.RequestPolicy
+	if len(p.AllowPeers) > 0 {
+		allowed, err := policyPeers(cfg, "request", p.AllowPeers)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, client.RequestsFromPeers(allowed...))
+	}
+	otherwise := client.DeclineRequests
+	if p.AskUser {
+		otherwise = client.AskUserRequests(p.AskTimeout)
+	}
+	if p.ApproveUpTo > 0 {
+		policies = append(policies, client.ApproveUpTo(client.Amount(p.ApproveUpTo), otherwise))
+	} else {
+		policies = append(policies, otherwise)
+	}
+	return client.AllRequests(policies...), nil
+}
+
+// policyPeers resolves the party or peer names listed in the named policy to
+// wire addresses.
+func policyPeers(cfg config.Config, policy string, names []string) ([]wire.Address, error) {
+	addrs := make([]wire.Address, len(names))
+	for i, name := range names {
+		pubKey, err := cfg.PublicKeyOf(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s policy peer %q: %w", policy, name, err)
+		}
+		if addrs[i], err = client.WireAddressFromPubKey(pubKey); err != nil {
+			return nil, fmt.Errorf("%s policy peer %q: %w", policy, name, err)
+		}
+	}
+	return addrs, nil
+}
+
+// updatePolicy builds a client update policy from the configured one.
+func updatePolicy(p config.UpdatePolicy) client.UpdatePolicy {
+	policies := []client.UpdatePolicy{
+		client.ConsistentUpdates,
+		client.PaymentLimits{Min: p.MinPayment, Max: p.MaxPayment},
+	}
+	if p.MaxPerPeriod > 0 {
+		policies = append(policies, client.NewPeriodLimit(p.MaxPerPeriod, p.Period))
+	}
+	if p.RefuseFinalizeWhilePending {
+		policies = append(policies, client.RefuseFinalizeWhilePending)
+	}
+	return client.AllUpdates(policies...)
+}
+
+// auditUpdate returns an update auditor that logs the outcome of every
+// incoming update of the named party.
+func auditUpdate(name string) func(*client.Update, error) {
+	return func(u *client.Update, err error) {
+		entry := logrus.WithFields(logrus.Fields{
+			client.LogFieldClient:  name,
+			client.LogFieldChannel: hex.EncodeToString(u.Current.ID[:]),
+			client.LogFieldVersion: u.Next.Version,
+			"amount":               u.Amount.String(),
+			"final":                u.Next.IsFinal,
+			"outcome":              "accepted",
+		})
+		if u.Peer != nil {
+			entry = entry.WithField(client.LogFieldPeer, fmt.Sprint(u.Peer))
+		}
+		if err != nil {
+			entry.WithError(err).WithField("outcome", "rejected").Warn("Audit: update rejected")
+			return
+		}
+		entry.Info("Audit: update accepted")
+	}
 }